@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
 	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/pipeline"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -18,11 +21,7 @@ import (
 )
 
 var (
-	awsDiscoveryRepo awscloud.DiscoveryRepository
-	gcpDiscoveryRepo gcpcloud.DiscoveryRepository
-	awsResources     []awscloud.ResourceDiscovery
-	gcpResources     []gcpcloud.ResourceDiscovery
-	sqsClient        *sqs.Client
+	discovery *pipeline.Discovery
 	// processingRoleCfg aws.Config
 	// client        database.Service
 )
@@ -31,39 +30,27 @@ var (
 // 	ClientID string `json:"client_id"`
 // }
 
-type Message struct {
-	JobID       string `json:"job_id"`
-	ClientID    string `json:"client_id"`
-	AccountID   string `json:"account_id"`
-	ClientEmail string `json:"client_email"`
-	Provider    string `json:"provider"`
-}
-
 func init() {
 
-	log.Info().Str("function", "init").Msg("getting db param")
+	log.Info().Str("function", "init").Msg("loading config")
 
 	processingRoleCfg, err := awscloud.GetRoleConfig()
 	if err != nil {
 		log.Fatal().Err(err).Str("function", "init").Msg("unable to get account role config")
 	}
 
-	// processing role env
-	processingRole, err := awscloud.GetParam(os.Getenv("PROCESSING_ROLE"), false, processingRoleCfg)
+	sources, err := config.DefaultSources(processingRoleCfg)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get processing role env from ssm")
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to set up config sources")
 	}
-	os.Setenv("PROCESSING_ROLE", processingRole)
 
-	// db setup
-	MONGO_DB_STRING, err := awscloud.GetParam(os.Getenv("MONGO_DB_STRING_PARAM"), true, processingRoleCfg)
+	cfg, err := config.Load(sources, config.ProcessingRole, config.MongoURI, config.RetrievalQueueURL)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get db env from ssm")
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to load config")
 	}
-	os.Setenv("MONGO_DB_STRING", MONGO_DB_STRING)
 
 	log.Info().Str("function", "init").Msg("setting db conn")
-	client, err := database.New()
+	client, err := database.New(cfg.Mongo)
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to connect to db")
 	}
@@ -79,126 +66,23 @@ func init() {
 
 	}()
 
-	RETRIEVAL_QUEUE_URL, err := awscloud.GetParam(os.Getenv("RETRIEVAL_QUEUE_PARAM"), false, processingRoleCfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get retrival queue url from ssm")
-	}
-	os.Setenv("RETRIEVAL_QUEUE_URL", RETRIEVAL_QUEUE_URL)
-
-	awsDiscoveryRepo = awscloud.NewDiscoveryRepository(client)
-	gcpDiscoveryRepo = gcpcloud.NewDiscoveryRepository(client)
-
-	awsResources = []awscloud.ResourceDiscovery{
-		&awscloud.S3Service{},
-	}
-
-	gcpResources = []gcpcloud.ResourceDiscovery{
-		&gcpcloud.GcsService{},
-	}
-
-	sqsClient = sqs.NewFromConfig(processingRoleCfg)
-
-}
-
-func awsHandler(clientID string, accountID string, clientEmail string) error {
-	log.Info().Str("account id", accountID).Msg("setting up discovery for aws client")
-	// config, err := awscloud.ClientRoleConfig("arn:aws:iam::050752608470:role/WozCrossAccountRole")
-	cfg, err := awscloud.ClientRoleConfig(fmt.Sprintf("arn:aws:iam::%s:role/WozCrossAccountRole", accountID))
-	if err != nil {
-		log.Fatal().Msgf("unable to load SDK config, %v", err)
-		return err
-	}
-
-	// Run discovery with the parsed event data
-	jobID, err := awscloud.RunDiscovery(cfg, awsDiscoveryRepo, clientID, accountID, awsResources)
-	if err != nil {
-		log.Error().Err(err).Str("account id", accountID).Msg("Error running discovery")
-		return err
-	}
-
-	msg := Message{
-		JobID:       jobID.Hex(),
-		ClientID:    clientID,
-		AccountID:   accountID,
-		ClientEmail: clientEmail,
-		Provider:    "AWS",
-	}
-
-	messageBody, err := json.Marshal(msg)
-	if err != nil {
-		log.Fatal().Msgf("failed to marshal message into JSON, %v", err)
-		return err
-	}
-
-	err = awscloud.SendSQSMessage(string(messageBody), sqsClient, os.Getenv("RETRIEVAL_QUEUE_URL"))
-	if err != nil {
-		log.Fatal().Str("jobID", jobID.Hex()).Msg("failed to send message to retrieval queue")
-		return err
-	}
-
-	log.Info().Str("account id", accountID).Str("jobID", jobID.Hex()).Msg("discovery process completed for aws client")
-
-	return nil
-}
-
-func gcpHandler(clientID string, projectID, clientEmail string) error {
-
-	log.Info().Str("project id", projectID).Msg("setting up discovery for gcp client")
-
-	jobID, err := gcpcloud.RunDiscovery(gcpDiscoveryRepo, clientID, projectID, gcpResources)
-	if err != nil {
-		log.Error().Err(err).Str("project id", projectID).Msg("Error running discovery")
-		return err
-	}
-
-	log.Info().Str("project id", projectID).Str("jobID", jobID.Hex()).Msg("discovery process completed for gcp client")
+	discovery = &pipeline.Discovery{
+		AWSDiscoveryRepo: awscloud.NewDiscoveryRepository(client),
+		AWSResources: []awscloud.ResourceDiscovery{
+			&awscloud.S3Service{},
+		},
+		AWSConfig: pipeline.CrossAccountRoleConfig(cfg.ProcessingRole),
 
-	msg := Message{
-		JobID:       jobID.Hex(),
-		ClientID:    clientID,
-		AccountID:   projectID,
-		ClientEmail: clientEmail,
-		Provider:    "GCP",
-	}
+		GCPDiscoveryRepo: gcpcloud.NewDiscoveryRepository(client),
+		GCPResources: []gcpcloud.ResourceDiscovery{
+			&gcpcloud.GcsService{},
+		},
 
-	messageBody, err := json.Marshal(msg)
-	if err != nil {
-		log.Fatal().Msgf("failed to marshal message into JSON, %v", err)
-		return err
+		Outbox:         outbox.NewRepository(client),
+		Publisher:      queue.NewSQS(sqs.NewFromConfig(processingRoleCfg)),
+		RetrievalQueue: cfg.RetrievalQueueURL,
 	}
 
-	err = awscloud.SendSQSMessage(string(messageBody), sqsClient, os.Getenv("RETRIEVAL_QUEUE_URL"))
-	if err != nil {
-		log.Fatal().Str("jobID", jobID.Hex()).Msg("failed to send message to retrieval queue")
-		return err
-	}
-
-	return nil
-
-	// ctx := context.Background()
-	// client, err := storage.NewClient(ctx)
-	// if err != nil {
-	// 	log.Fatal().Err(err).Msg("failed to create client for gcp storage")
-	// 	return err
-	// }
-	// defer client.Close()
-
-	// ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-	// defer cancel()
-
-	// it := client.Buckets(ctx, clientGCPProjectID)
-	// for {
-	// 	battrs, err := it.Next()
-	// 	if err == iterator.Done {
-	// 		break
-	// 	}
-	// 	if err != nil {
-	// 		log.Fatal().Err(err).Msg("failed while iterating gcp buckets")
-	// 		return err
-	// 	}
-	// 	log.Info().Msgf("Bucket: %v\n", battrs.Name)
-	// }
-	// return nil
 }
 
 type Invoke struct {
@@ -233,11 +117,11 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		log.Info().Msg("manual trigger invoked")
 
 		if invoke.AwsAccountID != "" {
-			awsHandler(invoke.ClientID, invoke.AwsAccountID, invoke.ClientEmail)
+			discovery.RunAWS(ctx, invoke.ClientID, invoke.AwsAccountID, invoke.ClientEmail)
 		}
 
 		if invoke.GcpProjectID != "" {
-			gcpHandler(invoke.ClientID, invoke.GcpProjectID, invoke.ClientEmail)
+			discovery.RunGCP(ctx, invoke.ClientID, invoke.GcpProjectID, invoke.ClientEmail)
 		}
 
 		log.Info().Msg("manual discovery process completed")
@@ -252,9 +136,9 @@ func handler(ctx context.Context, event json.RawMessage) error {
 		clientGCPProjectID := "the-other-450607-a4"
 		// clientGCPProjectID := "cs464-454011"
 
-		awsHandler(awsClientID, awsAccountID, clientEmail)
+		discovery.RunAWS(ctx, awsClientID, awsAccountID, clientEmail)
 
-		gcpHandler(gcpClientID, clientGCPProjectID, clientEmail)
+		discovery.RunGCP(ctx, gcpClientID, clientGCPProjectID, clientEmail)
 
 		log.Info().Msg("interval discovery process completed")
 
@@ -264,53 +148,6 @@ func handler(ctx context.Context, event json.RawMessage) error {
 
 }
 
-// func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
-// 	// Assuming discoveryRepo and AWS Config are provided from somewhere
-
-// 	for _, message := range sqsEvent.Records {
-// 		log.Info().Str("messageID", message.MessageId).Msg("Processing SQS message")
-
-// 		var discoveryJob DiscoveryJob
-// 		err := json.Unmarshal([]byte(message.Body), &discoveryJob)
-// 		if err != nil {
-// 			log.Error().Err(err).Str("messageID", message.MessageId).Msg("Failed to unmarshal SQS message body")
-// 			continue
-// 		}
-
-// 		// config, err := awscloud.ClientRoleConfig("arn:aws:iam::050752608470:role/WozCrossAccountRole")
-// 		cfg, err := awscloud.ClientRoleConfig(fmt.Sprintf("arn:aws:iam::%s:role/WozCrossAccountRole", discoveryJob.ClientID))
-// 		if err != nil {
-// 			log.Fatal().Msgf("unable to load SDK config, %v", err)
-// 		}
-
-// 		// Run discovery with the parsed event data
-// 		jobID, err := awscloud.RunDiscovery(cfg, discoveryRepo, resources)
-// 		if err != nil {
-// 			log.Error().Err(err).Str("messageID", message.MessageId).Msg("Error running discovery")
-// 			continue
-// 		}
-
-// 		msg := Message{
-// 			ClientID: discoveryJob.ClientID,
-// 			JobID:    jobID.Hex(),
-// 		}
-
-// 		messageBody, err := json.Marshal(msg)
-// 		if err != nil {
-// 			log.Fatal().Msgf("failed to marshal message into JSON, %v", err)
-// 		}
-
-// 		err = awscloud.SendSQSMessage(string(messageBody), sqsClient, os.Getenv("RETRIEVAL_QUEUE_URL"))
-// 		if err != nil {
-// 			log.Fatal().Str("messageID", message.MessageId).Str("jobID", jobID.Hex()).Msg("Failed to send message to retrieval queue")
-// 		}
-
-// 		log.Info().Str("messageID", message.MessageId).Str("jobID", jobID.Hex()).Msg("Discovery process completed for message")
-// 	}
-
-// 	return nil
-// }
-
 func main() {
 	lambda.Start(handler)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	outboxRepo outbox.Repository
+	publisher  queue.Publisher
+)
+
+func init() {
+
+	log.Info().Str("function", "init").Msg("loading config")
+
+	processingRoleCfg, err := awscloud.GetRoleConfig()
+	if err != nil {
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to get account role config")
+	}
+
+	sources, err := config.DefaultSources(processingRoleCfg)
+	if err != nil {
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to set up config sources")
+	}
+
+	cfg, err := config.Load(sources, config.MongoURI)
+	if err != nil {
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to load config")
+	}
+
+	log.Info().Str("function", "init").Msg("setting db conn")
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to connect to db")
+	}
+
+	var c = make(chan os.Signal, 1)
+
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
+	go func() {
+
+		sig := <-c
+		log.Info().Str("signal", sig.String()).Msg("Signal received, shutting down")
+		client.Disconnect()
+
+	}()
+
+	// every outbox message names its queue, so the relay needs no queue URL of its own
+	outboxRepo = outbox.NewRepository(client)
+	publisher = queue.NewSQS(sqs.NewFromConfig(processingRoleCfg))
+}
+
+// handler runs on a schedule and hands off the completed stages whose inline relay failed.
+func handler(ctx context.Context) error {
+	sent, err := outbox.RelayStale(ctx, outboxRepo, publisher, outbox.DefaultRetryPolicy, time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("stale outbox relay failed")
+		return err
+	}
+
+	log.Info().Int("sent", sent).Msg("stale outbox relay completed")
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -2,72 +2,51 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"os"
 	"os/signal"
 	"syscall"
 
 	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
 	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/compliance"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/notify"
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/pipeline"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/rs/zerolog/log"
-	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 var (
-	regoRepo opa2.RegoRepository
-	scanRepo opa2.ScanRepository
-
-	awsConfigRepo awscloud.ConfigRepository
-	awsResources  []awscloud.ResourceDiscovery
-
-	gcpConfigRepo gcpcloud.ConfigRepository
-	gcpResources  []gcpcloud.ResourceDiscovery
-
-	client            database.Service
-	sqsClient         *sqs.Client
-	processingRoleCfg aws.Config
+	scan *pipeline.Scan
 )
 
-type Message struct {
-	JobID       string `json:"job_id"`
-	ClientID    string `json:"client_id"`
-	AccountID   string `json:"account_id"`
-	ClientEmail string `json:"client_email"`
-	Provider    string `json:"provider"`
-}
-
 func init() {
 
-	log.Info().Str("function", "init").Msg("getting db param")
+	log.Info().Str("function", "init").Msg("loading config")
 
 	processingRoleCfg, err := awscloud.GetRoleConfig()
 	if err != nil {
 		log.Fatal().Err(err).Str("function", "init").Msg("unable to get account role config")
 	}
 
-	// processing role env
-	processingRole, err := awscloud.GetParam(os.Getenv("PROCESSING_ROLE"), false, processingRoleCfg)
+	sources, err := config.DefaultSources(processingRoleCfg)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get processing role env from ssm")
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to set up config sources")
 	}
-	os.Setenv("PROCESSING_ROLE", processingRole)
 
-	// db setup
-	MONGO_DB_STRING, err := awscloud.GetParam(os.Getenv("MONGO_DB_STRING_PARAM"), true, processingRoleCfg)
+	cfg, err := config.Load(sources, config.MongoURI, config.SMTPHost, config.SMTPUser, config.SMTPPassword)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get db env from ssm")
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to load config")
 	}
-	os.Setenv("MONGO_DB_STRING", MONGO_DB_STRING)
 
 	log.Info().Str("function", "init").Msg("setting db conn")
-	client, err := database.New()
+	client, err := database.New(cfg.Mongo)
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to connect to db")
 	}
@@ -83,70 +62,47 @@ func init() {
 
 	}()
 
-	SMTP_PASSWORD, err := awscloud.GetParam(os.Getenv("SMTP_PASSWORD_PARAM"), true, processingRoleCfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("unable to get db env from ssm")
-	}
-	os.Setenv("SMTP_PASSWORD", SMTP_PASSWORD)
-
-	// SCAN_QUEUE_URL, err := awscloud.GetParam(os.Getenv("SCAN_QUEUE_URL"), false, processingRoleCfg)
-	// if err != nil {
-	// 	log.Fatal().Err(err).Msg("unable to get scan queue url from ssm")
-	// }
-	// os.Setenv("SCAN_QUEUE_URL", SCAN_QUEUE_URL)
+	regoRepo := opa2.NewRegoRepository(client)
 
-	regoRepo = opa2.NewRegoRepository(client)
-	scanRepo = opa2.NewScanRepository(client)
-	awsConfigRepo = awscloud.NewConfigRepository(client)
-	gcpConfigRepo = gcpcloud.NewConfigRepository(client)
+	// compiled policies outlive a single invocation; drop them as soon as a policy changes
+	go opa2.DefaultPolicyCache.Watch(context.Background(), regoRepo)
 
-	awsResources = []awscloud.ResourceDiscovery{
-		&awscloud.S3Service{},
+	if err := findings.EnsureIndexes(client); err != nil {
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to create finding indexes")
 	}
 
-	gcpResources = []gcpcloud.ResourceDiscovery{
-		&gcpcloud.GcsService{},
+	frameworks, err := compliance.DefaultCatalog()
+	if err != nil {
+		log.Fatal().Err(err).Str("function", "init").Msg("unable to load compliance frameworks")
 	}
 
-	sqsClient = sqs.NewFromConfig(processingRoleCfg)
+	scan = &pipeline.Scan{
+		Ledger:          ledger.NewRepository(client),
+		RegoRepo:        regoRepo,
+		ScanRepo:        opa2.NewScanRepository(client),
+		ParamsRepo:      opa2.NewParamsRepository(client),
+		OverrideRepo:    opa2.NewOverrideRepository(client),
+		SuppressionRepo: opa2.NewSuppressionRepository(client),
+		Notifier:        notify.NewSMTPSender(cfg.SMTP),
+		Findings:        findings.NewRepository(client),
+		Compliance:      compliance.NewRepository(client),
+		Frameworks:      frameworks,
+
+		AWSConfigRepo: awscloud.NewConfigRepository(client),
+		AWSResources: []awscloud.ResourceDiscovery{
+			&awscloud.S3Service{},
+		},
+
+		GCPConfigRepo: gcpcloud.NewConfigRepository(client),
+		GCPResources: []gcpcloud.ResourceDiscovery{
+			&gcpcloud.GcsService{},
+		},
+	}
 
 }
 
 func handler(ctx context.Context, sqsEvent events.SQSEvent) error {
-	// Assuming discoveryRepo and AWS Config are provided from somewhere
-
-	for _, message := range sqsEvent.Records {
-		log.Info().Str("messageID", message.MessageId).Msg("Processing SQS message")
-
-		var job Message
-		err := json.Unmarshal([]byte(message.Body), &job)
-		if err != nil {
-			log.Error().Err(err).Str("messageID", message.MessageId).Msg("Failed to unmarshal SQS message body")
-			continue
-		}
-
-		id, err := bson.ObjectIDFromHex(job.JobID)
-		if err != nil {
-			log.Fatal().Msgf("unable to convert job id to bson.ObjectID, %v", err)
-		}
-
-		if job.Provider == "AWS" {
-			err = opa2.RunScan(awsConfigRepo, scanRepo, regoRepo, id, job.ClientID, job.AccountID, job.ClientEmail, "AWS", awsResources)
-		} else if job.Provider == "GCP" {
-			err = opa2.RunGCPScan(gcpConfigRepo, scanRepo, regoRepo, id, job.ClientID, job.AccountID, job.ClientEmail, "GCP", gcpResources)
-		} else {
-			log.Warn().Str("messageID", message.MessageId).Str("jobID", job.JobID).Msg("Provider not supported")
-			return errors.New("provider not supported")
-		}
-
-		if err != nil {
-			log.Fatal().Msgf("Scan failed, %v", err)
-		}
-
-		log.Info().Str("messageID", message.MessageId).Str("jobID", job.JobID).Msg("Scan process completed for message")
-	}
-
-	return nil
+	return queue.HandleSQSEvent(ctx, sqsEvent, scan.Handle)
 }
 
 func main() {
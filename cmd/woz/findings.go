@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+)
+
+// listFindings prints the tracked findings of a client, most recently seen first.
+func listFindings(args []string) error {
+	fs := flag.NewFlagSet("findings", flag.ExitOnError)
+	clientID := fs.String("client", "", "client ID")
+	status := fs.String("status", "", "only list findings with this status: open, resolved, reopened or suppressed")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args)
+
+	if *clientID == "" {
+		fs.Usage()
+		return fmt.Errorf("-client is required")
+	}
+
+	setupLogging(*verbose)
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+
+	tracked, err := findings.NewRepository(client).FindByClient(*clientID, findings.Status(*status))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range tracked {
+		since := "since " + f.FirstSeen.Format(time.RFC3339)
+		switch {
+		case f.Status == findings.StatusResolved:
+			since = "at " + f.ResolvedAt.Format(time.RFC3339)
+		case f.Suppression != nil:
+			since = fmt.Sprintf("accepted by %s until %s", f.Suppression.Owner, f.Suppression.ExpiresAt.Format(time.DateOnly))
+		}
+		fmt.Printf("%3d %-10s [%s] %s %s/%s %s, %s\n", f.RiskScore, f.Status, f.Severity, f.RuleID, f.ResourceType, f.ResourceID, f.Title, since)
+	}
+	return nil
+}
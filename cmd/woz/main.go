@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/compliance"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/notify"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/pipeline"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// woz runs the discovery -> retrieval -> scan pipeline in a single process, with an in-memory
+// queue between the stages, so a client scan can be debugged from a laptop.
+
+const (
+	// local queue names are distinct from the SQS queue URLs so that the outbox relay of a local
+	// run never picks up messages meant for the deployed Lambdas
+	localRetrievalQueue = "woz-local/retrieval"
+	localScanQueue      = "woz-local/scan"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: woz <command> [flags]
+
+commands:
+  run      run discovery, retrieval and scan for one AWS account or GCP project;
+           needs MongoDB as a replica set, e.g. a single-node one (mongod --replSet rs0)
+  policy   sync, list, activate, roll back and retire policy versions
+  params   show and set the params document of a client
+  override disable built-in policies and rules for a client
+  suppress accept the risk of findings for a client until an expiry date
+  findings list the tracked findings of a client
+
+run "woz <command> -h" for the flags of a command
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "policy":
+		err = policy(os.Args[2:])
+	case "params":
+		err = params(os.Args[2:])
+	case "override":
+		err = override(os.Args[2:])
+	case "suppress":
+		err = suppress(os.Args[2:])
+	case "findings":
+		err = listFindings(os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "woz: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "woz: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	provider := fs.String("provider", "aws", "cloud provider of the account: aws or gcp")
+	accountID := fs.String("account", "", "AWS account ID or GCP project ID to scan")
+	clientID := fs.String("client", "local", "internal client ID to record the job under")
+	clientEmail := fs.String("email", "", "address to send the scan result email to; skipped when empty or SMTP_HOST is not configured")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name, e.g. {\"mongo_uri\": \"...\"}")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	processingRole := fs.String("processing-role", "", "ARN of the Woz processing role used to reach the client role, overrides PROCESSING_ROLE")
+	localCreds := fs.Bool("local-creds", false, "use the local AWS credentials directly instead of assuming the client's WozCrossAccountRole")
+	verbose := fs.Bool("v", false, "stream debug logs from every stage")
+	fs.Parse(args)
+
+	if *accountID == "" {
+		fs.Usage()
+		return fmt.Errorf("-account is required")
+	}
+
+	setupLogging(*verbose)
+
+	required := []string{config.MongoURI}
+	if strings.ToUpper(*provider) == pipeline.AWSProvider && !*localCreds {
+		required = append(required, config.ProcessingRole)
+	}
+
+	cfg, err := loadConfig(*configFile, map[string]string{
+		config.MongoURI:       *mongoURI,
+		config.ProcessingRole: *processingRole,
+	}, required...)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+
+	// every stage completes in a transaction, which a standalone mongod rejects only once the
+	// first stage has done its work
+	if err := client.CheckTransactions(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	mem := queue.NewMemory()
+	ledgerRepo := ledger.NewRepository(client)
+	outboxRepo := outbox.NewRepository(client)
+	scanRepo := opa2.NewScanRepository(client)
+
+	awsResources := []awscloud.ResourceDiscovery{
+		&awscloud.S3Service{},
+	}
+	gcpResources := []gcpcloud.ResourceDiscovery{
+		&gcpcloud.GcsService{},
+	}
+
+	awsConfig := pipeline.CrossAccountRoleConfig(cfg.ProcessingRole)
+	if *localCreds {
+		awsConfig = func(accountID string) (aws.Config, error) {
+			return awscloud.GetRoleConfig()
+		}
+	}
+
+	discovery := &pipeline.Discovery{
+		AWSDiscoveryRepo: awscloud.NewDiscoveryRepository(client),
+		AWSResources:     awsResources,
+		AWSConfig:        awsConfig,
+		GCPDiscoveryRepo: gcpcloud.NewDiscoveryRepository(client),
+		GCPResources:     gcpResources,
+		Outbox:           outboxRepo,
+		Publisher:        mem,
+		RetrievalQueue:   localRetrievalQueue,
+	}
+
+	retrieval := &pipeline.Retrieval{
+		DB:               client,
+		Ledger:           ledgerRepo,
+		AWSDiscoveryRepo: awscloud.NewDiscoveryRepository(client),
+		AWSConfigRepo:    awscloud.NewConfigRepository(client),
+		AWSResources:     awsResources,
+		AWSConfig:        awsConfig,
+		GCPDiscoveryRepo: gcpcloud.NewDiscoveryRepository(client),
+		GCPConfigRepo:    gcpcloud.NewConfigRepository(client),
+		GCPResources:     gcpResources,
+		Outbox:           outboxRepo,
+		Publisher:        mem,
+		ScanQueue:        localScanQueue,
+	}
+
+	frameworks, err := compliance.DefaultCatalog()
+	if err != nil {
+		return err
+	}
+	complianceRepo := compliance.NewRepository(client)
+	if err := findings.EnsureIndexes(client); err != nil {
+		return err
+	}
+	findingRepo := findings.NewRepository(client)
+
+	scan := &pipeline.Scan{
+		Ledger:          ledgerRepo,
+		RegoRepo:        opa2.NewRegoRepository(client),
+		ScanRepo:        scanRepo,
+		ParamsRepo:      opa2.NewParamsRepository(client),
+		OverrideRepo:    opa2.NewOverrideRepository(client),
+		SuppressionRepo: opa2.NewSuppressionRepository(client),
+		Findings:        findingRepo,
+		Compliance:      complianceRepo,
+		Frameworks:      frameworks,
+		AWSConfigRepo:   awscloud.NewConfigRepository(client),
+		AWSResources:    awsResources,
+		GCPConfigRepo:   gcpcloud.NewConfigRepository(client),
+		GCPResources:    gcpResources,
+	}
+	if *clientEmail != "" && cfg.SMTP.Host != "" {
+		scan.Notifier = notify.NewSMTPSender(cfg.SMTP)
+	}
+
+	start := time.Now()
+
+	progress("discovery", "discovering resources for %s %s", strings.ToUpper(*provider), *accountID)
+	var jobID bson.ObjectID
+	switch strings.ToUpper(*provider) {
+	case pipeline.AWSProvider:
+		jobID, err = discovery.RunAWS(ctx, *clientID, *accountID, *clientEmail)
+	case pipeline.GCPProvider:
+		jobID, err = discovery.RunGCP(ctx, *clientID, *accountID, *clientEmail)
+	default:
+		return fmt.Errorf("unsupported provider %q", *provider)
+	}
+	if err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+	progress("discovery", "job %s created", jobID.Hex())
+
+	if err := runStage(ctx, mem, "retrieval", localRetrievalQueue, retrieval.Handle); err != nil {
+		return err
+	}
+
+	if err := runStage(ctx, mem, "scan", localScanQueue, scan.Handle); err != nil {
+		return err
+	}
+
+	results, err := scanRepo.FindByJobID(jobID)
+	if err != nil {
+		return fmt.Errorf("unable to load scan results: %w", err)
+	}
+	printResults(results)
+
+	tracked, err := findingRepo.FindByAccount(*clientID, *accountID)
+	if err != nil {
+		return fmt.Errorf("unable to load tracked findings: %w", err)
+	}
+	printFindingChanges(tracked, jobID)
+
+	for _, framework := range frameworks {
+		scores, err := complianceRepo.History(*clientID, *accountID, framework.ID, 2)
+		if err != nil {
+			return fmt.Errorf("unable to load compliance scores: %w", err)
+		}
+		if len(scores) > 0 && scores[0].DiscoveryJobID == jobID {
+			printCompliance(framework, scores)
+		}
+	}
+
+	progress("done", "job %s finished in %s", jobID.Hex(), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// loadConfig layers the optional config file, the environment and the settings given as flags.
+func loadConfig(configFile string, flags map[string]string, required ...string) (*config.Config, error) {
+	var sources []config.Source
+	if configFile != "" {
+		file, err := config.NewFileSource(configFile)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, file)
+	}
+	sources = append(sources,
+		config.NewEnvSource(),
+		config.NewMapSource("flags", flags),
+	)
+
+	return config.Load(sources, required...)
+}
+
+func setupLogging(verbose bool) {
+	level := zerolog.InfoLevel
+	if !verbose {
+		level = zerolog.WarnLevel
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.Kitchen}).Level(level)
+}
+
+// runStage drains the stage's local queue. An empty queue means the previous stage's hand-off never
+// reached it, so the run stops there rather than reporting an empty scan.
+func runStage(ctx context.Context, mem *queue.Memory, stage string, name string, handler queue.Handler) error {
+	pending := mem.Len(name)
+	if pending == 0 {
+		return fmt.Errorf("%s: no message was handed off to the %s queue", stage, stage)
+	}
+
+	progress(stage, "processing %d message(s)", pending)
+	stageStart := time.Now()
+
+	handled, err := mem.Process(ctx, name, handler)
+	if err != nil {
+		return fmt.Errorf("%s: %w", stage, err)
+	}
+	if handled != pending {
+		return fmt.Errorf("%s: %d of %d message(s) failed, rerun with -v for details", stage, pending-handled, pending)
+	}
+
+	progress(stage, "completed in %s", time.Since(stageStart).Round(time.Millisecond))
+	return nil
+}
+
+func progress(stage string, format string, args ...interface{}) {
+	fmt.Printf("[%-9s] %s\n", stage, fmt.Sprintf(format, args...))
+}
+
+func printResults(results []opa2.ScanResult) {
+	opa2.SortByRisk(results)
+
+	counts := make(map[opa2.Outcome]int)
+	errored, suppressed := 0, 0
+	for _, result := range results {
+		counts[result.Outcome]++
+		suppressed += len(result.Suppressed)
+		if result.Error != "" {
+			errored++
+		}
+	}
+
+	progress("results", "%d resource(s) scanned: %d passed, %d with misconfigurations, %d not applicable, %d could not be evaluated, %d suppressed finding(s)",
+		len(results), counts[opa2.OutcomePass], counts[opa2.OutcomeFail], counts[opa2.OutcomeNotApplicable], counts[opa2.OutcomeError], suppressed)
+	for _, result := range results {
+		if result.Outcome != opa2.OutcomeFail {
+			continue
+		}
+		fmt.Printf("  %s/%s risk %d (%s)\n", result.ResourceType, result.ResourceID, result.RiskScore, result.Risk.Exposure)
+		for _, finding := range result.Findings {
+			fmt.Printf("    - [%s] %s %s (%s)\n", finding.Severity, finding.RuleID, finding.Title, finding.Policy)
+			for _, benchmark := range finding.Benchmarks {
+				fmt.Printf("        %s %s\n", benchmark.Framework, benchmark.Control)
+			}
+		}
+	}
+
+	if errored == 0 {
+		return
+	}
+	progress("errors", "resources that could not be fully evaluated")
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Printf("  %s/%s after %d attempt(s): %s\n", result.ResourceType, result.ResourceID, result.Attempts, result.Error)
+		}
+	}
+}
+
+// printFindingChanges prints how the job changed the tracked findings of the account.
+func printFindingChanges(tracked []findings.Finding, jobID bson.ObjectID) {
+	counts := make(map[findings.Status]int)
+	open, suppressed := 0, 0
+	for _, f := range tracked {
+		switch {
+		case f.Status == findings.StatusSuppressed:
+			suppressed++
+		case f.Active():
+			open++
+		}
+		if f.LastDiscoveryJobID != jobID {
+			continue
+		}
+		if f.Status == findings.StatusOpen && f.FirstSeen.Equal(f.LastSeen) {
+			counts["new"]++
+		} else if f.Status != findings.StatusOpen {
+			counts[f.Status]++
+		}
+	}
+
+	progress("findings", "%d open, %d suppressed: %d new, %d reopened, %d resolved by this scan", open, suppressed, counts["new"], counts[findings.StatusReopened], counts[findings.StatusResolved])
+}
+
+// printCompliance prints the latest score of a framework and its change since the previous scan.
+func printCompliance(framework compliance.Framework, scores []compliance.Score) {
+	latest := scores[0]
+	change := ""
+	if len(scores) > 1 {
+		change = fmt.Sprintf(" (%+.1f since %s)", latest.Percent-scores[1].Percent, scores[1].ScannedAt.Format(time.RFC3339))
+	}
+
+	progress("compliance", "%s %s: %.1f%%%s, %d passed, %d failed, %d not evaluated",
+		framework.Name, framework.Version, latest.Percent, change, latest.Passed, latest.Failed, latest.NotEvaluated)
+	for _, control := range latest.Controls {
+		if control.Status == compliance.ControlFailed {
+			fmt.Printf("  %-6s %s\n", control.ControlID, control.Title)
+			for _, resource := range control.FailedResources {
+				fmt.Printf("         - %s\n", resource)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func overrideUsage() {
+	fmt.Fprintf(os.Stderr, `usage: woz override list -client <client ID>
+       woz override add -client <client ID> -type <resource type> [-policy <policy>] [-rule <rule ID>] -reason <why>
+       woz override remove -client <client ID> -id <override ID>
+
+commands:
+  list    list the built-in policies and rules disabled for the client
+  add     disable a built-in policy, or a rule of every or one built-in policy, for the client
+  remove  enable the policy or rule again
+`)
+}
+
+func override(args []string) error {
+	if len(args) < 1 {
+		overrideUsage()
+		os.Exit(2)
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("override "+command, flag.ExitOnError)
+	clientID := fs.String("client", "", "client ID")
+	resourceType := fs.String("type", "", "resource type of the policy or rule, e.g. s3")
+	policyName := fs.String("policy", "", "name of the built-in policy")
+	ruleID := fs.String("rule", "", "rule ID to disable")
+	reason := fs.String("reason", "", "why the policy or rule does not apply to the client")
+	id := fs.String("id", "", "ID of the override to remove")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args[1:])
+
+	if *clientID == "" {
+		fs.Usage()
+		return fmt.Errorf("-client is required")
+	}
+
+	setupLogging(*verbose)
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+
+	overrideRepo := opa2.NewOverrideRepository(client)
+
+	switch command {
+	case "list":
+		overrides, err := overrideRepo.FindByClientID(*clientID)
+		if err != nil {
+			return err
+		}
+		for _, o := range overrides {
+			target := o.ResourceType + "/" + o.Policy
+			if o.RuleID != "" {
+				target = o.ResourceType + " " + o.RuleID
+				if o.Policy != "" {
+					target += " in " + o.Policy
+				}
+			}
+			fmt.Printf("%s  %s  %-40s %s\n", o.ID.Hex(), o.CreatedAt.Format(time.RFC3339), target, o.Reason)
+		}
+	case "add":
+		o := &opa2.PolicyOverride{ClientID: *clientID, ResourceType: *resourceType, Policy: *policyName, RuleID: *ruleID, Reason: *reason}
+		created, err := overrideRepo.Create(o)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("override %s created\n", created.Hex())
+	case "remove":
+		objectID, err := bson.ObjectIDFromHex(*id)
+		if err != nil {
+			return fmt.Errorf("invalid -id %q: %w", *id, err)
+		}
+		if err := overrideRepo.Delete(*clientID, objectID); err != nil {
+			return err
+		}
+		fmt.Printf("override %s removed\n", *id)
+	default:
+		overrideUsage()
+		return fmt.Errorf("unknown override command %q", command)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+)
+
+func paramsUsage() {
+	fmt.Fprintf(os.Stderr, `usage: woz params show -client <client ID>
+       woz params set -client <client ID> -file <params.json>
+
+commands:
+  show  print the params document policies see as data.params for the client
+  set   replace the client's params document with the JSON object in -file
+`)
+}
+
+func params(args []string) error {
+	if len(args) < 1 {
+		paramsUsage()
+		os.Exit(2)
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("params "+command, flag.ExitOnError)
+	clientID := fs.String("client", "", "client ID")
+	file := fs.String("file", "", "JSON file with the params document")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args[1:])
+
+	if *clientID == "" {
+		fs.Usage()
+		return fmt.Errorf("-client is required")
+	}
+
+	setupLogging(*verbose)
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+
+	paramsRepo := opa2.NewParamsRepository(client)
+
+	switch command {
+	case "show":
+		p, err := paramsRepo.FindByClientID(*clientID)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			p = opa2.Params{}
+		}
+		out, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "set":
+		if *file == "" {
+			return fmt.Errorf("-file is required")
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", *file, err)
+		}
+		var p opa2.Params
+		if err := json.Unmarshal(data, &p); err != nil {
+			return fmt.Errorf("%s is not a JSON object: %w", *file, err)
+		}
+		if err := paramsRepo.Save(*clientID, p); err != nil {
+			return err
+		}
+		fmt.Printf("params of client %s saved\n", *clientID)
+	default:
+		paramsUsage()
+		return fmt.Errorf("unknown params command %q", command)
+	}
+
+	return nil
+}
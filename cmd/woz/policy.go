@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+)
+
+func policyUsage() {
+	fmt.Fprintf(os.Stderr, `usage: woz policy <command> -type <resource type> -name <policy> [flags]
+       woz policy sync [-dry-run]
+       woz policy upload -client <client ID> -name <policy> -file <module.rego>
+
+commands:
+  sync      make the stored policies match the policies/ tree built into woz
+  upload    store and activate a new version of the client's policy <client ID>/<name>
+  versions  list every version of a policy and its state
+  history   list the activations of a policy, newest first
+  activate  make -version the active version, retiring the current one
+  rollback  reactivate the version that was active before the last change
+  retire    stop evaluating the policy
+  enable    evaluate the policy's active version in scans
+  disable   skip the policy in scans without changing its active version
+`)
+}
+
+func policy(args []string) error {
+	if len(args) < 1 {
+		policyUsage()
+		os.Exit(2)
+	}
+	command := args[0]
+	switch command {
+	case "sync":
+		return policySync(args[1:])
+	case "upload":
+		return policyUpload(args[1:])
+	}
+
+	fs := flag.NewFlagSet("policy "+command, flag.ExitOnError)
+	resourceType := fs.String("type", "", "resource type of the policy, e.g. s3")
+	name := fs.String("name", "", "name of the policy")
+	version := fs.Int("version", 0, "version to activate")
+	reason := fs.String("reason", "", "why the change is made, kept in the activation history")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args[1:])
+
+	if *resourceType == "" || *name == "" {
+		fs.Usage()
+		return fmt.Errorf("-type and -name are required")
+	}
+
+	setupLogging(*verbose)
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+	if err := opa2.EnsureRegoIndexes(client); err != nil {
+		return err
+	}
+
+	regoRepo := opa2.NewRegoRepository(client)
+
+	switch command {
+	case "versions":
+		versions, err := regoRepo.FindVersions(*resourceType, *name)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			state := v.State
+			if state == "" {
+				state = opa2.PolicyActive
+			}
+			fmt.Printf("v%-4d %-8s enabled=%-5t created %s\n", v.Version, state, v.Enabled, v.CreatedAt.Format(time.RFC3339))
+		}
+	case "history":
+		activations, err := regoRepo.History(*resourceType, *name)
+		if err != nil {
+			return err
+		}
+		for _, a := range activations {
+			fmt.Printf("%s  %-8s v%d -> v%d  %s\n", a.CreatedAt.Format(time.RFC3339), a.Action, a.PreviousVersion, a.Version, a.Reason)
+		}
+	case "activate":
+		if *version == 0 {
+			return fmt.Errorf("-version is required")
+		}
+		if err := regoRepo.Activate(*resourceType, *name, *version, *reason); err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s v%d is active\n", *resourceType, *name, *version)
+	case "rollback":
+		restored, err := regoRepo.Rollback(*resourceType, *name, *reason)
+		if errors.Is(err, opa2.ErrNoPreviousVersion) {
+			return fmt.Errorf("%s/%s: %w", *resourceType, *name, err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s rolled back to v%d\n", *resourceType, *name, restored)
+	case "retire":
+		if err := regoRepo.Retire(*resourceType, *name, *reason); err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s retired\n", *resourceType, *name)
+	case "enable", "disable":
+		if err := regoRepo.SetEnabled(*resourceType, *name, command == "enable"); err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s %sd\n", *resourceType, *name, command)
+	default:
+		policyUsage()
+		return fmt.Errorf("unknown policy command %q", command)
+	}
+
+	return nil
+}
+
+func policySync(args []string) error {
+	fs := flag.NewFlagSet("policy sync", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args)
+
+	setupLogging(*verbose)
+
+	files, err := opa2.EmbeddedPolicies()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+	if err := opa2.EnsureRegoIndexes(client); err != nil {
+		return err
+	}
+
+	report, err := opa2.SyncPolicies(opa2.NewRegoRepository(client), files, *dryRun)
+	if report != nil {
+		printSyncReport(report, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	if len(report.Skipped) > 0 {
+		return fmt.Errorf("%d policy file(s) could not be loaded", len(report.Skipped))
+	}
+	return nil
+}
+
+func policyUpload(args []string) error {
+	fs := flag.NewFlagSet("policy upload", flag.ExitOnError)
+	clientID := fs.String("client", "", "client ID the policy applies to")
+	name := fs.String("name", "", "name of the policy, stored as <client ID>/<name>")
+	file := fs.String("file", "", "rego module of the policy")
+	reason := fs.String("reason", "", "why the change is made, kept in the activation history")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args)
+
+	if *clientID == "" || *name == "" || *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-client, -name and -file are required")
+	}
+
+	setupLogging(*verbose)
+
+	module, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", *file, err)
+	}
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+	if err := opa2.EnsureRegoIndexes(client); err != nil {
+		return err
+	}
+
+	stored, err := opa2.UploadClientPolicy(opa2.NewRegoRepository(client), *clientID, *name, string(module), *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s/%s v%d is active for client %s\n", stored.ResourceType, stored.Name, stored.Version, *clientID)
+	return nil
+}
+
+func printSyncReport(report *opa2.SyncReport, dryRun bool) {
+	prefix := ""
+	if dryRun {
+		prefix = "(dry run) "
+	}
+
+	for _, key := range report.Added {
+		fmt.Printf("%sadded      %s\n", prefix, key)
+	}
+	for _, key := range report.Changed {
+		fmt.Printf("%schanged    %s\n", prefix, key)
+	}
+	for _, key := range report.Removed {
+		fmt.Printf("%sremoved    %s\n", prefix, key)
+	}
+	for filePath, err := range report.Skipped {
+		fmt.Printf("%sskipped    %s: %v\n", prefix, filePath, err)
+	}
+	fmt.Printf("%s%d added, %d changed, %d removed, %d unchanged, %d skipped\n", prefix,
+		len(report.Added), len(report.Changed), len(report.Removed), len(report.Unchanged), len(report.Skipped))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func suppressUsage() {
+	fmt.Fprintf(os.Stderr, `usage: woz suppress list -client <client ID>
+       woz suppress add -client <client ID> [-rule <rule ID>] [-type <resource type>] [-resource <pattern>] [-account <account>] [-tag key=value]... -justification <why> -owner <who> -expires <YYYY-MM-DD>
+       woz suppress remove -client <client ID> -id <suppression ID>
+
+commands:
+  list    list the client's suppressions, expired ones included
+  add     accept the risk of the findings every given scope matches until the expiry date
+  remove  report the findings again from the next scan
+`)
+}
+
+func suppress(args []string) error {
+	if len(args) < 1 {
+		suppressUsage()
+		os.Exit(2)
+	}
+	command := args[0]
+
+	tags := make(map[string]string)
+	fs := flag.NewFlagSet("suppress "+command, flag.ExitOnError)
+	clientID := fs.String("client", "", "client ID")
+	ruleID := fs.String("rule", "", "rule ID to suppress")
+	resourceType := fs.String("type", "", "resource type to suppress, e.g. s3")
+	resource := fs.String("resource", "", "resource ID pattern to suppress, * matching anything, e.g. www-*")
+	accountID := fs.String("account", "", "AWS account ID or GCP project ID to suppress")
+	fs.Func("tag", "resource tag key=value to suppress, repeatable; all must match", func(value string) error {
+		key, tagValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value")
+		}
+		tags[key] = tagValue
+		return nil
+	})
+	justification := fs.String("justification", "", "why the risk is accepted")
+	owner := fs.String("owner", "", "who accepts the risk")
+	expires := fs.String("expires", "", "date the suppression expires, YYYY-MM-DD")
+	id := fs.String("id", "", "ID of the suppression to remove")
+	configFile := fs.String("config", os.Getenv("WOZ_CONFIG_FILE"), "JSON config file keyed by setting name")
+	mongoURI := fs.String("mongo", "", "MongoDB connection string, overrides MONGO_DB_STRING")
+	verbose := fs.Bool("v", false, "print debug logs")
+	fs.Parse(args[1:])
+
+	if *clientID == "" {
+		fs.Usage()
+		return fmt.Errorf("-client is required")
+	}
+
+	setupLogging(*verbose)
+
+	cfg, err := loadConfig(*configFile, map[string]string{config.MongoURI: *mongoURI}, config.MongoURI)
+	if err != nil {
+		return err
+	}
+
+	client, err := database.New(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("unable to connect to db: %w", err)
+	}
+	defer client.Disconnect()
+
+	suppressionRepo := opa2.NewSuppressionRepository(client)
+
+	switch command {
+	case "list":
+		suppressions, err := suppressionRepo.FindByClientID(*clientID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, s := range suppressions {
+			state := "active"
+			if !s.Active(now) {
+				state = "expired"
+			}
+			fmt.Printf("%s  %-7s until %s  %-40s %s (%s)\n", s.ID.Hex(), state, s.ExpiresAt.Format(time.DateOnly), suppressionScope(s), s.Justification, s.Owner)
+		}
+	case "add":
+		expiresAt, err := time.Parse(time.DateOnly, *expires)
+		if err != nil {
+			return fmt.Errorf("invalid -expires %q: %w", *expires, err)
+		}
+		s := &opa2.Suppression{
+			ClientID:        *clientID,
+			RuleID:          *ruleID,
+			ResourceType:    *resourceType,
+			ResourcePattern: *resource,
+			AccountID:       *accountID,
+			Tags:            tags,
+			Justification:   *justification,
+			Owner:           *owner,
+			ExpiresAt:       expiresAt,
+		}
+		created, err := suppressionRepo.Create(s)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("suppression %s created\n", created.Hex())
+	case "remove":
+		objectID, err := bson.ObjectIDFromHex(*id)
+		if err != nil {
+			return fmt.Errorf("invalid -id %q: %w", *id, err)
+		}
+		if err := suppressionRepo.Delete(*clientID, objectID); err != nil {
+			return err
+		}
+		fmt.Printf("suppression %s removed\n", *id)
+	default:
+		suppressUsage()
+		return fmt.Errorf("unknown suppress command %q", command)
+	}
+
+	return nil
+}
+
+func suppressionScope(s opa2.Suppression) string {
+	var scope []string
+	if s.RuleID != "" {
+		scope = append(scope, s.RuleID)
+	}
+	if s.ResourceType != "" || s.ResourcePattern != "" {
+		scope = append(scope, s.ResourceType+"/"+s.ResourcePattern)
+	}
+	if s.AccountID != "" {
+		scope = append(scope, "account "+s.AccountID)
+	}
+	for key, value := range s.Tags {
+		scope = append(scope, key+"="+value)
+	}
+	return strings.Join(scope, " ")
+}
@@ -133,8 +133,8 @@ resource "aws_lambda_function" "discovery" {
   environment {
     variables = {
       MONGO_DB_STRING_PARAM = "/cs464/mongo_db_string"
-      PROCESSING_ROLE = "/cs464/cross_account_role"
-      RETRIEVAL_QUEUE_PARAM = "/cs464/retrieval_queue_url"
+      PROCESSING_ROLE_PARAM = "/cs464/cross_account_role"
+      RETRIEVAL_QUEUE_URL_PARAM = "/cs464/retrieval_queue_url"
       GOOGLE_APPLICATION_CREDENTIALS = "clientLibraryConfig-awswoz.json"
       GOOGLE_CLOUD_PROJECT = "cs464-454011"
     }
@@ -199,8 +199,8 @@ resource "aws_lambda_function" "retrieval" {
   environment {
     variables = {
       MONGO_DB_STRING_PARAM = "/cs464/mongo_db_string"
-      PROCESSING_ROLE = "/cs464/cross_account_role"
-      SCAN_QUEUE_PARAM = "/cs464/scan_queue_url"
+      PROCESSING_ROLE_PARAM = "/cs464/cross_account_role"
+      SCAN_QUEUE_URL_PARAM = "/cs464/scan_queue_url"
       GOOGLE_APPLICATION_CREDENTIALS = "clientLibraryConfig-awswoz.json"
       GOOGLE_CLOUD_PROJECT = "cs464-454011"
     }
@@ -251,7 +251,7 @@ resource "aws_lambda_function" "scan" {
   environment {
     variables = {
       MONGO_DB_STRING_PARAM = "/cs464/mongo_db_string"
-      PROCESSING_ROLE = "/cs464/cross_account_role"
+      PROCESSING_ROLE_PARAM = "/cs464/cross_account_role"
       SMTP_PASSWORD_PARAM = "/cs464/smtp_password"
       SMTP_HOST="smtp.gmail.com"
       SMTP_PORT="587"
@@ -277,3 +277,59 @@ resource "aws_lambda_event_source_mapping" "scan" {
   function_name       = aws_lambda_function.scan.function_name
   enabled             = true
 }
+
+##################################
+# Relay Lambda
+##################################
+
+data "archive_file" "relay_lambda_zip" {
+  type        = "zip"
+  source_file = "${path.module}/../../../../bin/relay/bootstrap"
+  output_path = "${path.module}/../../../../bin/relay/bootstrap.zip"
+}
+
+resource "aws_lambda_function" "relay" {
+  function_name = "relay_cs464_lambda"
+  handler       = "relay_lambda.handler"
+  runtime       = "provided.al2023"
+  role          = aws_iam_role.lambda_role.arn
+
+  filename = "${path.module}/../../../../bin/relay/bootstrap.zip"
+
+  environment {
+    variables = {
+      MONGO_DB_STRING_PARAM = "/cs464/mongo_db_string"
+      PROCESSING_ROLE_PARAM = "/cs464/cross_account_role"
+    }
+  }
+  timeout          = 45
+  source_code_hash = data.archive_file.relay_lambda_zip.output_base64sha256
+
+  publish = true
+}
+
+resource "aws_lambda_alias" "relay_alias" {
+  name             = "live"
+  function_name    = aws_lambda_function.relay.function_name
+  function_version = aws_lambda_function.relay.version
+}
+
+# hands off completed stages whose publish failed, see outbox.RelayStale
+resource "aws_cloudwatch_event_rule" "relay_schedule" {
+  name                = "relay_cs464_schedule"
+  schedule_expression = "rate(1 minute)"
+}
+
+resource "aws_cloudwatch_event_target" "relay" {
+  rule = aws_cloudwatch_event_rule.relay_schedule.name
+  arn  = aws_lambda_alias.relay_alias.arn
+}
+
+resource "aws_lambda_permission" "relay_schedule" {
+  statement_id  = "AllowRelaySchedule"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.relay.function_name
+  qualifier     = aws_lambda_alias.relay_alias.name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.relay_schedule.arn
+}
@@ -2,7 +2,6 @@ package awscloud
 
 import (
 	"context"
-	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -11,7 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func ClientRoleConfig(clientRoleARN string) (aws.Config, error) {
+func ClientRoleConfig(processingRoleARN string, clientRoleARN string) (aws.Config, error) {
 	// cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithSharedConfigProfile("wozrole"))
 	log.Info().Str("function", "GetRoleConfig").Msg("retriving aws role config")
 	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("us-east-1"))
@@ -21,7 +20,7 @@ func ClientRoleConfig(clientRoleARN string) (aws.Config, error) {
 	}
 
 	// assuming our own role with permission for cross account
-	appCreds := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), os.Getenv("PROCESSING_ROLE"))
+	appCreds := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), processingRoleARN)
 
 	_, err = appCreds.Retrieve(context.TODO())
 	if err != nil {
@@ -32,7 +32,9 @@ func NewDiscoveryJob() *cloud.DiscoveryJob {
 	}
 }
 
-func RunDiscovery(cfg aws.Config, discoveryRepo DiscoveryRepository, clientID string, accountID string, resources []ResourceDiscovery) (bson.ObjectID, error) {
+// RunDiscovery discovers every resource type for the account and completes the job. handoff, if not nil,
+// runs in the same transaction that marks the job completed.
+func RunDiscovery(cfg aws.Config, discoveryRepo DiscoveryRepository, clientID string, accountID string, resources []ResourceDiscovery, handoff cloud.Handoff) (bson.ObjectID, error) {
 	log.Info().Msg("Starting discovery process...")
 
 	job := NewDiscoveryJob()
@@ -78,7 +80,7 @@ func RunDiscovery(cfg aws.Config, discoveryRepo DiscoveryRepository, clientID st
 	// 	return bson.NilObjectID, fmt.Errorf("failed to update job with S3 ARNs for job ID %s: %w", jobID.Hex(), err)
 	// }
 
-	err = discoveryRepo.UpdateStatus(jobID, CompletedStatus)
+	err = discoveryRepo.CompleteJob(jobID, handoff)
 	if err != nil {
 		log.Error().Err(err).Str("client id", clientID).Str("account id", accountID).Str("function", "RunDiscovery").Str("jobID", jobID.Hex()).Msg("Failed to update job status to complete")
 		return bson.NilObjectID, fmt.Errorf("RunDiscovery: %w", err)
@@ -97,7 +99,7 @@ func RunRetrieval(cfg aws.Config, discoveryRepo DiscoveryRepository, configRepo
 		return fmt.Errorf("retrival: %w", err)
 	}
 
-	var resourceConfigs []interface{}
+	var resourceConfigs []cloud.ResourceConfig
 
 	for _, resource := range resources {
 		resourceName := resource.Name()
@@ -120,6 +122,7 @@ func RunRetrieval(cfg aws.Config, discoveryRepo DiscoveryRepository, configRepo
 		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resourceName).Int("retrieved", len(configs)).Msg("Configurations retrieved successfully")
 
 		for resourceID, config := range configs {
+			region, tags := cloud.TakeResourceMetadata(config)
 			resourceConfig := cloud.ResourceConfig{
 				DiscoveryJobID: discoveryID,
 				ClientID:       clientID,
@@ -127,6 +130,8 @@ func RunRetrieval(cfg aws.Config, discoveryRepo DiscoveryRepository, configRepo
 				Provider:       "AWS",
 				ResourceType:   resourceName,
 				ResourceID:     resourceID,
+				Region:         region,
+				Tags:           tags,
 				Config:         config,
 			}
 			resourceConfigs = append(resourceConfigs, resourceConfig)
@@ -159,12 +164,12 @@ func RunRetrieval(cfg aws.Config, discoveryRepo DiscoveryRepository, configRepo
 	// 	log.Info().Str("discoveryID", discoveryID.Hex()).Int("inserted", len(result)).Msg("Configurations inserted successfully")
 
 	if len(resourceConfigs) > 0 {
-		result, err := configRepo.InsertMany(resourceConfigs)
+		written, err := configRepo.UpsertMany(resourceConfigs)
 		if err != nil {
-			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Msg("Failed to insert resource configs")
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Msg("Failed to upsert resource configs")
 			return fmt.Errorf("RunRetrival: %w", err)
 		}
-		log.Info().Str("discoveryID", discoveryID.Hex()).Int("inserted", len(result)).Msg("Configurations inserted successfully")
+		log.Info().Str("discoveryID", discoveryID.Hex()).Int64("written", written).Msg("Configurations upserted successfully")
 	} else {
 		log.Warn().Str("discoveryID", discoveryID.Hex()).Msg("No configurations retrieved for any resources")
 	}
@@ -42,6 +42,11 @@ func (m *MockDiscoveryRepository) UpdateStatus(id bson.ObjectID, status string)
 	return args.Error(0)
 }
 
+func (m *MockDiscoveryRepository) CompleteJob(id bson.ObjectID, handoff cloud.Handoff) error {
+	args := m.Called(id, handoff)
+	return args.Error(0)
+}
+
 type MockConfigRepository struct {
 	mock.Mock
 }
@@ -56,6 +61,11 @@ func (m *MockConfigRepository) InsertMany(resourceConfigs []interface{}) ([]inte
 	return args.Get(0).([]interface{}), args.Error(1)
 }
 
+func (m *MockConfigRepository) UpsertMany(resourceConfigs []cloud.ResourceConfig) (int64, error) {
+	args := m.Called(resourceConfigs)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockConfigRepository) FindByDiscoveryID(discoveryJobID bson.ObjectID) ([]cloud.ResourceConfig, error) {
 	args := m.Called(discoveryJobID)
 	return args.Get(0).([]cloud.ResourceConfig), args.Error(1)
@@ -96,13 +106,13 @@ func TestRunDiscovery(t *testing.T) {
 
 	mockDiscoveryRepo.On("Create", mock.Anything, mock.Anything).Return(jobID, nil)
 	mockDiscoveryRepo.On("UpdateJob", jobID, "s3", mock.Anything).Return(nil)
-	mockDiscoveryRepo.On("UpdateStatus", jobID, "completed").Return(nil)
+	mockDiscoveryRepo.On("CompleteJob", jobID, mock.Anything).Return(nil)
 
 	mockResource.On("Discover", cfg).Return([]string{"resource1", "resource2"}, nil)
 	mockResource.On("Name").Return("s3")
 
 	// Call RunDiscovery
-	returnedJobID, err := awscloud.RunDiscovery(cfg, mockDiscoveryRepo, "1", "123", []awscloud.ResourceDiscovery{mockResource})
+	returnedJobID, err := awscloud.RunDiscovery(cfg, mockDiscoveryRepo, "1", "123", []awscloud.ResourceDiscovery{mockResource}, nil)
 
 	// Assertions
 	assert.NoError(t, err)
@@ -134,7 +144,9 @@ func TestRetrival(t *testing.T) {
 
 	mockDiscoveryRepo.On("FindByID", jobID).Return(discoveryJob, nil)
 	mockResource.On("RetrieveConfig", cfg, []string{"resource1", "resource2"}).Return(resourceConfigs, nil)
-	mockConfigRepo.On("InsertMany", mock.Anything).Return([]interface{}{"inserted1", "inserted2"}, nil)
+	mockConfigRepo.On("UpsertMany", mock.MatchedBy(func(configs []cloud.ResourceConfig) bool {
+		return len(configs) == 2
+	})).Return(int64(2), nil)
 
 	mockResource.On("Name").Return("s3")
 
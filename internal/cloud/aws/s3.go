@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/smithy-go"
@@ -57,6 +58,9 @@ func (d *S3Service) RetrieveConfig(cfg aws.Config, bucketNames []string) (map[st
 		}
 
 		log.Info().Str("bucket name", bucket).Msg("Retrieving config for bucket")
+		retrieveBucketMetadata(client, bucket, configs[bucket])
+		retrieveBucketLogging(client, bucket, configs[bucket])
+
 		output, err := client.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{
 			Bucket: aws.String(bucket),
 		})
@@ -90,3 +94,57 @@ func (d *S3Service) RetrieveConfig(cfg aws.Config, bucketNames []string) (map[st
 
 	return configs, nil
 }
+
+// retrieveBucketMetadata adds the bucket's region and tags to its config. Either is left out when
+// it cannot be read; the bucket policy is still evaluated.
+func retrieveBucketMetadata(client *s3.Client, bucket string, config map[string]interface{}) {
+	location, err := client.GetBucketLocation(context.TODO(), &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("bucket name", bucket).Msg("Error retrieving bucket location")
+	} else {
+		// buckets in us-east-1 have no location constraint
+		region := string(location.LocationConstraint)
+		if region == "" {
+			region = "us-east-1"
+		}
+		config[cloud.RegionConfigKey] = region
+	}
+
+	tagging, err := client.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		// buckets without tags return NoSuchTagSet
+		log.Info().Err(err).Str("bucket name", bucket).Msg("No bucket tags found")
+		return
+	}
+
+	tags := make(map[string]string, len(tagging.TagSet))
+	for _, tag := range tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	config[cloud.TagsConfigKey] = tags
+}
+
+// retrieveBucketLogging adds the bucket's server access logging target to its config as logging,
+// {"target_bucket": ..., "target_prefix": ...}, or "" when access logging is disabled.
+func retrieveBucketLogging(client *s3.Client, bucket string, config map[string]interface{}) {
+	output, err := client.GetBucketLogging(context.TODO(), &s3.GetBucketLoggingInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("bucket name", bucket).Msg("Error retrieving bucket logging")
+		return
+	}
+
+	if output.LoggingEnabled == nil {
+		config["logging"] = ""
+		return
+	}
+	config["logging"] = map[string]interface{}{
+		"target_bucket": aws.ToString(output.LoggingEnabled.TargetBucket),
+		"target_prefix": aws.ToString(output.LoggingEnabled.TargetPrefix),
+	}
+}
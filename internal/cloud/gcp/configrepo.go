@@ -16,6 +16,7 @@ import (
 type ConfigRepository interface {
 	Create(job *ConfigRepository) error
 	InsertMany(resourceConfigs []interface{}) ([]interface{}, error)
+	UpsertMany(resourceConfigs []cloud.ResourceConfig) (int64, error)
 	FindByDiscoveryID(discoveryJobID bson.ObjectID) ([]cloud.ResourceConfig, error)
 	FindByTypeAndJobID(resourceType string, discoveryJobID bson.ObjectID) ([]cloud.ResourceConfig, error)
 	// FindByID(id bson.ObjectID) (*DiscoveryJob, error)
@@ -25,7 +26,7 @@ type ConfigRepository interface {
 }
 
 type configRepository struct {
-	collection *mongo.Collection
+	db database.Service
 }
 
 func (r *configRepository) Create(job *ConfigRepository) error {
@@ -33,22 +34,26 @@ func (r *configRepository) Create(job *ConfigRepository) error {
 	defer cancel()
 	//snapshot.ID := bson.NewObjectID()
 
-	_, err := r.collection.InsertOne(ctx, job)
+	_, err := r.collection().InsertOne(ctx, job)
 	return err
 }
 
 func NewConfigRepository(db database.Service) ConfigRepository {
 	return &configRepository{
-		collection: db.GetCollection("gcp_config"),
+		db: db,
 	}
 }
 
+func (r *configRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("gcp_config")
+}
+
 func (r *configRepository) InsertMany(resourceConfigs []interface{}) ([]interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Insert the documents into the MongoDB collection
-	insertResult, err := r.collection.InsertMany(ctx, resourceConfigs)
+	insertResult, err := r.collection().InsertMany(ctx, resourceConfigs)
 	if err != nil {
 		log.Error().Err(err).Str("function", "InsertMany").Msg("Failed to insert resource configurations")
 		return nil, fmt.Errorf("failed to insert resource configurations: %w", err)
@@ -62,6 +67,36 @@ func (r *configRepository) InsertMany(resourceConfigs []interface{}) ([]interfac
 	return insertResult.InsertedIDs, nil
 }
 
+// UpsertMany writes resource configurations keyed on (discovery job, resource type, resource id),
+// so retrieving the same job more than once replaces the previous copy instead of duplicating it.
+func (r *configRepository) UpsertMany(resourceConfigs []cloud.ResourceConfig) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(resourceConfigs))
+	for _, config := range resourceConfigs {
+		filter := bson.M{
+			"discovery_job_id": config.DiscoveryJobID,
+			"resource_type":    config.ResourceType,
+			"resource_id":      config.ResourceID,
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(config).SetUpsert(true))
+	}
+
+	result, err := r.collection().BulkWrite(ctx, models)
+	if err != nil {
+		log.Error().Err(err).Str("function", "UpsertMany").Msg("Failed to upsert resource configurations")
+		return 0, fmt.Errorf("failed to upsert resource configurations: %w", err)
+	}
+
+	log.Info().Str("function", "UpsertMany").
+		Int64("upsertedCount", result.UpsertedCount).
+		Int64("modifiedCount", result.ModifiedCount).
+		Msg("Resource configurations upserted successfully")
+
+	return result.UpsertedCount + result.MatchedCount, nil
+}
+
 func (r *configRepository) FindByDiscoveryID(discoveryJobID bson.ObjectID) ([]cloud.ResourceConfig, error) {
 
 	// Create a filter to match the discoveryJobID field
@@ -70,7 +105,7 @@ func (r *configRepository) FindByDiscoveryID(discoveryJobID bson.ObjectID) ([]cl
 	}
 
 	// Find the documents that match the filter
-	cursor, err := r.collection.Find(context.Background(), filter)
+	cursor, err := r.collection().Find(context.Background(), filter)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +135,7 @@ func (r *configRepository) FindByTypeAndJobID(resourceType string, discoveryJobI
 	}
 
 	// Use Find to get matching documents
-	cursor, err := r.collection.Find(context.Background(), filter)
+	cursor, err := r.collection().Find(context.Background(), filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find documents: %v", err)
 	}
@@ -23,24 +23,29 @@ type DiscoveryRepository interface {
 	UpdateResources(id bson.ObjectID, resources map[string][]string) error
 	UpdateJob(id bson.ObjectID, resourceName string, resourceData []string) error
 	UpdateStatus(id bson.ObjectID, status string) error
+	CompleteJob(id bson.ObjectID, handoff cloud.Handoff) error
 }
 
 type discoveryRepository struct {
-	collection *mongo.Collection
+	db database.Service
 }
 
 func NewDiscoveryRepository(db database.Service) DiscoveryRepository {
 	return &discoveryRepository{
-		collection: db.GetCollection("gcp_discovery"),
+		db: db,
 	}
 }
 
+func (r *discoveryRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("gcp_discovery")
+}
+
 func (r *discoveryRepository) Create(job *cloud.DiscoveryJob) (bson.ObjectID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	job.ID = bson.NewObjectID()
 
-	result, err := r.collection.InsertOne(ctx, job)
+	result, err := r.collection().InsertOne(ctx, job)
 	if err != nil {
 		log.Error().Err(err).Str("function", "Create").Str("jobID", job.ID.Hex()).Msg("Failed to create new discovery job")
 		return bson.NilObjectID, fmt.Errorf("failed to insert ObjectID %s: %w", job.ID.Hex(), err)
@@ -61,7 +66,7 @@ func (r *discoveryRepository) FindByID(id bson.ObjectID) (*cloud.DiscoveryJob, e
 	defer cancel()
 
 	var job cloud.DiscoveryJob
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	err := r.collection().FindOne(ctx, bson.M{"_id": id}).Decode(&job)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			log.Error().Err(err).Str("function", "FindByID").Str("jobID", id.Hex()).Msg("Discovery job not found")
@@ -80,7 +85,7 @@ func (r *discoveryRepository) UpdateResources(id bson.ObjectID, resources map[st
 	defer cancel()
 
 	update := bson.M{"$set": bson.M{"resources": resources}}
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		log.Error().Err(err).Str("function", "UpdateResources").Str("jobID", id.Hex()).Msg("Failed to update resources for discovery job")
 		return fmt.Errorf("failed to update resources for discovery job with ID %s: %w", id.Hex(), err)
@@ -110,7 +115,7 @@ func (r *discoveryRepository) UpdateJob(id bson.ObjectID, resourceName string, r
 
 	log.Debug().Str("function", "UpdateJob").Str("jobID", id.Hex()).Str("resourceName", resourceName).Msg("Updating job with new resources")
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		log.Error().Err(err).Str("function", "UpdateJob").Str("jobID", id.Hex()).Str("resourceName", resourceName).Msg("Failed to update job")
 		return fmt.Errorf("failed to update resources for discovery job with ID %s: %w", id.Hex(), err)
@@ -136,7 +141,7 @@ func (r *discoveryRepository) UpdateStatus(id bson.ObjectID, status string) erro
 
 	log.Debug().Str("function", "UpdateStatus").Str("jobID", id.Hex()).Str("status", status).Msg("Updating job status")
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		log.Error().Err(err).Str("function", "UpdateStatus").Str("jobID", id.Hex()).Str("status", status).Msg("Failed to update job status")
 		return fmt.Errorf("failed to update status with ID %s: %w", id.Hex(), err)
@@ -152,3 +157,32 @@ func (r *discoveryRepository) UpdateStatus(id bson.ObjectID, status string) erro
 	log.Info().Str("function", "UpdateStatus").Str("jobID", id.Hex()).Str("status", status).Msg("Job status updated successfully")
 	return nil
 }
+
+// CompleteJob marks the job completed and runs handoff in the same transaction, so a completed job
+// always has its next-stage message recorded.
+func (r *discoveryRepository) CompleteJob(id bson.ObjectID, handoff cloud.Handoff) error {
+	err := database.WithTransaction(r.collection().Database().Client(), func(ctx context.Context) error {
+		update := bson.M{"$set": bson.M{"status": CompletedStatus}}
+
+		result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
+		if err != nil {
+			return fmt.Errorf("failed to update status with ID %s: %w", id.Hex(), err)
+		}
+
+		if result.MatchedCount == 0 {
+			return ErrJobNotFound
+		}
+
+		if handoff == nil {
+			return nil
+		}
+		return handoff(ctx, id)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("function", "CompleteJob").Str("jobID", id.Hex()).Msg("Failed to complete discovery job")
+		return err
+	}
+
+	log.Info().Str("function", "CompleteJob").Str("jobID", id.Hex()).Msg("Discovery job completed successfully")
+	return nil
+}
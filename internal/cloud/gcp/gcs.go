@@ -2,9 +2,11 @@ package gcpcloud
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/iterator"
 )
@@ -90,6 +92,10 @@ func (s *GcsService) RetrieveConfig(bucketNames []string) (map[string]map[string
 		}
 
 		configs[bucket]["bucket_metadata"] = metadata
+		configs[bucket][cloud.RegionConfigKey] = strings.ToLower(metadata.Location)
+		if len(metadata.Labels) > 0 {
+			configs[bucket][cloud.TagsConfigKey] = metadata.Labels
+		}
 
 	}
 
@@ -37,7 +37,9 @@ func NewDiscoveryJob() *cloud.DiscoveryJob {
 	}
 }
 
-func RunDiscovery(discoveryRepo DiscoveryRepository, clientID string, accountID string, resources []ResourceDiscovery) (bson.ObjectID, error) {
+// RunDiscovery discovers every resource type for the project and completes the job. handoff, if not nil,
+// runs in the same transaction that marks the job completed.
+func RunDiscovery(discoveryRepo DiscoveryRepository, clientID string, accountID string, resources []ResourceDiscovery, handoff cloud.Handoff) (bson.ObjectID, error) {
 	log.Info().Str("client id", clientID).Str("account id", accountID).Msg("Starting discovery process for gcp...")
 
 	job := NewDiscoveryJob()
@@ -70,7 +72,7 @@ func RunDiscovery(discoveryRepo DiscoveryRepository, clientID string, accountID
 
 	}
 
-	err = discoveryRepo.UpdateStatus(jobID, CompletedStatus)
+	err = discoveryRepo.CompleteJob(jobID, handoff)
 	if err != nil {
 		log.Error().Err(err).Str("client id", clientID).Str("account id", accountID).Str("function", "RunDiscovery").Str("jobID", jobID.Hex()).Msg("Failed to update job status to complete")
 		return bson.NilObjectID, fmt.Errorf("RunDiscovery: %w", err)
@@ -89,7 +91,7 @@ func RunRetrival(discoveryRepo DiscoveryRepository, configRepo ConfigRepository,
 		return fmt.Errorf("retrival: %w", err)
 	}
 
-	var resourceConfigs []interface{}
+	var resourceConfigs []cloud.ResourceConfig
 
 	for _, resource := range resources {
 		resourceName := resource.Name()
@@ -112,6 +114,7 @@ func RunRetrival(discoveryRepo DiscoveryRepository, configRepo ConfigRepository,
 		discoveryIDbson := bson.ObjectID(discoveryID)
 
 		for resourceID, config := range configs {
+			region, tags := cloud.TakeResourceMetadata(config)
 			resourceConfig := cloud.ResourceConfig{
 				DiscoveryJobID: discoveryIDbson,
 				ClientID:       clientID,
@@ -119,6 +122,8 @@ func RunRetrival(discoveryRepo DiscoveryRepository, configRepo ConfigRepository,
 				Provider:       "GCP",
 				ResourceType:   resourceName,
 				ResourceID:     resourceID,
+				Region:         region,
+				Tags:           tags,
 				Config:         config,
 			}
 			resourceConfigs = append(resourceConfigs, resourceConfig)
@@ -151,12 +156,12 @@ func RunRetrival(discoveryRepo DiscoveryRepository, configRepo ConfigRepository,
 	// 	log.Info().Str("discoveryID", discoveryID.Hex()).Int("inserted", len(result)).Msg("Configurations inserted successfully")
 
 	if len(resourceConfigs) > 0 {
-		result, err := configRepo.InsertMany(resourceConfigs)
+		written, err := configRepo.UpsertMany(resourceConfigs)
 		if err != nil {
-			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Msg("Failed to insert resource configs")
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Msg("Failed to upsert resource configs")
 			return fmt.Errorf("RunRetrival: %w", err)
 		}
-		log.Info().Str("discoveryID", discoveryID.Hex()).Int("inserted", len(result)).Msg("Configurations inserted successfully")
+		log.Info().Str("discoveryID", discoveryID.Hex()).Int64("written", written).Msg("Configurations upserted successfully")
 	} else {
 		log.Warn().Str("discoveryID", discoveryID.Hex()).Msg("No configurations retrieved for any resources")
 	}
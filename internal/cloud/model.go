@@ -1,9 +1,15 @@
 package cloud
 
 import (
+	"context"
+
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// Handoff writes the next-stage message for a job. It runs inside the transaction that marks the
+// current stage completed, so ctx must be used for every write it makes.
+type Handoff func(ctx context.Context, jobID bson.ObjectID) error
+
 type DiscoveryJob struct {
 	ID        bson.ObjectID       `bson:"_id,omitempty"` // Unique identifier
 	ClientID  string              `bson:"client_id"`     // internal client ID
@@ -39,9 +45,27 @@ type ResourceConfig struct {
 	Provider       string                 `bson:"provider"`         // Cloud Provider
 	ResourceType   string                 `bson:"resource_type"`    // e.g., "s3", "ec2", "rds", "gcs"
 	ResourceID     string                 `bson:"resource_id"`      // e.g., S3 bucket name, EC2 instance ARN
+	Region         string                 `bson:"region,omitempty"` // AWS region or GCP location, empty when unknown
+	Tags           map[string]string      `bson:"tags,omitempty"`   // AWS tags or GCP labels
 	Config         map[string]interface{} `bson:"config"`           // The actual configuration (could be S3 policy, EC2 security groups, etc.)
 }
 
+// Keys under which RetrieveConfig implementations return the region and tags of a resource.
+// TakeResourceMetadata moves them from the config into ResourceConfig.Region and Tags.
+const (
+	RegionConfigKey = "region"
+	TagsConfigKey   = "tags"
+)
+
+// TakeResourceMetadata removes the region and tags from a retrieved config and returns them.
+func TakeResourceMetadata(config map[string]interface{}) (string, map[string]string) {
+	region, _ := config[RegionConfigKey].(string)
+	tags, _ := config[TagsConfigKey].(map[string]string)
+	delete(config, RegionConfigKey)
+	delete(config, TagsConfigKey)
+	return region, tags
+}
+
 type BucketConfig struct {
 	BucketPolicy string `json:"policy"`
 }
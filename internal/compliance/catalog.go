@@ -0,0 +1,89 @@
+package compliance
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+)
+
+// frameworkFiles is the framework catalog, one JSON file per framework.
+//
+//go:embed frameworks
+var frameworkFiles embed.FS
+
+// DefaultCatalog returns the frameworks built into the binary.
+func DefaultCatalog() ([]Framework, error) {
+	tree, err := fs.Sub(frameworkFiles, "frameworks")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded frameworks: %w", err)
+	}
+	return LoadCatalog(tree)
+}
+
+// LoadCatalog reads every .json framework of a catalog tree, ordered by ID.
+func LoadCatalog(tree fs.FS) ([]Framework, error) {
+	var frameworks []Framework
+
+	err := fs.WalkDir(tree, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(filePath) != ".json" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(tree, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		var framework Framework
+		if err := json.Unmarshal(data, &framework); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+		if framework.ID == "" {
+			return fmt.Errorf("%s: framework has no id", filePath)
+		}
+		frameworks = append(frameworks, framework)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load framework catalog: %w", err)
+	}
+
+	sort.Slice(frameworks, func(i, j int) bool { return frameworks[i].ID < frameworks[j].ID })
+	return frameworks, nil
+}
+
+// WithRuleBenchmarks adds the rules whose annotations name a control, through custom.benchmarks, to
+// that control. The catalog and the annotations can then each map part of a framework. Controls
+// the catalog does not list are ignored.
+func WithRuleBenchmarks(frameworks []Framework, policies []opa2.RegoPolicy) []Framework {
+	merged := make([]Framework, len(frameworks))
+	for i, framework := range frameworks {
+		framework.Controls = slices.Clone(framework.Controls)
+		for j := range framework.Controls {
+			control := &framework.Controls[j]
+			control.RuleIDs = slices.Clone(control.RuleIDs)
+
+			for _, policy := range policies {
+				for _, rule := range policy.Rules {
+					for _, benchmark := range rule.Benchmarks {
+						if benchmark.Framework == framework.ID && benchmark.Control == control.ID && !slices.Contains(control.RuleIDs, rule.RuleID) {
+							control.RuleIDs = append(control.RuleIDs, rule.RuleID)
+						}
+					}
+				}
+			}
+			sort.Strings(control.RuleIDs)
+		}
+		merged[i] = framework
+	}
+	return merged
+}
@@ -0,0 +1,58 @@
+package compliance_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/compliance"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDefaultCatalogMatchesEmbeddedPolicies keeps the catalog and the policies/ tree in step: a
+// rule ID no policy reports, or a framework none of whose controls has a rule, would score every
+// account as not evaluated.
+func TestDefaultCatalogMatchesEmbeddedPolicies(t *testing.T) {
+	catalog, err := compliance.DefaultCatalog()
+	require.NoError(t, err)
+
+	files, err := opa2.EmbeddedPolicies()
+	require.NoError(t, err)
+	var policies []opa2.RegoPolicy
+	reported := make(map[string]bool)
+	for _, file := range files {
+		require.NoError(t, file.Err, file.Path)
+		policies = append(policies, file.Policy)
+		for _, rule := range file.Policy.Rules {
+			reported[rule.RuleID] = true
+		}
+	}
+
+	controls := make(map[string]bool)
+	for _, framework := range catalog {
+		for _, control := range framework.Controls {
+			controls[framework.ID+" "+control.ID] = true
+			for _, ruleID := range control.RuleIDs {
+				assert.True(t, reported[ruleID], "%s %s: no embedded policy reports %s", framework.ID, control.ID, ruleID)
+			}
+		}
+	}
+
+	for _, policy := range policies {
+		for _, rule := range policy.Rules {
+			for _, benchmark := range rule.Benchmarks {
+				assert.True(t, controls[benchmark.Framework+" "+benchmark.Control], "%s %s: control %s %s is not in the catalog", policy.Name, rule.RuleID, benchmark.Framework, benchmark.Control)
+			}
+		}
+	}
+
+	for _, framework := range compliance.WithRuleBenchmarks(catalog, policies) {
+		mapped := 0
+		for _, control := range framework.Controls {
+			if len(control.RuleIDs) > 0 {
+				mapped++
+			}
+		}
+		assert.NotZero(t, mapped, "%s: no control is mapped to a rule", framework.ID)
+	}
+}
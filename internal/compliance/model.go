@@ -0,0 +1,59 @@
+package compliance
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Framework is a compliance standard, e.g. CIS AWS Foundations, and the rules that check each of
+// its controls.
+type Framework struct {
+	ID       string    `json:"id"` // e.g. "cis-aws-3.0", matches the framework of rule annotations
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Provider string    `json:"provider"` // "AWS" or "GCP", the accounts the framework is scored for
+	Controls []Control `json:"controls"`
+}
+
+// Control is one requirement of a framework. A control without rule IDs is never evaluated.
+type Control struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	RuleIDs []string `json:"rule_ids,omitempty"`
+}
+
+type ControlStatus string
+
+const (
+	ControlPassed       ControlStatus = "passed"        // its rules evaluated resources and reported nothing
+	ControlFailed       ControlStatus = "failed"        // at least one of its rules reported a finding
+	ControlNotEvaluated ControlStatus = "not-evaluated" // no rule of the control evaluated any resource
+)
+
+// ControlResult is the status of one control in one scan.
+type ControlResult struct {
+	ControlID       string        `bson:"control_id" json:"control_id"`
+	Title           string        `bson:"title" json:"title"`
+	Status          ControlStatus `bson:"status" json:"status"`
+	RuleIDs         []string      `bson:"rule_ids,omitempty" json:"rule_ids,omitempty"`
+	FailedResources []string      `bson:"failed_resources,omitempty" json:"failed_resources,omitempty"` // "<type>/<id>"
+}
+
+// Score is the compliance of one account with one framework after one scan. Scores are kept for
+// every scan so that progress can be shown over time.
+type Score struct {
+	ID               bson.ObjectID   `bson:"_id,omitempty" json:"id"`
+	DiscoveryJobID   bson.ObjectID   `bson:"discovery_job_id" json:"discovery_job_id"`
+	ClientID         string          `bson:"client_id" json:"client_id"`
+	AccountID        string          `bson:"account_id" json:"account_id"`
+	Provider         string          `bson:"provider" json:"provider"`
+	FrameworkID      string          `bson:"framework_id" json:"framework_id"`
+	FrameworkVersion string          `bson:"framework_version" json:"framework_version"`
+	Passed           int             `bson:"passed" json:"passed"`
+	Failed           int             `bson:"failed" json:"failed"`
+	NotEvaluated     int             `bson:"not_evaluated" json:"not_evaluated"`
+	Percent          float64         `bson:"percent" json:"percent"` // passed out of passed and failed controls, 0 when none was evaluated
+	Controls         []ControlResult `bson:"controls" json:"controls"`
+	ScannedAt        time.Time       `bson:"scanned_at" json:"scanned_at"`
+}
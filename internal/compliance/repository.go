@@ -0,0 +1,94 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Repository stores the compliance score of every scan, per account and framework.
+type Repository interface {
+	UpsertMany(scores []Score) error
+	History(clientID string, accountID string, frameworkID string, limit int64) ([]Score, error)
+}
+
+type repository struct {
+	db database.Service
+}
+
+func NewRepository(db database.Service) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) collection() *mongo.Collection {
+	return r.db.GetCollection("compliance_score")
+}
+
+// UpsertMany writes scores keyed on (discovery job, framework), so scoring a redelivered scan
+// replaces the earlier score instead of adding a second point to the history.
+func (r *repository) UpsertMany(scores []Score) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(scores))
+	for _, score := range scores {
+		filter := bson.M{
+			"discovery_job_id": score.DiscoveryJobID,
+			"framework_id":     score.FrameworkID,
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(score).SetUpsert(true))
+	}
+
+	if _, err := r.collection().BulkWrite(ctx, models); err != nil {
+		log.Error().Err(err).Str("function", "UpsertMany").Msg("Failed to upsert compliance scores")
+		return fmt.Errorf("failed to upsert compliance scores: %w", err)
+	}
+
+	log.Info().Str("function", "UpsertMany").Int("scores", len(scores)).Msg("Compliance scores upserted successfully")
+	return nil
+}
+
+// History returns the scores of an account for a framework, newest first. A limit of 0 returns
+// every score.
+func (r *repository) History(clientID string, accountID string, frameworkID string, limit int64) ([]Score, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"client_id":    clientID,
+		"account_id":   accountID,
+		"framework_id": frameworkID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "scanned_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "History").Str("accountID", accountID).Str("frameworkID", frameworkID).Msg("Failed to find compliance scores")
+		return nil, fmt.Errorf("failed to find compliance scores for account %s: %w", accountID, err)
+	}
+	defer cursor.Close(ctx)
+
+	var scores []Score
+	if err := cursor.All(ctx, &scores); err != nil {
+		log.Error().Err(err).Str("function", "History").Str("accountID", accountID).Msg("Failed to decode compliance scores")
+		return nil, fmt.Errorf("failed to decode compliance scores: %w", err)
+	}
+
+	return scores, nil
+}
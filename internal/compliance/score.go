@@ -0,0 +1,94 @@
+package compliance
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ScoreScan scores the results of one scan against every framework of the scan's provider. A
+// control fails when any resource has a finding of one of its rules, passes when its rules checked
+// at least one resource and found nothing, and is not evaluated otherwise, e.g. when no policy
+// implements it or every evaluation errored.
+func ScoreScan(frameworks []Framework, discoveryJobID bson.ObjectID, clientID string, accountID string, provider string, results []opa2.ScanResult) []Score {
+	checked := make(map[string]bool)
+	failing := make(map[string][]string)
+	for _, result := range results {
+		for _, ruleID := range result.CheckedRules {
+			checked[ruleID] = true
+		}
+		resource := result.ResourceType + "/" + result.ResourceID
+		for _, finding := range result.Findings {
+			if finding.RuleID != "" && !slices.Contains(failing[finding.RuleID], resource) {
+				failing[finding.RuleID] = append(failing[finding.RuleID], resource)
+			}
+		}
+	}
+
+	scannedAt := time.Now()
+	var scores []Score
+	for _, framework := range frameworks {
+		if framework.Provider != provider {
+			continue
+		}
+
+		score := Score{
+			DiscoveryJobID:   discoveryJobID,
+			ClientID:         clientID,
+			AccountID:        accountID,
+			Provider:         provider,
+			FrameworkID:      framework.ID,
+			FrameworkVersion: framework.Version,
+			ScannedAt:        scannedAt,
+		}
+
+		for _, control := range framework.Controls {
+			result := scoreControl(control, checked, failing)
+			switch result.Status {
+			case ControlPassed:
+				score.Passed++
+			case ControlFailed:
+				score.Failed++
+			default:
+				score.NotEvaluated++
+			}
+			score.Controls = append(score.Controls, result)
+		}
+
+		if evaluated := score.Passed + score.Failed; evaluated > 0 {
+			score.Percent = 100 * float64(score.Passed) / float64(evaluated)
+		}
+		scores = append(scores, score)
+	}
+
+	return scores
+}
+
+func scoreControl(control Control, checked map[string]bool, failing map[string][]string) ControlResult {
+	result := ControlResult{
+		ControlID: control.ID,
+		Title:     control.Title,
+		Status:    ControlNotEvaluated,
+		RuleIDs:   control.RuleIDs,
+	}
+
+	for _, ruleID := range control.RuleIDs {
+		for _, resource := range failing[ruleID] {
+			if !slices.Contains(result.FailedResources, resource) {
+				result.FailedResources = append(result.FailedResources, resource)
+			}
+		}
+		if checked[ruleID] && result.Status == ControlNotEvaluated {
+			result.Status = ControlPassed
+		}
+	}
+
+	if len(result.FailedResources) > 0 {
+		result.Status = ControlFailed
+		sort.Strings(result.FailedResources)
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package compliance_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/compliance"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestScoreScan(t *testing.T) {
+	frameworks := []compliance.Framework{
+		{
+			ID:       "cis-aws-3.0",
+			Version:  "3.0.0",
+			Provider: "AWS",
+			Controls: []compliance.Control{
+				{ID: "2.1.1", RuleIDs: []string{"AWS-S3-103"}},
+				{ID: "2.1.4", RuleIDs: []string{"AWS-S3-001"}},
+				{ID: "2.1.2"},
+				{ID: "3.1", RuleIDs: []string{"AWS-CT-001"}},
+			},
+		},
+		{ID: "cis-gcp-2.0", Provider: "GCP", Controls: []compliance.Control{{ID: "5.1"}}},
+	}
+	policies := []opa2.RegoPolicy{{Rules: []opa2.RuleMetadata{
+		{RuleID: "AWS-S3-003", Benchmarks: []opa2.BenchmarkControl{{Framework: "cis-aws-3.0", Control: "2.1.4"}}},
+	}}}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "reports", CheckedRules: []string{"AWS-S3-001", "AWS-S3-003", "AWS-S3-103"}},
+		{
+			ResourceType: "s3",
+			ResourceID:   "public",
+			CheckedRules: []string{"AWS-S3-001", "AWS-S3-003", "AWS-S3-103"},
+			Findings:     []opa2.Finding{{RuleID: "AWS-S3-003"}},
+		},
+	}
+	jobID := bson.NewObjectID()
+
+	scores := compliance.ScoreScan(compliance.WithRuleBenchmarks(frameworks, policies), jobID, "client", "123456789012", "AWS", results)
+
+	require.Len(t, scores, 1)
+	score := scores[0]
+	assert.Equal(t, jobID, score.DiscoveryJobID)
+	assert.Equal(t, "cis-aws-3.0", score.FrameworkID)
+	assert.Equal(t, 1, score.Passed)
+	assert.Equal(t, 1, score.Failed)
+	assert.Equal(t, 2, score.NotEvaluated)
+	assert.Equal(t, 50.0, score.Percent)
+
+	assert.Equal(t, compliance.ControlPassed, score.Controls[0].Status)
+	assert.Equal(t, compliance.ControlFailed, score.Controls[1].Status)
+	assert.Equal(t, []string{"AWS-S3-001", "AWS-S3-003"}, score.Controls[1].RuleIDs)
+	assert.Equal(t, []string{"s3/public"}, score.Controls[1].FailedResources)
+	assert.Equal(t, compliance.ControlNotEvaluated, score.Controls[2].Status)
+	assert.Equal(t, compliance.ControlNotEvaluated, score.Controls[3].Status)
+
+	// the catalog passed in is left untouched
+	assert.Equal(t, []string{"AWS-S3-001"}, frameworks[0].Controls[1].RuleIDs)
+}
+
+func TestDefaultCatalogReferencesKnownRules(t *testing.T) {
+	frameworks, err := compliance.DefaultCatalog()
+	require.NoError(t, err)
+	require.NotEmpty(t, frameworks)
+
+	files, err := opa2.EmbeddedPolicies()
+	require.NoError(t, err)
+	known := make(map[string]bool)
+	for _, file := range files {
+		for _, rule := range file.Policy.Rules {
+			known[rule.RuleID] = true
+		}
+	}
+
+	for _, framework := range frameworks {
+		assert.Contains(t, []string{"AWS", "GCP"}, framework.Provider, framework.ID)
+		for _, control := range framework.Controls {
+			for _, ruleID := range control.RuleIDs {
+				assert.True(t, known[ruleID], "%s %s maps unknown rule %s", framework.ID, control.ID, ruleID)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
+)
+
+// Keys of the settings a Config is built from. A key is also the field name used in a config file.
+const (
+	ProcessingRole    = "processing_role"
+	MongoURI          = "mongo_uri"
+	MongoDatabase     = "mongo_database"
+	RetrievalQueueURL = "retrieval_queue_url"
+	ScanQueueURL      = "scan_queue_url"
+	SMTPHost          = "smtp_host"
+	SMTPPort          = "smtp_port"
+	SMTPUser          = "smtp_user"
+	SMTPPassword      = "smtp_password"
+)
+
+type Config struct {
+	ProcessingRole    string // ARN of the Woz role that is allowed to assume client roles
+	Mongo             MongoConfig
+	RetrievalQueueURL string
+	ScanQueueURL      string
+	SMTP              SMTPConfig
+}
+
+type MongoConfig struct {
+	URI       string
+	URISecret *secrets.Secret // set when URI came from a secret file, SSM or Secrets Manager, to re-read it after rotation
+	Database  string
+}
+
+type SMTPConfig struct {
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	PasswordSecret *secrets.Secret // set when Password came from SSM or Secrets Manager
+}
+
+// Setting describes where a single value can come from. Env is the environment variable holding the
+// value itself and the name of its secret file; Env+"_PARAM" names an SSM parameter and
+// Env+"_SECRET" a Secrets Manager secret.
+type Setting struct {
+	Key    string
+	Env    string
+	Secure bool // never printed, and kept as a rotatable secret when read from a secret file, SSM or Secrets Manager
+}
+
+type setting struct {
+	Setting
+	field    func(c *Config) *string
+	validate func(value string) error
+	secret   func(c *Config) **secrets.Secret
+}
+
+var settings = []setting{
+	{Setting{ProcessingRole, "PROCESSING_ROLE", false}, func(c *Config) *string { return &c.ProcessingRole }, validateARN, nil},
+	{Setting{MongoURI, "MONGO_DB_STRING", true}, func(c *Config) *string { return &c.Mongo.URI }, validateMongoURI, func(c *Config) **secrets.Secret { return &c.Mongo.URISecret }},
+	{Setting{MongoDatabase, "MONGO_DB_NAME", false}, func(c *Config) *string { return &c.Mongo.Database }, nil, nil},
+	{Setting{RetrievalQueueURL, "RETRIEVAL_QUEUE_URL", false}, func(c *Config) *string { return &c.RetrievalQueueURL }, validateURL, nil},
+	{Setting{ScanQueueURL, "SCAN_QUEUE_URL", false}, func(c *Config) *string { return &c.ScanQueueURL }, validateURL, nil},
+	{Setting{SMTPHost, "SMTP_HOST", false}, func(c *Config) *string { return &c.SMTP.Host }, nil, nil},
+	{Setting{SMTPPort, "SMTP_PORT", false}, func(c *Config) *string { return &c.SMTP.Port }, validatePort, nil},
+	{Setting{SMTPUser, "SMTP_USER", false}, func(c *Config) *string { return &c.SMTP.User }, nil, nil},
+	{Setting{SMTPPassword, "SMTP_PASSWORD", true}, func(c *Config) *string { return &c.SMTP.Password }, nil, func(c *Config) **secrets.Secret { return &c.SMTP.PasswordSecret }},
+}
+
+// Defaults returns the configuration every source is layered on top of.
+func Defaults() *Config {
+	return &Config{
+		Mongo: MongoConfig{
+			Database: "cs464-main",
+		},
+		SMTP: SMTPConfig{
+			Port: "587",
+		},
+	}
+}
+
+// Load layers sources over the defaults, later sources overriding earlier ones, and validates the
+// result. Every missing required key and every invalid value is reported in a single error.
+func Load(sources []Source, required ...string) (*Config, error) {
+	cfg := Defaults()
+
+	var problems []string
+	for _, source := range sources {
+		for _, s := range settings {
+			value, ok, err := source.Lookup(s.Setting)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: unable to read from %s: %v", s.Key, source.Name(), err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+
+			*s.field(cfg) = value
+			if s.secret != nil {
+				*s.secret(cfg) = nil
+				if src, isSecret := source.(secretSource); isSecret {
+					*s.secret(cfg), _ = src.secret(s.Setting)
+				}
+			}
+		}
+	}
+
+	problems = append(problems, validate(cfg, required)...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	return cfg, nil
+}
+
+func validate(cfg *Config, required []string) []string {
+	var problems []string
+
+	for _, key := range required {
+		s, ok := lookupSetting(key)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting", key))
+			continue
+		}
+		if *s.field(cfg) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required (set %s, %s_PARAM or %s_SECRET)", s.Key, s.Env, s.Env, s.Env))
+		}
+	}
+
+	for _, s := range settings {
+		value := *s.field(cfg)
+		if value == "" || s.validate == nil {
+			continue
+		}
+		if err := s.validate(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", s.Key, err))
+		}
+	}
+
+	return problems
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func validateARN(value string) error {
+	if !strings.HasPrefix(value, "arn:") {
+		return fmt.Errorf("expected an ARN, got %q", value)
+	}
+	return nil
+}
+
+func validateMongoURI(value string) error {
+	if !strings.HasPrefix(value, "mongodb://") && !strings.HasPrefix(value, "mongodb+srv://") {
+		return fmt.Errorf("expected a mongodb:// or mongodb+srv:// connection string")
+	}
+	return nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("expected a URL, got %q", value)
+	}
+	return nil
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("expected a port number, got %q", value)
+	}
+	return nil
+}
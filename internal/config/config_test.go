@@ -0,0 +1,75 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadLayersSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "woz.json")
+	err := os.WriteFile(path, []byte(`{"mongo_uri": "mongodb://file", "smtp_host": "smtp.file", "smtp_user": "file"}`), 0o600)
+	assert.NoError(t, err)
+
+	file, err := config.NewFileSource(path)
+	assert.NoError(t, err)
+
+	t.Setenv("SMTP_USER", "env")
+
+	flags := config.NewMapSource("flags", map[string]string{
+		config.MongoURI:       "mongodb://flags",
+		config.ProcessingRole: "",
+	})
+
+	cfg, err := config.Load([]config.Source{file, config.NewEnvSource(), flags}, config.MongoURI)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://flags", cfg.Mongo.URI)
+	assert.Equal(t, "smtp.file", cfg.SMTP.Host)
+	assert.Equal(t, "env", cfg.SMTP.User)
+	assert.Equal(t, "", cfg.ProcessingRole)
+	assert.Equal(t, "cs464-main", cfg.Mongo.Database)
+	assert.Equal(t, "587", cfg.SMTP.Port)
+}
+
+func TestLoadKeepsSecretFileForRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "MONGO_DB_STRING")
+	assert.NoError(t, os.WriteFile(path, []byte("mongodb://old\n"), 0o600))
+
+	t.Setenv("MONGO_DB_STRING", "mongodb://env")
+	files := config.NewSecretFileSource(secrets.NewCache(secrets.NewFile(dir), secrets.DefaultTTL))
+
+	cfg, err := config.Load([]config.Source{config.NewEnvSource(), files}, config.MongoURI)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://old", cfg.Mongo.URI)
+	if assert.NotNil(t, cfg.Mongo.URISecret) {
+		assert.NoError(t, os.WriteFile(path, []byte("mongodb://new\n"), 0o600))
+
+		uri, err := cfg.Mongo.URISecret.Refresh(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "mongodb://new", uri)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	source := config.NewMapSource("test", map[string]string{
+		config.ProcessingRole: "not-an-arn",
+		config.SMTPPort:       "99999",
+	})
+
+	cfg, err := config.Load([]config.Source{source}, config.MongoURI, config.ScanQueueURL)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "invalid configuration: "+
+		"mongo_uri is required (set MONGO_DB_STRING, MONGO_DB_STRING_PARAM or MONGO_DB_STRING_SECRET); "+
+		"scan_queue_url is required (set SCAN_QUEUE_URL, SCAN_QUEUE_URL_PARAM or SCAN_QUEUE_URL_SECRET); "+
+		`processing_role: expected an ARN, got "not-an-arn"; `+
+		`smtp_port: expected a port number, got "99999"`)
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Source provides values for settings. ok is false when the source has nothing for the setting.
+type Source interface {
+	Name() string
+	Lookup(s Setting) (value string, ok bool, err error)
+}
+
+// DefaultSources are the sources the Lambdas load from, lowest precedence first: an optional JSON
+// file named by WOZ_CONFIG_FILE, the environment, secret files under WOZ_SECRETS_DIR, SSM
+// Parameter Store and Secrets Manager. Values from the last three are cached for
+// secrets.DefaultTTL.
+func DefaultSources(awsCfg aws.Config) ([]Source, error) {
+	var sources []Source
+
+	if path := os.Getenv("WOZ_CONFIG_FILE"); path != "" {
+		file, err := NewFileSource(path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, file)
+	}
+
+	sources = append(sources, NewEnvSource())
+
+	if dir := os.Getenv("WOZ_SECRETS_DIR"); dir != "" {
+		sources = append(sources, NewSecretFileSource(secrets.NewCache(secrets.NewFile(dir), secrets.DefaultTTL)))
+	}
+
+	return append(sources,
+		NewSSMSource(secrets.NewCache(secrets.NewSSM(ssm.NewFromConfig(awsCfg)), secrets.DefaultTTL)),
+		NewSecretsManagerSource(secrets.NewCache(secrets.NewSecretsManager(secretsmanager.NewFromConfig(awsCfg)), secrets.DefaultTTL)),
+	), nil
+}
+
+type mapSource struct {
+	name   string
+	values map[string]string
+}
+
+// NewMapSource serves values keyed by setting key, e.g. from command line flags. Empty values are
+// treated as unset.
+func NewMapSource(name string, values map[string]string) Source {
+	return &mapSource{name: name, values: values}
+}
+
+func (m *mapSource) Name() string {
+	return m.name
+}
+
+func (m *mapSource) Lookup(s Setting) (string, bool, error) {
+	value := m.values[s.Key]
+	return value, value != "", nil
+}
+
+// NewFileSource reads a flat JSON object keyed by setting key.
+func NewFileSource(path string) (Source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	values := make(map[string]string)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	return NewMapSource("file "+path, values), nil
+}
+
+type envSource struct {
+	provider secrets.Provider
+}
+
+// NewEnvSource reads the setting's environment variable.
+func NewEnvSource() Source {
+	return &envSource{provider: secrets.NewEnv()}
+}
+
+func (e *envSource) Name() string {
+	return "environment"
+}
+
+func (e *envSource) Lookup(s Setting) (string, bool, error) {
+	return lookup(secrets.NewSecret(e.provider, s.Env))
+}
+
+type secretFileSource struct {
+	provider secrets.Provider
+}
+
+// NewSecretFileSource reads the file named after the setting's environment variable, e.g.
+// MONGO_DB_STRING, from a provider made with secrets.NewFile. Mounted secret volumes are updated in
+// place on rotation, so secure settings read from them are re-read like SSM parameters.
+func NewSecretFileSource(provider secrets.Provider) Source {
+	return &secretFileSource{provider: provider}
+}
+
+func (f *secretFileSource) Name() string {
+	return "secret files"
+}
+
+func (f *secretFileSource) secret(s Setting) (*secrets.Secret, bool) {
+	return secrets.NewSecret(f.provider, s.Env), true
+}
+
+func (f *secretFileSource) Lookup(s Setting) (string, bool, error) {
+	secret, _ := f.secret(s)
+	return lookup(secret)
+}
+
+// lookup reads a secret that may be absent, as an unset variable or a missing file is.
+func lookup(secret *secrets.Secret) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, err := secret.Value(ctx)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, value != "", nil
+}
+
+// secretSource is implemented by sources backed by a secrets.Provider, so that a secure setting
+// read from them can be fetched again after the secret is rotated.
+type secretSource interface {
+	secret(s Setting) (*secrets.Secret, bool)
+}
+
+type providerSource struct {
+	name     string
+	suffix   string
+	provider secrets.Provider
+}
+
+// NewSSMSource reads the SSM parameter named by the setting's <ENV>_PARAM variable.
+func NewSSMSource(provider secrets.Provider) Source {
+	return &providerSource{name: "ssm", suffix: "_PARAM", provider: provider}
+}
+
+// NewSecretsManagerSource reads the secret named by the setting's <ENV>_SECRET variable.
+func NewSecretsManagerSource(provider secrets.Provider) Source {
+	return &providerSource{name: "secrets manager", suffix: "_SECRET", provider: provider}
+}
+
+func (p *providerSource) Name() string {
+	return p.name
+}
+
+func (p *providerSource) secret(s Setting) (*secrets.Secret, bool) {
+	name := os.Getenv(s.Env + p.suffix)
+	if name == "" {
+		return nil, false
+	}
+	return secrets.NewSecret(p.provider, name), true
+}
+
+func (p *providerSource) Lookup(s Setting) (string, bool, error) {
+	secret, ok := p.secret(s)
+	if !ok {
+		return "", false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, err := secret.Value(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
@@ -2,24 +2,31 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/models"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
 
 	_ "github.com/joho/godotenv/autoload"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/auth"
 )
 
 type Service interface {
 	Health() map[string]string
 	GetCollection(name string) *mongo.Collection
 	Disconnect() error
+	WithTransaction(fn func(ctx context.Context) error) error
+	CheckTransactions() error
 
 	// UserDAL
 	CreateUser(context.Context, models.User) (bson.ObjectID, error)
@@ -32,7 +39,13 @@ type Service interface {
 }
 
 type service struct {
-	db *mongo.Client
+	mu     sync.RWMutex
+	db     *mongo.Client
+	uri    string
+	name   string
+	secret *secrets.Secret // nil when the URI is not rotatable
+
+	reconnecting atomic.Bool
 }
 
 var (
@@ -40,21 +53,36 @@ var (
 	once     sync.Once
 )
 
-func New() (Service, error) {
+// New connects to MongoDB once per process. When the URI came from a rotatable secret and the
+// cached value is rejected, the secret is re-read and the connection retried. The same happens
+// when the server later refuses new connections, see reconnect.
+func New(cfg config.MongoConfig) (Service, error) {
 
-	uri := os.Getenv("MONGO_DB_STRING")
-	if uri == "" {
-		return nil, fmt.Errorf("database URI not set in environment variables")
+	if cfg.URI == "" {
+		return nil, fmt.Errorf("database URI not set in configuration")
 	}
 
 	var err error
 	once.Do(func() { // Ensures only one instance is created
-		client, connErr := mongo.Connect(options.Client().ApplyURI(uri))
-		if connErr != nil {
-			err = fmt.Errorf("failed to connect to MongoDB: %w", connErr)
+		s := &service{name: cfg.Database, secret: cfg.URISecret}
+		if cfg.URISecret != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			err = cfg.URISecret.Use(ctx, isAuthError, func(uri string) error {
+				s.db, err = connect(uri, s.poolMonitor())
+				s.uri = uri
+				return err
+			})
+		} else {
+			s.db, err = connect(cfg.URI, nil)
+			s.uri = cfg.URI
+		}
+		if err != nil {
 			return
 		}
-		instance = &service{db: client}
+
+		instance = s
 		log.Println("Connected to MongoDB!")
 	})
 
@@ -65,11 +93,102 @@ func New() (Service, error) {
 
 }
 
+// connect pings the server so that bad credentials are reported here rather than on first use.
+func connect(uri string, monitor *event.PoolMonitor) (*mongo.Client, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(uri).SetPoolMonitor(monitor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	return client, nil
+}
+
+// poolMonitor watches for new connections failing to authenticate. Pooled connections opened before
+// the URI secret was rotated keep working, so this is where a rotation first shows.
+func (s *service) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			if e.Type == event.ConnectionCheckOutFailed && e.Error != nil && isAuthError(e.Error) {
+				go s.reconnect()
+			}
+		},
+	}
+}
+
+// reconnect re-reads the URI secret and, when it changed, replaces the client with one connected
+// with the new URI. Operations already running on the old client are given time to finish before
+// it is disconnected; repositories pick up the new client on their next operation.
+func (s *service) reconnect() {
+	if !s.reconnecting.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.reconnecting.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	uri, err := s.secret.Refresh(ctx)
+	if err != nil {
+		log.Printf("Failed to refresh MongoDB URI secret %s: %v", s.secret.Name(), err)
+		return
+	}
+
+	s.mu.RLock()
+	unchanged := uri == s.uri
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	client, err := connect(uri, s.poolMonitor())
+	if err != nil {
+		log.Printf("Failed to reconnect to MongoDB with refreshed URI: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	old := s.db
+	s.db, s.uri = client, uri
+	s.mu.Unlock()
+	log.Println("Reconnected to MongoDB with refreshed URI")
+
+	if err := old.Disconnect(ctx); err != nil {
+		log.Printf("Failed to disconnect replaced MongoDB client: %v", err)
+	}
+}
+
+func (s *service) client() *mongo.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db
+}
+
+// authenticationFailed is the server error code for rejected credentials.
+const authenticationFailed = 18
+
+func isAuthError(err error) bool {
+	var authErr *auth.Error
+	if errors.As(err, &authErr) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(authenticationFailed)
+}
+
 func (s *service) Health() map[string]string {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	err := s.db.Ping(ctx, nil)
+	err := s.client().Ping(ctx, nil)
 	if err != nil {
 		log.Printf("DB health check failed: %v", err)
 		return map[string]string{
@@ -82,15 +201,65 @@ func (s *service) Health() map[string]string {
 	}
 }
 
+// GetCollection returns a handle on the collection with the current client. Callers that hold on to
+// it keep using the client it was taken from, so repositories take it per operation.
 func (s *service) GetCollection(name string) *mongo.Collection {
-	return s.db.Database("cs464-main").Collection(name)
+	return s.client().Database(s.name).Collection(name)
+}
+
+func (s *service) WithTransaction(fn func(ctx context.Context) error) error {
+	return WithTransaction(s.client(), fn)
+}
+
+// WithTransaction runs fn inside a MongoDB transaction on client. Every write fn makes with the
+// context it is given is committed together, or not at all.
+func WithTransaction(client *mongo.Client, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start MongoDB session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// ErrNoTransactions is returned by CheckTransactions for a standalone mongod.
+var ErrNoTransactions = errors.New("MongoDB is a standalone server, transactions need a replica set or sharded cluster: start mongod with --replSet rs0 and run rs.initiate() once to make it a single-node replica set")
+
+// CheckTransactions reports whether the server can run WithTransaction: only replica set members
+// and mongos routers can, a standalone mongod rejects every transaction.
+func (s *service) CheckTransactions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.client().Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to check MongoDB topology: %w", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrNoTransactions
+	}
+	return nil
 }
 
 func (s *service) Disconnect() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := s.db.Disconnect(ctx)
+	err := s.client().Disconnect(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to disconnect from MongoDB: %w", err)
 	}
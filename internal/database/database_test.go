@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
 	database "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/models"
 
@@ -35,10 +36,21 @@ func connectToMongo() (*mongo.Client, error) {
 	return client, nil
 }
 
+// testConfig connects to the MongoDB of MONGO_DB_STRING, skipping the test when it is not set.
+func testConfig(t *testing.T) config.MongoConfig {
+	cfg := config.Defaults().Mongo
+	cfg.URI = os.Getenv("MONGO_DB_STRING")
+	if cfg.URI == "" {
+		t.Skip("MONGO_DB_STRING not set")
+	}
+	return cfg
+}
+
+// TestMain runs the tests that need no MongoDB, such as the reconnect ones, without one too.
 func TestMain(m *testing.M) {
 	client, err := connectToMongo()
 	if err != nil {
-		log.Fatalf("could not start mongodb container: %v", err)
+		fmt.Printf("Running without mongodb container: %v\n", err)
 	}
 
 	code := m.Run()
@@ -51,16 +63,16 @@ func TestMain(m *testing.M) {
 }
 
 func TestNew(t *testing.T) {
-	_, err := database.New()
+	_, err := database.New(testConfig(t))
 	if err != nil {
-		t.Fatal("database.New() returned nil")
+		t.Fatal("database.New(testConfig(t)) returned nil")
 	}
 }
 
 func TestHealth(t *testing.T) {
-	srv, err := database.New()
+	srv, err := database.New(testConfig(t))
 	if err != nil {
-		t.Fatal("database.New() returned nil")
+		t.Fatal("database.New(testConfig(t)) returned nil")
 	}
 
 	stats := srv.Health()
@@ -71,9 +83,9 @@ func TestHealth(t *testing.T) {
 }
 
 func TestUserDal(t *testing.T) {
-	srv, err := database.New()
+	srv, err := database.New(testConfig(t))
 	if err != nil {
-		t.Fatal("database.New() returned nil")
+		t.Fatal("database.New(testConfig(t)) returned nil")
 	}
 
 	collection := srv.GetCollection("users")
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+type countingProvider struct {
+	value string
+	gets  atomic.Int32
+}
+
+func (p *countingProvider) Get(ctx context.Context, name string) (string, error) {
+	p.gets.Add(1)
+	return p.value, nil
+}
+
+func TestPoolMonitorRefreshesSecretOnAuthFailure(t *testing.T) {
+	provider := &countingProvider{value: "mongodb://unchanged"}
+	s := &service{uri: "mongodb://unchanged", secret: secrets.NewSecret(provider, "MONGO_DB_STRING")}
+	monitor := s.poolMonitor()
+
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCheckOutFailed, Error: errors.New("connection refused")})
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionClosed, Error: topology.ConnectionError{Wrapped: &auth.Error{}}})
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), provider.gets.Load(), "only failed check-outs rejected for credentials refresh the secret")
+
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCheckOutFailed, Error: topology.ConnectionError{Wrapped: &auth.Error{}}})
+	assert.Eventually(t, func() bool { return provider.gets.Load() == 1 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package findings
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Reconcile updates the tracked findings of an account with the results of a scan and returns the
+// findings that changed, new ones without an ID:
+//
+//   - a finding reported for the first time is open, first and last seen at scannedAt;
+//   - an open or reopened finding reported again is last seen at scannedAt;
+//   - a finding reported as suppressed, see opa2.ScanResult.Suppressed, is suppressed;
+//   - a resolved or suppressed finding reported again, e.g. after its suppression expired, is
+//     reopened and no longer has a resolved_at;
+//   - a finding reported is scored with opa2.RiskScore, older findings scoring higher;
+//   - a finding no longer reported is resolved at scannedAt, when the scan can tell: the rule was
+//     checked on its resource without error, or the resource is gone from a resource type the scan
+//     evaluated.
+//
+// Findings are matched by Finding.Key, so string-deny findings, which have no rule ID, are told
+// apart by policy and title.
+//
+// Findings of resources the scan could not evaluate, or of resource types it did not evaluate,
+// are left as they are, so a failed retrieval does not resolve everything.
+func Reconcile(existing []Finding, results []opa2.ScanResult, discoveryJobID bson.ObjectID, clientID string, accountID string, provider string, scannedAt time.Time) []Finding {
+	tracked := make(map[string]Finding, len(existing))
+	for _, finding := range existing {
+		tracked[finding.Key()] = finding
+	}
+
+	scannedTypes := make(map[string]bool)
+	resultsByResource := make(map[string]opa2.ScanResult, len(results))
+	var accountRules []string
+	for _, result := range results {
+		scannedTypes[result.ResourceType] = true
+		resultsByResource[result.ResourceType+"/"+result.ResourceID] = result
+		if result.ResourceType == opa2.AccountResourceType {
+			accountRules = append(accountRules, result.CheckedRules...)
+		}
+	}
+
+	reported := make(map[string]Finding)
+	for _, result := range results {
+		for _, f := range slices.Concat(result.Findings, result.Suppressed) {
+			finding := Finding{
+				ClientID:     clientID,
+				AccountID:    accountID,
+				Provider:     provider,
+				ResourceType: result.ResourceType,
+				ResourceID:   result.ResourceID,
+				RuleID:       f.RuleID,
+				Policy:       f.Policy,
+				Title:        f.Title,
+				Severity:     f.Severity,
+				Risk:         result.Risk,
+				Suppression:  f.Suppression,
+			}
+			key := finding.Key()
+			if first, ok := reported[key]; ok {
+				finding = first
+			}
+			if len(f.Evidence) > 0 {
+				finding.Evidence = append(finding.Evidence, f.Evidence)
+			}
+			reported[key] = finding
+		}
+	}
+
+	var changed []Finding
+	for key, finding := range reported {
+		previous, ok := tracked[key]
+		switch {
+		case finding.Suppression != nil:
+			finding.Status = StatusSuppressed
+		case !ok:
+			finding.Status = StatusOpen
+		case previous.Status == StatusOpen || previous.Status == StatusReopened:
+			finding.Status = previous.Status
+		default:
+			finding.Status = StatusReopened
+		}
+		finding.FirstSeen = scannedAt
+		if ok {
+			finding.ID = previous.ID
+			finding.FirstSeen = previous.FirstSeen
+		}
+		finding.LastSeen = scannedAt
+		finding.RiskScore = opa2.RiskScore(finding.Severity, finding.Risk, scannedAt.Sub(finding.FirstSeen))
+		finding.LastDiscoveryJobID = discoveryJobID
+		changed = append(changed, finding)
+	}
+
+	for key, finding := range tracked {
+		if _, ok := reported[key]; ok || !finding.Active() || !scannedTypes[finding.ResourceType] {
+			continue
+		}
+
+		result, evaluated := resultsByResource[finding.ResourceType+"/"+finding.ResourceID]
+		if evaluated && !ruleChecked(finding, result, accountRules) {
+			continue
+		}
+
+		finding.Status = StatusResolved
+		finding.ResolvedAt = scannedAt
+		finding.LastDiscoveryJobID = discoveryJobID
+		changed = append(changed, finding)
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Key() < changed[j].Key() })
+	return changed
+}
+
+// FirstSeen looks up when tracked findings were first reported, so that a scan can age the risk
+// scores of its results before they are reconciled, see opa2.ScoreRisk. Findings are matched by Key
+// as in Reconcile, which keeps the first_seen of a resolved finding reported again.
+func FirstSeen(existing []Finding) opa2.FirstSeen {
+	firstSeen := make(map[string]time.Time, len(existing))
+	for _, finding := range existing {
+		firstSeen[finding.Key()] = finding.FirstSeen
+	}
+
+	return func(resourceType string, resourceID string, f opa2.Finding) (time.Time, bool) {
+		seen, ok := firstSeen[Finding{ResourceType: resourceType, ResourceID: resourceID, RuleID: f.RuleID, Policy: f.Policy, Title: f.Title}.Key()]
+		return seen, ok
+	}
+}
+
+// ruleChecked reports whether the scan evaluated the finding's rule on the result's resource, or on
+// the account. A finding without a rule ID, see Finding.Rule, is checked when its policy evaluated
+// the resource and no policy failed, as the result does not tell which policy did.
+func ruleChecked(finding Finding, result opa2.ScanResult, accountRules []string) bool {
+	if finding.RuleID == "" {
+		return result.Error == "" && slices.ContainsFunc(result.Policies, func(policy opa2.PolicyRef) bool {
+			return policy.Name == finding.Policy
+		})
+	}
+	return slices.Contains(result.CheckedRules, finding.RuleID) || slices.Contains(accountRules, finding.RuleID)
+}
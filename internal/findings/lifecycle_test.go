@@ -0,0 +1,182 @@
+package findings_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestReconcile(t *testing.T) {
+	firstSeen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	scannedAt := firstSeen.Add(90 * 24 * time.Hour)
+	jobID := bson.NewObjectID()
+
+	tracked := func(resourceID string, ruleID string, status findings.Status) findings.Finding {
+		f := findings.Finding{ID: bson.NewObjectID(), ClientID: "acme", AccountID: "123456789012", ResourceType: "s3", ResourceID: resourceID, RuleID: ruleID, Status: status, FirstSeen: firstSeen, LastSeen: firstSeen}
+		if status == findings.StatusResolved {
+			f.ResolvedAt = firstSeen
+		}
+		return f
+	}
+	existing := []findings.Finding{
+		tracked("reports", "AWS-S3-103", findings.StatusOpen),     // still reported
+		tracked("reports", "AWS-S3-101", findings.StatusOpen),     // fixed
+		tracked("public", "AWS-S3-001", findings.StatusResolved),  // reported again
+		tracked("deleted", "AWS-S3-103", findings.StatusReopened), // bucket gone
+		tracked("broken", "AWS-S3-103", findings.StatusOpen),      // could not be evaluated
+		tracked("scratch", "AWS-S3-102", findings.StatusResolved), // stays resolved
+	}
+	existing = append(existing, findings.Finding{ID: bson.NewObjectID(), ResourceType: "gcs", ResourceID: "media", RuleID: "GCP-GCS-001", Status: findings.StatusOpen})
+
+	checked := []string{"AWS-S3-001", "AWS-S3-101", "AWS-S3-102", "AWS-S3-103"}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "reports", CheckedRules: checked, Findings: []opa2.Finding{{RuleID: "AWS-S3-103", Title: "No TLS", Severity: opa2.SeverityMedium}}},
+		{ResourceType: "s3", ResourceID: "public", CheckedRules: checked, Findings: []opa2.Finding{
+			{RuleID: "AWS-S3-001", Title: "Public", Severity: opa2.SeverityHigh, Evidence: map[string]interface{}{"sid": "a"}},
+			{RuleID: "AWS-S3-001", Title: "Public", Severity: opa2.SeverityHigh, Evidence: map[string]interface{}{"sid": "b"}},
+		}},
+		{ResourceType: "s3", ResourceID: "broken", Error: "timeout"},
+		{ResourceType: "s3", ResourceID: "fresh", CheckedRules: checked, Risk: opa2.Risk{Exposure: opa2.ExposurePublic}, Findings: []opa2.Finding{{RuleID: "AWS-S3-102", Title: "Wildcard", Severity: opa2.SeverityHigh}}},
+	}
+
+	changed := findings.Reconcile(existing, results, jobID, "acme", "123456789012", "AWS", scannedAt)
+
+	byKey := make(map[string]findings.Finding)
+	for _, f := range changed {
+		assert.Equal(t, jobID, f.LastDiscoveryJobID)
+		byKey[f.Key()] = f
+	}
+	require.Len(t, byKey, 5)
+
+	still := byKey["s3/reports/AWS-S3-103"]
+	assert.Equal(t, findings.StatusOpen, still.Status)
+	assert.Equal(t, existing[0].ID, still.ID)
+	assert.Equal(t, firstSeen, still.FirstSeen)
+	assert.Equal(t, scannedAt, still.LastSeen)
+	assert.Equal(t, 10, still.RiskScore, "a medium finding open for 90 days scores above a new one")
+
+	fixed := byKey["s3/reports/AWS-S3-101"]
+	assert.Equal(t, findings.StatusResolved, fixed.Status)
+	assert.Equal(t, scannedAt, fixed.ResolvedAt)
+	assert.Equal(t, firstSeen, fixed.LastSeen)
+
+	reopened := byKey["s3/public/AWS-S3-001"]
+	assert.Equal(t, findings.StatusReopened, reopened.Status)
+	assert.True(t, reopened.ResolvedAt.IsZero())
+	assert.Len(t, reopened.Evidence, 2)
+
+	gone := byKey["s3/deleted/AWS-S3-103"]
+	assert.Equal(t, findings.StatusResolved, gone.Status)
+
+	fresh := byKey["s3/fresh/AWS-S3-102"]
+	assert.Equal(t, findings.StatusOpen, fresh.Status)
+	assert.True(t, fresh.ID.IsZero())
+	assert.Equal(t, scannedAt, fresh.FirstSeen)
+	assert.Equal(t, "acme", fresh.ClientID)
+	assert.Equal(t, opa2.SeverityHigh, fresh.Severity)
+	assert.Equal(t, opa2.ExposurePublic, fresh.Risk.Exposure)
+	assert.Equal(t, 30, fresh.RiskScore)
+}
+
+func TestReconcileResolvesAccountRules(t *testing.T) {
+	existing := []findings.Finding{{ID: bson.NewObjectID(), ResourceType: "s3", ResourceID: "trail", RuleID: "AWS-ACCT-001", Status: findings.StatusOpen}}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "trail", CheckedRules: []string{"AWS-S3-103"}},
+		{ResourceType: opa2.AccountResourceType, ResourceID: "123456789012", CheckedRules: []string{"AWS-ACCT-001"}},
+	}
+
+	changed := findings.Reconcile(existing, results, bson.NewObjectID(), "acme", "123456789012", "AWS", time.Now())
+
+	require.Len(t, changed, 1)
+	assert.Equal(t, findings.StatusResolved, changed[0].Status)
+
+	// without the account result the rule was not checked, so nothing can be said
+	changed = findings.Reconcile(existing, results[:1], bson.NewObjectID(), "acme", "123456789012", "AWS", time.Now())
+	assert.Empty(t, changed)
+}
+
+func TestReconcileSuppressedFindings(t *testing.T) {
+	firstSeen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	suppression := &opa2.SuppressionRef{ID: bson.NewObjectID(), Owner: "ann", ExpiresAt: firstSeen.Add(30 * 24 * time.Hour)}
+	existing := []findings.Finding{{ID: bson.NewObjectID(), ResourceType: "s3", ResourceID: "www", RuleID: "AWS-S3-001", Status: findings.StatusOpen, FirstSeen: firstSeen}}
+	suppressed := []opa2.ScanResult{{ResourceType: "s3", ResourceID: "www", Outcome: opa2.OutcomePass, Suppressed: []opa2.Finding{{RuleID: "AWS-S3-001", Suppression: suppression}}}}
+
+	changed := findings.Reconcile(existing, suppressed, bson.NewObjectID(), "acme", "123456789012", "AWS", firstSeen.Add(time.Hour))
+	require.Len(t, changed, 1)
+	assert.Equal(t, findings.StatusSuppressed, changed[0].Status)
+	assert.Equal(t, suppression, changed[0].Suppression)
+	assert.Equal(t, firstSeen, changed[0].FirstSeen)
+
+	// once the suppression expires the scan reports the finding as failing again
+	failing := []opa2.ScanResult{{ResourceType: "s3", ResourceID: "www", Outcome: opa2.OutcomeFail, Findings: []opa2.Finding{{RuleID: "AWS-S3-001"}}}}
+	changed = findings.Reconcile(changed, failing, bson.NewObjectID(), "acme", "123456789012", "AWS", suppression.ExpiresAt.Add(time.Hour))
+	require.Len(t, changed, 1)
+	assert.Equal(t, findings.StatusReopened, changed[0].Status)
+	assert.Nil(t, changed[0].Suppression)
+}
+
+func TestReconcileKeysLegacyFindingsByPolicyAndTitle(t *testing.T) {
+	firstSeen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	legacy := func(title string) findings.Finding {
+		return findings.Finding{ID: bson.NewObjectID(), ResourceType: "s3", ResourceID: "reports", Policy: "legacy/s3", Title: title, Status: findings.StatusOpen, FirstSeen: firstSeen}
+	}
+	existing := []findings.Finding{legacy("Bucket is public"), legacy("Bucket is not encrypted")}
+
+	policies := []opa2.PolicyRef{{Name: "legacy/s3", Version: 1}}
+	results := []opa2.ScanResult{{ResourceType: "s3", ResourceID: "reports", Policies: policies, Findings: []opa2.Finding{
+		{Policy: "legacy/s3", Title: "Bucket is public", Severity: opa2.SeverityMedium},
+		{Policy: "legacy/s3", Title: "Bucket has no lifecycle rules", Severity: opa2.SeverityMedium},
+	}}}
+
+	changed := findings.Reconcile(existing, results, bson.NewObjectID(), "acme", "123456789012", "AWS", firstSeen.Add(time.Hour))
+
+	byKey := make(map[string]findings.Finding)
+	for _, f := range changed {
+		byKey[f.Key()] = f
+	}
+	require.Len(t, byKey, 3, "string-deny findings of one resource are not merged into one")
+
+	still := byKey["s3/reports/legacy/s3:Bucket is public"]
+	assert.Equal(t, existing[0].ID, still.ID)
+	assert.Equal(t, firstSeen, still.FirstSeen)
+
+	fixed := byKey["s3/reports/legacy/s3:Bucket is not encrypted"]
+	assert.Equal(t, existing[1].ID, fixed.ID)
+	assert.Equal(t, findings.StatusResolved, fixed.Status, "its policy evaluated the resource without reporting it")
+
+	added := byKey["s3/reports/legacy/s3:Bucket has no lifecycle rules"]
+	assert.True(t, added.ID.IsZero())
+	assert.Equal(t, findings.StatusOpen, added.Status)
+
+	// a scan that did not evaluate the policy cannot resolve its findings
+	results[0].Policies = nil
+	results[0].Findings = nil
+	changed = findings.Reconcile(existing, results, bson.NewObjectID(), "acme", "123456789012", "AWS", firstSeen.Add(time.Hour))
+	assert.Empty(t, changed)
+}
+
+func TestFirstSeen(t *testing.T) {
+	firstSeen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	existing := []findings.Finding{
+		{ResourceType: "s3", ResourceID: "reports", RuleID: "AWS-S3-103", Status: findings.StatusOpen, FirstSeen: firstSeen},
+		{ResourceType: "s3", ResourceID: "reports", Policy: "legacy/s3", Title: "Bucket is public", Status: findings.StatusResolved, FirstSeen: firstSeen.Add(time.Hour)},
+	}
+
+	lookup := findings.FirstSeen(existing)
+
+	seen, ok := lookup("s3", "reports", opa2.Finding{RuleID: "AWS-S3-103", Title: "No TLS"})
+	assert.True(t, ok)
+	assert.Equal(t, firstSeen, seen)
+
+	seen, ok = lookup("s3", "reports", opa2.Finding{Policy: "legacy/s3", Title: "Bucket is public"})
+	assert.True(t, ok, "a resolved finding reported again keeps its first_seen")
+	assert.Equal(t, firstSeen.Add(time.Hour), seen)
+
+	_, ok = lookup("s3", "other", opa2.Finding{RuleID: "AWS-S3-103"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,63 @@
+package findings
+
+import (
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Status string
+
+const (
+	StatusOpen       Status = "open"       // reported by the latest scan, and by every scan since first seen
+	StatusResolved   Status = "resolved"   // no longer reported
+	StatusReopened   Status = "reopened"   // reported again after being resolved or suppressed
+	StatusSuppressed Status = "suppressed" // reported, but covered by an active suppression
+)
+
+// Finding is one rule failing on one resource across scans, keyed by (client, account, resource,
+// rule), see Rule. Several findings of a rule on the same resource in one scan, e.g. one per principal, are
+// one tracked finding.
+type Finding struct {
+	ID                 bson.ObjectID            `bson:"_id,omitempty" json:"id"`
+	ClientID           string                   `bson:"client_id" json:"client_id"`
+	AccountID          string                   `bson:"account_id" json:"account_id"`
+	Provider           string                   `bson:"provider" json:"provider"`
+	ResourceType       string                   `bson:"resource_type" json:"resource_type"`
+	ResourceID         string                   `bson:"resource_id" json:"resource_id"`
+	RuleID             string                   `bson:"rule_id" json:"rule_id"`
+	Policy             string                   `bson:"policy,omitempty" json:"policy,omitempty"`
+	Title              string                   `bson:"title" json:"title"`
+	Severity           opa2.Severity            `bson:"severity" json:"severity"`
+	Risk               opa2.Risk                `bson:"risk" json:"risk"`
+	RiskScore          int                      `bson:"risk_score" json:"risk_score"`                       // opa2.RiskScore as of the latest scan, including age
+	Evidence           []map[string]interface{} `bson:"evidence,omitempty" json:"evidence,omitempty"`       // of the latest scan that reported it
+	Suppression        *opa2.SuppressionRef     `bson:"suppression,omitempty" json:"suppression,omitempty"` // while suppressed
+	Status             Status                   `bson:"status" json:"status"`
+	FirstSeen          time.Time                `bson:"first_seen" json:"first_seen"`
+	LastSeen           time.Time                `bson:"last_seen" json:"last_seen"`
+	ResolvedAt         time.Time                `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+	LastDiscoveryJobID bson.ObjectID            `bson:"last_discovery_job_id" json:"last_discovery_job_id"` // latest job that reported or resolved it
+}
+
+// Key identifies the finding within its client and account, see Rule.
+func (f Finding) Key() string {
+	return f.ResourceType + "/" + f.ResourceID + "/" + f.Rule()
+}
+
+// Rule identifies the rule that reported the finding: its rule ID or, for a policy that still
+// denies with plain strings and so has no rule IDs, its policy and title, so that each message is
+// tracked as a finding of its own.
+func (f Finding) Rule() string {
+	if f.RuleID != "" {
+		return f.RuleID
+	}
+	return f.Policy + ":" + f.Title
+}
+
+// Active reports whether the finding is currently reported: open, reopened or suppressed.
+func (f Finding) Active() bool {
+	return f.Status == StatusOpen || f.Status == StatusReopened || f.Status == StatusSuppressed
+}
@@ -0,0 +1,140 @@
+package findings
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Repository stores the tracked findings of every client, see Reconcile.
+type Repository interface {
+	FindByAccount(clientID string, accountID string) ([]Finding, error)
+	FindByClient(clientID string, status Status) ([]Finding, error)
+	UpsertMany(findings []Finding) error
+}
+
+type repository struct {
+	db database.Service
+}
+
+func NewRepository(db database.Service) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) collection() *mongo.Collection {
+	return r.db.GetCollection("finding")
+}
+
+// EnsureIndexes creates the unique index on the key UpsertMany writes findings on, so that two
+// concurrent reconciliations of an account cannot both insert the same finding. It is idempotent
+// and meant to run at startup.
+func EnsureIndexes(db database.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "client_id", Value: 1},
+			{Key: "account_id", Value: 1},
+			{Key: "resource_type", Value: 1},
+			{Key: "resource_id", Value: 1},
+			{Key: "rule_id", Value: 1},
+			{Key: "policy", Value: 1},
+			{Key: "title", Value: 1},
+		},
+		Options: options.Index().SetName("finding_key").SetUnique(true),
+	}
+	if _, err := db.GetCollection("finding").Indexes().CreateOne(ctx, index); err != nil {
+		log.Error().Err(err).Str("function", "EnsureIndexes").Msg("Failed to create finding index")
+		return fmt.Errorf("failed to create finding index: %w", err)
+	}
+	return nil
+}
+
+// FindByAccount returns every tracked finding of an account, whatever its status.
+func (r *repository) FindByAccount(clientID string, accountID string) ([]Finding, error) {
+	return r.find(bson.M{"client_id": clientID, "account_id": accountID}, options.Find())
+}
+
+// FindByClient returns the findings of a client with a status, or with any status when it is
+// empty, highest risk score first, then most recently seen.
+func (r *repository) FindByClient(clientID string, status Status) ([]Finding, error) {
+	filter := bson.M{"client_id": clientID}
+	if status != "" {
+		filter["status"] = status
+	}
+	return r.find(filter, options.Find().SetSort(bson.D{{Key: "risk_score", Value: -1}, {Key: "last_seen", Value: -1}}))
+}
+
+func (r *repository) find(filter bson.M, opts *options.FindOptionsBuilder) ([]Finding, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "find").Interface("filter", filter).Msg("Failed to find findings")
+		return nil, fmt.Errorf("failed to find findings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var findings []Finding
+	if err := cursor.All(ctx, &findings); err != nil {
+		log.Error().Err(err).Str("function", "find").Interface("filter", filter).Msg("Failed to decode findings")
+		return nil, fmt.Errorf("failed to decode findings: %w", err)
+	}
+
+	return findings, nil
+}
+
+// UpsertMany writes findings keyed on (client, account, resource, rule), see Finding.Rule, so
+// reconciling a redelivered scan updates the same findings instead of adding new ones.
+func (r *repository) UpsertMany(findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(findings))
+	for _, finding := range findings {
+		filter := bson.M{
+			"client_id":     finding.ClientID,
+			"account_id":    finding.AccountID,
+			"resource_type": finding.ResourceType,
+			"resource_id":   finding.ResourceID,
+			"rule_id":       finding.RuleID,
+		}
+		if finding.RuleID == "" {
+			// findings without a rule ID are keyed by policy and title, see Finding.Rule
+			filter["title"] = finding.Title
+			filter["policy"] = finding.Policy
+			if finding.Policy == "" {
+				filter["policy"] = bson.M{"$exists": false}
+			}
+		}
+		finding.ID = bson.NilObjectID
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(finding).SetUpsert(true))
+	}
+
+	result, err := r.collection().BulkWrite(ctx, models)
+	if err != nil {
+		log.Error().Err(err).Str("function", "UpsertMany").Msg("Failed to upsert findings")
+		return fmt.Errorf("failed to upsert findings: %w", err)
+	}
+
+	log.Info().Str("function", "UpsertMany").
+		Int64("upsertedCount", result.UpsertedCount).
+		Int64("modifiedCount", result.ModifiedCount).
+		Msg("Findings upserted successfully")
+	return nil
+}
@@ -0,0 +1,254 @@
+package iampolicy
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// IsPublic reports whether an Allow statement grants access to everyone, through a wildcard
+// principal or a NotPrincipal, without a condition that limits who can use it, see
+// Condition.RestrictsPrincipals. Deny statements are not taken into account: a Deny that only
+// narrows a public grant, e.g. to TLS requests, leaves it public.
+func (d *Document) IsPublic() bool {
+	for _, statement := range d.Statement {
+		if statement.Effect != Allow || statement.Condition.RestrictsPrincipals() {
+			continue
+		}
+		if slices.Contains(statement.Principals(), Everyone) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalsFor lists the principals an Allow statement grants action on resource, an empty
+// resource standing for any, less those an unconditional Deny statement denies it. Statements are
+// matched with their Action or NotAction and Resource or NotResource. Principals are ordered by
+// type and ID.
+func (d *Document) PrincipalsFor(action, resource string) []PrincipalID {
+	var allowed []PrincipalID
+	for _, statement := range d.Statement {
+		if statement.Effect == Allow && statement.CoversAction(action) && statement.CoversResource(resource) {
+			allowed = append(allowed, statement.Principals()...)
+		}
+	}
+
+	for _, statement := range d.Statement {
+		if statement.Effect != Deny || len(statement.Condition) > 0 || !statement.CoversAction(action) || !statement.CoversResource(resource) {
+			continue
+		}
+		if statement.NotPrincipal != nil {
+			// denies everyone but the listed principals
+			excepted := statement.NotPrincipal.IDs()
+			allowed = slices.DeleteFunc(allowed, func(p PrincipalID) bool { return !slices.Contains(excepted, p) })
+			continue
+		}
+		denied := statement.Principal.IDs()
+		if slices.Contains(denied, Everyone) {
+			return nil
+		}
+		allowed = slices.DeleteFunc(allowed, func(p PrincipalID) bool { return slices.Contains(denied, p) })
+	}
+
+	return sortedPrincipals(allowed)
+}
+
+// CrossAccountPrincipals lists the AWS principals an Allow statement grants anything to that are
+// not in account: other accounts and their IAM entities, and everyone unless a condition limits
+// the statement, see Condition.RestrictsPrincipals. Principals are ordered by type and ID.
+func (d *Document) CrossAccountPrincipals(account string) []PrincipalID {
+	var principals []PrincipalID
+	for _, statement := range d.Statement {
+		if statement.Effect != Allow {
+			continue
+		}
+		for _, principal := range statement.Principals() {
+			switch {
+			case principal == Everyone && statement.Condition.RestrictsPrincipals():
+			case principal.Account != "" && principal.Account != account:
+				principals = append(principals, principal)
+			}
+		}
+	}
+	return sortedPrincipals(principals)
+}
+
+// Principals lists the principals of the statement. A NotPrincipal matches everyone but the
+// listed principals, so it is Everyone.
+func (s Statement) Principals() []PrincipalID {
+	if s.NotPrincipal != nil {
+		return []PrincipalID{Everyone}
+	}
+	return s.Principal.IDs()
+}
+
+// CoversAction reports whether the statement applies to action: it matches a pattern of Action,
+// or the statement has a NotAction that it matches none of.
+func (s Statement) CoversAction(action string) bool {
+	if len(s.NotAction) > 0 {
+		return !slices.ContainsFunc(s.NotAction, func(pattern string) bool { return MatchAction(pattern, action) })
+	}
+	return slices.ContainsFunc(s.Action, func(pattern string) bool { return MatchAction(pattern, action) })
+}
+
+// CoversResource reports whether the statement applies to resource, the same way as CoversAction
+// with Resource and NotResource. An empty resource stands for any and is covered unless the
+// statement only has a NotResource. Statements without either, as in trust policies, cover every
+// resource.
+func (s Statement) CoversResource(resource string) bool {
+	if len(s.NotResource) > 0 {
+		return resource != "" && !slices.ContainsFunc(s.NotResource, func(pattern string) bool { return matchWildcards(pattern, resource, false) })
+	}
+	if resource == "" || len(s.Resource) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.Resource, func(pattern string) bool { return matchWildcards(pattern, resource, false) })
+}
+
+// principalKeys are the condition keys that tie a statement to specific callers, lower case.
+var principalKeys = map[string]bool{
+	"aws:principalaccount":  true,
+	"aws:principalarn":      true,
+	"aws:principalorgid":    true,
+	"aws:principalorgpaths": true,
+	"aws:sourceaccount":     true,
+	"aws:sourcearn":         true,
+	"aws:sourceowner":       true,
+	"aws:sourcevpc":         true,
+	"aws:sourcevpce":        true,
+	"aws:userid":            true,
+	"kms:calleraccount":     true,
+}
+
+// matchingOperators are the operators that only let requests through whose key matches a value.
+var matchingOperators = map[string]bool{
+	"StringEquals":           true,
+	"StringEqualsIgnoreCase": true,
+	"StringLike":             true,
+	"ArnEquals":              true,
+	"ArnLike":                true,
+	"IpAddress":              true,
+}
+
+// RestrictsPrincipals reports whether the condition limits a statement to specific callers: it
+// matches a principal, source or network key such as aws:PrincipalOrgID or aws:SourceVpce against
+// values other than "*", or aws:SourceIp against ranges that are not public, see PublicCIDR.
+// Negated operators, e.g. StringNotEquals, never restrict, as requests without the key pass them.
+func (c Condition) RestrictsPrincipals() bool {
+	for operator, keys := range c {
+		operator = strings.TrimPrefix(strings.TrimPrefix(operator, "ForAnyValue:"), "ForAllValues:")
+		if strings.HasSuffix(operator, "IfExists") || !matchingOperators[operator] {
+			continue
+		}
+
+		for key, values := range keys {
+			key = strings.ToLower(key)
+			if len(values) == 0 || slices.Contains(values, "*") {
+				continue
+			}
+			if key == "aws:sourceip" {
+				if !slices.ContainsFunc(values, func(cidr string) bool { public, err := PublicCIDR(cidr); return public || err != nil }) {
+					return true
+				}
+				continue
+			}
+			if principalKeys[key] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchAction reports whether an action pattern of a statement, with the * and ? wildcards,
+// matches action. Action names are case-insensitive.
+func MatchAction(pattern, action string) bool {
+	return matchWildcards(pattern, action, true)
+}
+
+func matchWildcards(pattern, value string, ignoreCase bool) bool {
+	var expr strings.Builder
+	if ignoreCase {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()).MatchString(value)
+}
+
+// nonPublicRanges are the private, shared, loopback, link-local and documentation ranges, which
+// are not reachable from the internet.
+var nonPublicRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// PublicCIDR reports whether a CIDR, or a single address, covers any address outside
+// nonPublicRanges. 0.0.0.0/0 covers them all, so it is public.
+func PublicCIDR(cidr string) (bool, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(cidr)
+		if addrErr != nil {
+			return false, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	prefix = prefix.Masked()
+	if prefix.Addr().Is4In6() {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	for _, private := range nonPublicRanges {
+		if private.Bits() <= prefix.Bits() && private.Contains(prefix.Addr()) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func sortedPrincipals(principals []PrincipalID) []PrincipalID {
+	sort.Slice(principals, func(i, j int) bool {
+		if principals[i].Type != principals[j].Type {
+			return principals[i].Type < principals[j].Type
+		}
+		return principals[i].ID < principals[j].ID
+	})
+	return slices.Compact(principals)
+}
+
+func sortedKeys(m map[string]Values) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
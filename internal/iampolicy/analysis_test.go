@@ -0,0 +1,144 @@
+package iampolicy_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/iampolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, document string) *iampolicy.Document {
+	t.Helper()
+	d, err := iampolicy.Parse([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseSingleAndListFields(t *testing.T) {
+	d := parse(t, `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"AWS": "123456789012", "Service": ["sns.amazonaws.com"]}, "Action": "sqs:SendMessage", "Resource": ["arn:aws:sqs:eu-west-1:123456789012:jobs"]}}`)
+
+	if assert.Len(t, d.Statement, 1) {
+		statement := d.Statement[0]
+		assert.Equal(t, iampolicy.Values{"sqs:SendMessage"}, statement.Action)
+		assert.Equal(t, []iampolicy.PrincipalID{
+			{Type: "AWS", ID: "arn:aws:iam::123456789012:root", Account: "123456789012"},
+			{Type: "Service", ID: "sns.amazonaws.com"},
+		}, statement.Principals())
+	}
+
+	_, err := iampolicy.Parse([]byte(`{"Statement": [{"Effect": "Allow", "Principal": "123456789012"}]}`))
+	assert.Error(t, err)
+}
+
+func TestParseBooleanAndNumberConditionValues(t *testing.T) {
+	d := parse(t, `{"Statement": [
+		{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Condition": {"Bool": {"aws:SecureTransport": false}}},
+		{"Effect": "Allow", "Principal": "*", "Action": "s3:ListBucket", "Condition": {"NumericLessThan": {"s3:max-keys": [10, 2.5]}}}
+	]}`)
+
+	if assert.Len(t, d.Statement, 2) {
+		assert.Equal(t, iampolicy.Values{"false"}, d.Statement[0].Condition["Bool"]["aws:SecureTransport"])
+		assert.Equal(t, iampolicy.Values{"10", "2.5"}, d.Statement[1].Condition["NumericLessThan"]["s3:max-keys"])
+	}
+
+	document, err := iampolicy.FromValue(map[string]interface{}{"Statement": []interface{}{
+		map[string]interface{}{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": map[string]interface{}{"Bool": map[string]interface{}{"aws:SecureTransport": true}}},
+	}})
+	if assert.NoError(t, err) {
+		assert.True(t, document.IsPublic())
+	}
+
+	_, err = iampolicy.Parse([]byte(`{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Condition": {"Bool": {"aws:SecureTransport": {"x": 1}}}}]}`))
+	assert.Error(t, err)
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected bool
+	}{
+		{"wildcard principal", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"}]}`, true},
+		{"aws wildcard principal", `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": ["*"]}, "Action": "s3:GetObject"}]}`, true},
+		{"not principal", `{"Statement": [{"Effect": "Allow", "NotPrincipal": {"AWS": "123456789012"}, "Action": "s3:GetObject"}]}`, true},
+		{"organization condition", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"StringEquals": {"aws:PrincipalOrgID": "o-abc123"}}}]}`, false},
+		{"negated condition", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"StringNotEquals": {"aws:PrincipalOrgID": "o-abc123"}}}]}`, true},
+		{"private source ip", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"IpAddress": {"aws:SourceIp": ["10.0.0.0/8", "192.168.1.0/24"]}}}]}`, false},
+		{"public source ip", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"IpAddress": {"aws:SourceIp": "0.0.0.0/0"}}}]}`, true},
+		{"tls only", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"Bool": {"aws:SecureTransport": "true"}}}]}`, true},
+		{"tls only as boolean", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Condition": {"Bool": {"aws:SecureTransport": true}}}]}`, true},
+		{"tls enforced with a boolean", `{"Statement": [{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Condition": {"Bool": {"aws:SecureTransport": false}}}, {"Effect": "Allow", "Principal": {"AWS": "123456789012"}, "Action": "s3:GetObject"}]}`, false},
+		{"number condition", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:ListBucket", "Condition": {"NumericLessThan": {"s3:max-keys": 10}}}]}`, true},
+		{"account principal", `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject"}]}`, false},
+		{"deny everyone", `{"Statement": [{"Effect": "Deny", "Principal": "*", "Action": "s3:*"}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parse(t, tt.document).IsPublic())
+		})
+	}
+}
+
+func TestPrincipalsFor(t *testing.T) {
+	d := parse(t, `{"Statement": [
+		{"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::123456789012:role/reader", "444455556666"]}, "Action": "s3:Get*", "Resource": "arn:aws:s3:::reports/*"},
+		{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:role/admin"}, "NotAction": ["s3:Delete*"], "Resource": "*"},
+		{"Effect": "Deny", "Principal": {"AWS": "444455556666"}, "Action": "s3:GetObject", "Resource": "*"},
+		{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:role/writer"}, "Action": "s3:PutObject", "NotResource": "arn:aws:s3:::reports/private/*"}
+	]}`)
+
+	assert.Equal(t, []iampolicy.PrincipalID{
+		{Type: "AWS", ID: "arn:aws:iam::123456789012:role/admin", Account: "123456789012"},
+		{Type: "AWS", ID: "arn:aws:iam::123456789012:role/reader", Account: "123456789012"},
+	}, d.PrincipalsFor("s3:GetObject", "arn:aws:s3:::reports/q1.csv"))
+
+	assert.Empty(t, d.PrincipalsFor("s3:DeleteObject", ""))
+
+	assert.Equal(t, []iampolicy.PrincipalID{
+		{Type: "AWS", ID: "arn:aws:iam::123456789012:role/admin", Account: "123456789012"},
+		{Type: "AWS", ID: "arn:aws:iam::123456789012:role/writer", Account: "123456789012"},
+	}, d.PrincipalsFor("s3:PutObject", "arn:aws:s3:::reports/q1.csv"))
+
+	assert.Equal(t, []iampolicy.PrincipalID{
+		{Type: "AWS", ID: "arn:aws:iam::123456789012:role/admin", Account: "123456789012"},
+	}, d.PrincipalsFor("s3:PutObject", "arn:aws:s3:::reports/private/keys.csv"))
+}
+
+func TestCrossAccountPrincipals(t *testing.T) {
+	d := parse(t, `{"Statement": [
+		{"Effect": "Allow", "Principal": {"AWS": ["123456789012", "arn:aws:iam::999999999999:role/x"], "Service": "cloudtrail.amazonaws.com"}, "Action": "kms:Decrypt", "Resource": "*"},
+		{"Effect": "Allow", "Principal": "*", "Action": "kms:Encrypt", "Resource": "*", "Condition": {"StringEquals": {"kms:CallerAccount": "123456789012"}}},
+		{"Effect": "Allow", "Principal": "*", "Action": "kms:DescribeKey", "Resource": "*"}
+	]}`)
+
+	assert.Equal(t, []iampolicy.PrincipalID{
+		iampolicy.Everyone,
+		{Type: "AWS", ID: "arn:aws:iam::999999999999:role/x", Account: "999999999999"},
+	}, d.CrossAccountPrincipals("123456789012"))
+}
+
+func TestPublicCIDR(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		expected bool
+	}{
+		{"0.0.0.0/0", true},
+		{"10.1.0.0/16", false},
+		{"10.0.0.0/7", true},
+		{"52.95.110.1", true},
+		{"fd00::/8", false},
+		{"::/0", true},
+	}
+
+	for _, tt := range tests {
+		public, err := iampolicy.PublicCIDR(tt.cidr)
+		assert.NoError(t, err, tt.cidr)
+		assert.Equal(t, tt.expected, public, tt.cidr)
+	}
+
+	_, err := iampolicy.PublicCIDR("10.0.0.0/33")
+	assert.Error(t, err)
+}
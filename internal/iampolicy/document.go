@@ -0,0 +1,228 @@
+package iampolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Document is an AWS policy document: an IAM identity or role trust policy, or a resource policy
+// such as an S3 bucket, KMS key, SQS queue or SNS topic policy. They all share this grammar.
+type Document struct {
+	Version   string     `json:"Version,omitempty"`
+	ID        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+// Statements is the Statement of a document, which may be a single statement or a list.
+type Statements []Statement
+
+func (s *Statements) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single Statement
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		*s = Statements{single}
+		return nil
+	}
+
+	var list []Statement
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// Statement is one statement of a document. Of Action and NotAction, Resource and NotResource,
+// Principal and NotPrincipal, at most one of each pair is set.
+type Statement struct {
+	Sid          string     `json:"Sid,omitempty"`
+	Effect       string     `json:"Effect"`
+	Principal    *Principal `json:"Principal,omitempty"`
+	NotPrincipal *Principal `json:"NotPrincipal,omitempty"`
+	Action       Values     `json:"Action,omitempty"`
+	NotAction    Values     `json:"NotAction,omitempty"`
+	Resource     Values     `json:"Resource,omitempty"`
+	NotResource  Values     `json:"NotResource,omitempty"`
+	Condition    Condition  `json:"Condition,omitempty"`
+}
+
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// Values is a policy field that may be a single value or a list of values, e.g. Action. Condition
+// values may also be JSON booleans or numbers, e.g. {"Bool": {"aws:SecureTransport": false}}; they
+// are kept as their JSON text, so false and "false" are the same value.
+type Values []string
+
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+
+	values := make(Values, 0, len(list))
+	for _, raw := range list {
+		value, err := scalar(raw)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	*v = values
+	return nil
+}
+
+// scalar reads a string, boolean or number, the latter two as their JSON text.
+func scalar(raw json.RawMessage) (string, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("expected a string, boolean, number or a list of them: %w", err)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool, json.Number:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("expected a string, boolean, number or a list of them, got %s", raw)
+	}
+}
+
+// Principal is the Principal or NotPrincipal of a statement: "*", or principal IDs by type, e.g.
+// {"AWS": ["123456789012"], "Service": "cloudtrail.amazonaws.com"}.
+type Principal struct {
+	Wildcard bool // "*"
+	ByType   map[string]Values
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "*" {
+			return fmt.Errorf("principal %q must be \"*\" or an object", single)
+		}
+		*p = Principal{Wildcard: true}
+		return nil
+	}
+
+	var byType map[string]Values
+	if err := json.Unmarshal(data, &byType); err != nil {
+		return fmt.Errorf("expected \"*\" or principals by type: %w", err)
+	}
+	*p = Principal{ByType: byType}
+	return nil
+}
+
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if p.Wildcard {
+		return json.Marshal("*")
+	}
+	return json.Marshal(p.ByType)
+}
+
+// PrincipalID is one normalized principal. "*" and {"AWS": "*"} are both the AWS principal "*" of
+// account "*"; an account ID is the root ARN of the account. Account is empty for principals that
+// are not AWS accounts or IAM entities, e.g. services.
+type PrincipalID struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Account string `json:"account"`
+}
+
+// Everyone is the wildcard principal.
+var Everyone = PrincipalID{Type: "AWS", ID: "*", Account: "*"}
+
+// IDs lists the normalized principals, ordered by type as in the document.
+func (p *Principal) IDs() []PrincipalID {
+	if p == nil {
+		return nil
+	}
+	if p.Wildcard {
+		return []PrincipalID{Everyone}
+	}
+
+	var ids []PrincipalID
+	for _, principalType := range sortedKeys(p.ByType) {
+		for _, id := range p.ByType[principalType] {
+			if principalType == "AWS" {
+				ids = append(ids, awsPrincipal(id))
+				continue
+			}
+			ids = append(ids, PrincipalID{Type: principalType, ID: id})
+		}
+	}
+	return ids
+}
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+func awsPrincipal(id string) PrincipalID {
+	switch {
+	case id == "*":
+		return Everyone
+	case accountIDPattern.MatchString(id):
+		return PrincipalID{Type: "AWS", ID: "arn:aws:iam::" + id + ":root", Account: id}
+	}
+
+	account := ""
+	if arn, ok := ParseARN(id); ok {
+		account = arn.Account
+	}
+	return PrincipalID{Type: "AWS", ID: id, Account: account}
+}
+
+// Condition is the Condition block of a statement: values by condition key by operator, e.g.
+// {"IpAddress": {"aws:SourceIp": ["203.0.113.0/24"]}}.
+type Condition map[string]map[string]Values
+
+// ARN is a parsed Amazon Resource Name.
+type ARN struct {
+	Partition string `json:"partition"`
+	Service   string `json:"service"`
+	Region    string `json:"region"`
+	Account   string `json:"account"`
+	Resource  string `json:"resource"`
+}
+
+// ParseARN splits an ARN into its parts. It reports false for anything that is not an ARN, e.g. a
+// bare account ID.
+func ParseARN(arn string) (ARN, bool) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[2] == "" {
+		return ARN{}, false
+	}
+	return ARN{Partition: parts[1], Service: parts[2], Region: parts[3], Account: parts[4], Resource: parts[5]}, true
+}
+
+// Parse reads a policy document from its JSON.
+func Parse(data []byte) (*Document, error) {
+	var document Document
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+	return &document, nil
+}
+
+// FromValue reads a policy document from a decoded JSON value, as retrieved resource configs hold
+// them, or from its JSON as a string, as e.g. KMS key policies are returned.
+func FromValue(value interface{}) (*Document, error) {
+	if s, ok := value.(string); ok {
+		return Parse([]byte(s))
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy document: %w", err)
+	}
+	return Parse(data)
+}
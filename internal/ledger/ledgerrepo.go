@@ -0,0 +1,134 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ClaimLease is how long a claim holds a job's stage. It is the longest a Lambda can run, so a
+// claim that is neither completed nor released by then belongs to a handler that died.
+const ClaimLease = 15 * time.Minute
+
+// ErrInProgress is returned by Claim when another delivery holds the stage. The message should be
+// retried later rather than dropped, in case that delivery fails.
+var ErrInProgress = errors.New("stage is being processed by another delivery")
+
+// Repository is the processed-message ledger. Stage handlers claim the job's stage before doing
+// any work so that a redelivered queue message for an already claimed or completed job and stage
+// is skipped, even when both deliveries arrive at the same time.
+type Repository interface {
+	Claim(jobID bson.ObjectID, stage string, messageID string) (bool, error)
+	Release(jobID bson.ObjectID, stage string, messageID string) error
+	MarkCompleted(ctx context.Context, jobID bson.ObjectID, stage string, messageID string) error
+}
+
+type repository struct {
+	db database.Service
+}
+
+func NewRepository(db database.Service) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) collection() *mongo.Collection {
+	return r.db.GetCollection("processed_message")
+}
+
+// Claim takes the job's stage for messageID by inserting its entry, which only one delivery can
+// do: the others get a duplicate key. It returns false when the stage is already completed, and
+// ErrInProgress when another delivery holds it. A claim older than ClaimLease is taken over.
+func (r *repository) Claim(jobID bson.ObjectID, stage string, messageID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	entry := Entry{
+		ID:        entryID(jobID, stage),
+		JobID:     jobID,
+		Stage:     stage,
+		Status:    ProcessingStatus,
+		MessageID: messageID,
+		ClaimedAt: now.Unix(),
+	}
+
+	_, err := r.collection().InsertOne(ctx, entry)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		log.Error().Err(err).Str("function", "Claim").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Failed to insert ledger entry")
+		return false, fmt.Errorf("failed to claim job %s stage %s: %w", jobID.Hex(), stage, err)
+	}
+
+	stale := bson.M{"_id": entry.ID, "status": ProcessingStatus, "claimed_at": bson.M{"$lt": now.Add(-ClaimLease).Unix()}}
+	update := bson.M{"$set": bson.M{"message_id": messageID, "claimed_at": now.Unix()}}
+	result, err := r.collection().UpdateOne(ctx, stale, update)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Claim").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Failed to take over stale ledger entry")
+		return false, fmt.Errorf("failed to claim job %s stage %s: %w", jobID.Hex(), stage, err)
+	}
+	if result.ModifiedCount == 1 {
+		log.Warn().Str("function", "Claim").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Took over stale claim")
+		return true, nil
+	}
+
+	var existing Entry
+	if err := r.collection().FindOne(ctx, bson.M{"_id": entry.ID}).Decode(&existing); err != nil {
+		log.Error().Err(err).Str("function", "Claim").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Failed to find ledger entry")
+		return false, fmt.Errorf("failed to find ledger entry for job %s stage %s: %w", jobID.Hex(), stage, err)
+	}
+	if existing.Status == CompletedStatus {
+		return false, nil
+	}
+	return false, ErrInProgress
+}
+
+// Release gives up the claim of messageID on the job's stage after its processing failed, so that
+// a redelivery can claim it again. A completed stage is left as it is.
+func (r *repository) Release(jobID bson.ObjectID, stage string, messageID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": entryID(jobID, stage), "status": ProcessingStatus, "message_id": messageID}
+	if _, err := r.collection().DeleteOne(ctx, filter); err != nil {
+		log.Error().Err(err).Str("function", "Release").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Failed to release ledger entry")
+		return fmt.Errorf("failed to release job %s stage %s: %w", jobID.Hex(), stage, err)
+	}
+	return nil
+}
+
+// MarkCompleted records the stage as done for the job. ctx may be a transaction context so that the
+// entry is committed together with the stage's hand-off to the next queue.
+func (r *repository) MarkCompleted(ctx context.Context, jobID bson.ObjectID, stage string, messageID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"job_id":       jobID,
+			"stage":        stage,
+			"status":       CompletedStatus,
+			"message_id":   messageID,
+			"completed_at": time.Now().Unix(),
+		},
+	}
+	_, err := r.collection().UpdateOne(ctx, bson.M{"_id": entryID(jobID, stage)}, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		log.Error().Err(err).Str("function", "MarkCompleted").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Failed to mark stage completed")
+		return fmt.Errorf("failed to mark job %s stage %s completed: %w", jobID.Hex(), stage, err)
+	}
+
+	log.Info().Str("function", "MarkCompleted").Str("jobID", jobID.Hex()).Str("stage", stage).Msg("Stage marked completed")
+	return nil
+}
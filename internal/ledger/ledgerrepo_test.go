@@ -0,0 +1,88 @@
+package ledger_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// newRepository connects to the MongoDB of MONGO_DB_STRING. Every test uses a new job ID, so runs
+// do not see each other's entries.
+func newRepository(t *testing.T) ledger.Repository {
+	cfg := config.Defaults().Mongo
+	cfg.URI = os.Getenv("MONGO_DB_STRING")
+	if cfg.URI == "" {
+		t.Skip("MONGO_DB_STRING not set")
+	}
+
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	return ledger.NewRepository(db)
+}
+
+func TestClaimDuplicateDelivery(t *testing.T) {
+	repo := newRepository(t)
+	jobID := bson.NewObjectID()
+
+	// the same message delivered to several handlers at once
+	const deliveries = 8
+	var claimed, inProgress int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := repo.Claim(jobID, ledger.ScanStage, "msg-1")
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				claimed++
+			}
+			if err == ledger.ErrInProgress {
+				inProgress++
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, claimed)
+	assert.Equal(t, deliveries-1, inProgress)
+
+	require.NoError(t, repo.MarkCompleted(context.Background(), jobID, ledger.ScanStage, "msg-1"))
+
+	ok, err := repo.Claim(jobID, ledger.ScanStage, "msg-2")
+	assert.NoError(t, err)
+	assert.False(t, ok, "a completed stage is never claimed again")
+}
+
+func TestReleaseLetsRedeliveryClaim(t *testing.T) {
+	repo := newRepository(t)
+	jobID := bson.NewObjectID()
+
+	ok, err := repo.Claim(jobID, ledger.RetrievalStage, "msg-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = repo.Claim(jobID, ledger.RetrievalStage, "msg-2")
+	assert.ErrorIs(t, err, ledger.ErrInProgress)
+
+	// only the holder of the claim can release it
+	require.NoError(t, repo.Release(jobID, ledger.RetrievalStage, "msg-2"))
+	_, err = repo.Claim(jobID, ledger.RetrievalStage, "msg-2")
+	assert.ErrorIs(t, err, ledger.ErrInProgress)
+
+	require.NoError(t, repo.Release(jobID, ledger.RetrievalStage, "msg-1"))
+	ok, err = repo.Claim(jobID, ledger.RetrievalStage, "msg-2")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
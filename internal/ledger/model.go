@@ -0,0 +1,29 @@
+package ledger
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	RetrievalStage = "retrieval"
+	ScanStage      = "scan"
+	FindingsStage  = "findings" // finding tracking after a completed scan, see pipeline.Scan
+
+	ProcessingStatus = "processing"
+	CompletedStatus  = "completed"
+)
+
+// Entry records that a pipeline stage has claimed, and then finished, processing a discovery job.
+type Entry struct {
+	ID          string        `bson:"_id"`          // "<job id>:<stage>", one entry per job and stage
+	JobID       bson.ObjectID `bson:"job_id"`       // Link to the discovery job
+	Stage       string        `bson:"stage"`        // e.g., "retrieval", "scan"
+	Status      string        `bson:"status"`       // "processing" while claimed, then "completed"
+	MessageID   string        `bson:"message_id"`   // queue message that claimed, then completed, the stage
+	ClaimedAt   int64         `bson:"claimed_at"`   // Timestamp for the claim
+	CompletedAt int64         `bson:"completed_at"` // Timestamp for stage completion
+}
+
+func entryID(jobID bson.ObjectID, stage string) string {
+	return jobID.Hex() + ":" + stage
+}
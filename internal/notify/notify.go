@@ -1,9 +1,14 @@
 package notify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/smtp"
-	"os"
+	"net/textproto"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
 )
 
 type EmailConfig struct {
@@ -12,16 +17,38 @@ type EmailConfig struct {
 	Body    string
 }
 
-func SendEmail(config EmailConfig) error {
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASSWORD")
+type Sender interface {
+	SendEmail(config EmailConfig) error
+}
+
+type SMTPSender struct {
+	cfg config.SMTPConfig
+}
 
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+func NewSMTPSender(cfg config.SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+// SendEmail sends through the configured SMTP server. When the password came from a rotatable
+// secret it is read through the secrets cache on every send, and re-read if the server rejects it.
+func (s *SMTPSender) SendEmail(config EmailConfig) error {
+	if s.cfg.PasswordSecret == nil {
+		return s.send(config, s.cfg.Password)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return s.cfg.PasswordSecret.Use(ctx, isAuthError, func(password string) error {
+		return s.send(config, password)
+	})
+}
+
+func (s *SMTPSender) send(config EmailConfig, password string) error {
+	auth := smtp.PlainAuth("", s.cfg.User, password, s.cfg.Host)
 
 	headers := make(map[string]string)
-	headers["From"] = smtpUser
+	headers["From"] = s.cfg.User
 	headers["To"] = config.To[0]
 	headers["Subject"] = config.Subject
 	headers["MIME-Version"] = "1.0"
@@ -34,10 +61,16 @@ func SendEmail(config EmailConfig) error {
 	message += "\r\n" + config.Body
 
 	return smtp.SendMail(
-		smtpHost+":"+smtpPort,
+		s.cfg.Host+":"+s.cfg.Port,
 		auth,
-		smtpUser,
+		s.cfg.User,
 		config.To,
 		[]byte(message),
 	)
 }
+
+// isAuthError reports whether the server rejected the credentials (535 Authentication failed).
+func isAuthError(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code == 535
+}
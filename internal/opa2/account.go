@@ -0,0 +1,176 @@
+package opa2
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AccountResourceType is the resource type of account-scope policies, e.g. package account.aws.
+// They are evaluated once per job, after every resource, with the whole job inventory loaded as
+// data.inventory:
+//
+//	data.inventory[<resource type>][<resource ID>] = {"resource": {...}, "config": {...}}
+//
+// so rules can relate resources to each other. Their input is the envelope of the account itself,
+// with resource type "account", the account ID as resource ID and an empty config. A finding about
+// one resource names it,
+//
+//	{"rule_id": "AWS-ACCT-001", "resource": {"type": "s3", "id": "trail-logs"}}
+//
+// and is reported on that resource's scan result; findings without a resource are reported on the
+// account's own result.
+const AccountResourceType = "account"
+
+// EvaluateAccount evaluates the effective account-scope policies of a client against the account's
+// input and the inventory of a job, and merges their findings.
+func EvaluateAccount(policies []EffectivePolicy, params Params, input Input, inventory []cloud.ResourceConfig) (Outcome, []Finding, error) {
+	result := evaluatePolicies(prepareAccountPolicies(policies, params, inventoryDocument(inventory)), input)
+	return result.outcome, result.findings, result.err
+}
+
+// inventoryDocument indexes the configs of a job by resource type and ID, each with the resource and
+// config parts of its input.
+func inventoryDocument(configs []cloud.ResourceConfig) map[string]interface{} {
+	inventory := make(map[string]interface{})
+	for _, config := range configs {
+		resources, ok := inventory[config.ResourceType].(map[string]interface{})
+		if !ok {
+			resources = make(map[string]interface{})
+			inventory[config.ResourceType] = resources
+		}
+
+		document := NewInput(config, time.Time{}).document()
+		resources[config.ResourceID] = map[string]interface{}{
+			"resource": document["resource"],
+			"config":   document["config"],
+		}
+	}
+	return inventory
+}
+
+// prepareAccountPolicies compiles account-scope policies with the inventory as data. They are not
+// cached, as the inventory is different for every job.
+func prepareAccountPolicies(effective []EffectivePolicy, params Params, inventory map[string]interface{}) []preparedPolicy {
+	data := policyData(params, inventory)
+
+	policies := make([]preparedPolicy, 0, len(effective))
+	for i := range effective {
+		regoPolicy := &effective[i].RegoPolicy
+		query, err := prepareQuery(regoPolicy, data)
+		if err != nil {
+			log.Error().Err(err).Str("function", "prepareAccountPolicies").Str("policy", regoPolicy.Name).Msg("Failed to prepare rego policy")
+		}
+
+		disabled := make(map[string]bool, len(effective[i].DisabledRules))
+		for _, ruleID := range effective[i].DisabledRules {
+			disabled[ruleID] = true
+		}
+		policies = append(policies, preparedPolicy{policy: regoPolicy, query: query, rules: policyRules(regoPolicy), disabled: disabled, err: err})
+	}
+	return policies
+}
+
+// accountInput is the input of account-scope policies.
+func (s scanContext) accountInput() Input {
+	return Input{
+		ResourceID:     s.accountID,
+		ResourceType:   AccountResourceType,
+		AccountID:      s.accountID,
+		Provider:       s.provider,
+		ClientID:       s.clientID,
+		DiscoveryJobID: s.discoveryID,
+		ScannedAt:      s.scannedAt,
+	}
+}
+
+// scanAccount evaluates the client's account-scope policies against the inventory and reports
+// their findings on the scanned resources they are about, adding a result for a resource that had
+// none. The account's own result is added whenever account-scope policies apply. A failure to load
+// the policies only skips the pass; the resource results are still written.
+func scanAccount(regoRepo RegoRepository, scan scanContext, overrides []PolicyOverride, params Params, inventory []cloud.ResourceConfig, scanned []resourceTypeResults) []resourceTypeResults {
+	regoPolicies, err := regoRepo.FindByResourceType(AccountResourceType, scan.clientID)
+	if err != nil {
+		log.Warn().Err(err).Str("discoveryID", scan.discoveryID.Hex()).Msg("Failed to get account rego policies")
+		return scanned
+	}
+	effective := ResolvePolicies(scan.clientID, regoPolicies, overrides)
+	if len(effective) == 0 {
+		return scanned
+	}
+
+	log.Info().Str("discoveryID", scan.discoveryID.Hex()).Int("policies", len(effective)).Int("resources", len(inventory)).Msg("Running account-scope scan")
+
+	policyRefs := policyRefsOf(effective)
+	result := evaluatePolicies(prepareAccountPolicies(effective, params, inventoryDocument(inventory)), scan.accountInput())
+	if result.err != nil {
+		log.Error().Err(result.err).Str("discoveryID", scan.discoveryID.Hex()).Int("attempts", result.attempts).Msg("Failed to evaluate account")
+	}
+
+	var own []Finding
+	for _, finding := range result.findings {
+		if finding.Resource == nil {
+			own = append(own, finding)
+			continue
+		}
+		scanned = attachFinding(scanned, scan, *finding.Resource, finding, policyRefs)
+	}
+
+	account := result
+	account.findings = own
+	switch {
+	case len(own) > 0:
+		account.outcome = OutcomeFail
+	case result.err != nil:
+		account.outcome = OutcomeError
+	case result.outcome == OutcomeFail:
+		// every finding was about a resource; the account itself passed
+		account.outcome = OutcomePass
+	}
+
+	return append(scanned, resourceTypeResults{
+		resourceType: AccountResourceType,
+		results:      []ScanResult{scan.result(AccountResourceType, scan.accountID, account, policyRefs)},
+	})
+}
+
+// attachFinding adds an account-scope finding to the scan result of the resource it is about,
+// which then fails.
+func attachFinding(scanned []resourceTypeResults, scan scanContext, resource ResourceRef, finding Finding, policyRefs []PolicyRef) []resourceTypeResults {
+	for i := range scanned {
+		if scanned[i].resourceType != resource.Type {
+			continue
+		}
+		for j := range scanned[i].results {
+			scanResult := &scanned[i].results[j]
+			if scanResult.ResourceID != resource.ID {
+				continue
+			}
+
+			scanResult.Findings = append(scanResult.Findings, finding)
+			SortFindings(scanResult.Findings)
+			scanResult.Outcome = OutcomeFail
+			scanResult.Pass = false
+			scanResult.Severity = MaxSeverity(scanResult.Findings)
+			scanResult.Misconfiguration = findingTitles(scanResult.Findings)
+			for _, ref := range policyRefs {
+				if !slices.Contains(scanResult.Policies, ref) {
+					scanResult.Policies = append(scanResult.Policies, ref)
+				}
+			}
+			return scanned
+		}
+
+		scanned[i].results = append(scanned[i].results, scan.result(resource.Type, resource.ID, evaluation{outcome: OutcomeFail, findings: []Finding{finding}}, policyRefs))
+		return scanned
+	}
+
+	// no policy of the resource's type applied, so it has no results yet
+	return append(scanned, resourceTypeResults{
+		resourceType: resource.Type,
+		results:      []ScanResult{scan.result(resource.Type, resource.ID, evaluation{outcome: OutcomeFail, findings: []Finding{finding}}, policyRefs)},
+	})
+}
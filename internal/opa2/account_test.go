@@ -0,0 +1,42 @@
+package opa2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateAccountSeesInventory(t *testing.T) {
+	policy := opa2.RegoPolicy{ResourceType: opa2.AccountResourceType, Name: "account/unlogged", Query: "data.account.unlogged.deny", Rego: `package account.unlogged
+
+deny contains {"rule_id": "ACCT-LOG", "title": "Bucket without access logging.", "resource": {"type": "s3", "id": id}} if {
+    some id, bucket in data.inventory.s3
+    bucket.config.logging == ""
+    bucket.resource.tags.env == "prod"
+}
+`}
+	assert.NoError(t, opa2.ValidatePolicy(&policy))
+
+	inventory := []cloud.ResourceConfig{
+		{ResourceType: "s3", ResourceID: "reports", Tags: map[string]string{"env": "prod"}, Config: map[string]interface{}{"logging": ""}},
+		{ResourceType: "s3", ResourceID: "scratch", Tags: map[string]string{"env": "dev"}, Config: map[string]interface{}{"logging": ""}},
+		{ResourceType: "s3", ResourceID: "logged", Tags: map[string]string{"env": "prod"}, Config: map[string]interface{}{"logging": map[string]interface{}{"target_bucket": "logs"}}},
+	}
+	input := opa2.Input{ResourceID: "123456789012", ResourceType: opa2.AccountResourceType, AccountID: "123456789012", Provider: "AWS", ScannedAt: time.Now()}
+
+	outcome, findings, err := opa2.EvaluateAccount(opa2.ResolvePolicies("", []opa2.RegoPolicy{policy}, nil), nil, input, inventory)
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, &opa2.ResourceRef{Type: "s3", ID: "reports"}, findings[0].Resource)
+		assert.Equal(t, "account/unlogged", findings[0].Policy)
+	}
+
+	outcome, findings, err = opa2.EvaluateAccount(opa2.ResolvePolicies("", []opa2.RegoPolicy{policy}, nil), nil, input, inventory[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+	assert.Empty(t, findings)
+}
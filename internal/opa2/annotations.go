@@ -0,0 +1,239 @@
+package opa2
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/rs/zerolog/log"
+)
+
+// BenchmarkControl maps a rule to one control of a compliance benchmark, e.g. control 2.1.1 of
+// cis-aws-3.0.
+type BenchmarkControl struct {
+	Framework string `bson:"framework" json:"framework"`
+	Control   string `bson:"control" json:"control"`
+}
+
+// RuleMetadata documents a rule ID of a policy. It is read from the rule's # METADATA annotation
+// and joined into every finding with the same rule ID:
+//
+//	# METADATA
+//	# title: Bucket policy does not deny requests made without TLS.
+//	# description: Without a Deny on aws:SecureTransport objects can be read over plain HTTP.
+//	# related_resources:
+//	# - ref: https://docs.aws.amazon.com/AmazonS3/latest/userguide/security-best-practices.html
+//	# custom:
+//	#   rule_id: AWS-S3-103
+//	#   severity: medium
+//	#   remediation: Add a Deny statement for requests where aws:SecureTransport is false.
+//	#   benchmarks:
+//	#     cis-aws-3.0: ["2.1.1"]
+//
+// rule_id can be left out when the rule builds its finding with a literal rule_id.
+type RuleMetadata struct {
+	RuleID      string             `bson:"rule_id" json:"rule_id"`
+	Title       string             `bson:"title,omitempty" json:"title,omitempty"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Severity    Severity           `bson:"severity,omitempty" json:"severity,omitempty"`
+	Remediation string             `bson:"remediation,omitempty" json:"remediation,omitempty"`
+	References  []string           `bson:"references,omitempty" json:"references,omitempty"`
+	Benchmarks  []BenchmarkControl `bson:"benchmarks,omitempty" json:"benchmarks,omitempty"`
+}
+
+// ParsePolicyMetadata reads the rules of the policy's module into Rules, one per rule ID, with the
+// documentation of their # METADATA annotations, and the package annotation's description into
+// Description unless one is set. Rules are identified by custom.rule_id or by the literal rule_id of
+// the finding they build; rules with neither, e.g. helpers, are left out.
+func ParsePolicyMetadata(regoPolicy *RegoPolicy) error {
+	name := regoPolicy.Name + ".rego"
+	module, err := ast.ParseModuleWithOpts(name, regoPolicy.Rego, ast.ParserOptions{RegoVersion: ast.RegoV1, ProcessAnnotation: true})
+	if err != nil {
+		return policyError(name, err)
+	}
+
+	annotations, errs := ast.BuildAnnotationSet([]*ast.Module{module})
+	if len(errs) > 0 {
+		return policyError(name, errs)
+	}
+
+	ruleAnnotations := make(map[*ast.Rule]*ast.Annotations)
+	for _, ref := range annotations.Flatten() {
+		if rule := ref.GetRule(); rule != nil {
+			ruleAnnotations[rule] = ref.Annotations
+			continue
+		}
+		if regoPolicy.Description == "" {
+			regoPolicy.Description = ref.Annotations.Description
+			if regoPolicy.Description == "" {
+				regoPolicy.Description = ref.Annotations.Title
+			}
+		}
+	}
+
+	var rules []RuleMetadata
+	var problems []PolicyProblem
+	seen := make(map[string]int)
+	for _, rule := range module.Rules {
+		metadata := RuleMetadata{RuleID: findingRuleID(rule)}
+		if a, ok := ruleAnnotations[rule]; ok {
+			metadata, err = ruleMetadata(a, rule)
+			if err != nil {
+				problems = append(problems, PolicyProblem{Row: a.Location.Row, Col: a.Location.Col, Code: "rego_metadata_error", Message: err.Error()})
+				continue
+			}
+		}
+		if metadata.RuleID == "" {
+			continue
+		}
+
+		// a rule ID reported by several rules is documented by the first annotated one
+		if i, ok := seen[metadata.RuleID]; ok {
+			if rules[i].Title == "" {
+				rules[i] = metadata
+			}
+			continue
+		}
+		seen[metadata.RuleID] = len(rules)
+		rules = append(rules, metadata)
+	}
+	if len(problems) > 0 {
+		return &PolicyError{Name: name, Problems: problems}
+	}
+
+	regoPolicy.Rules = rules
+	return nil
+}
+
+func ruleMetadata(a *ast.Annotations, rule *ast.Rule) (RuleMetadata, error) {
+	metadata := RuleMetadata{
+		RuleID:      findingRuleID(rule),
+		Title:       a.Title,
+		Description: a.Description,
+	}
+
+	for _, resource := range a.RelatedResources {
+		metadata.References = append(metadata.References, resource.Ref.String())
+	}
+
+	for key, value := range a.Custom {
+		switch key {
+		case "rule_id":
+			ruleID, ok := value.(string)
+			if !ok {
+				return RuleMetadata{}, fmt.Errorf("custom.rule_id must be a string")
+			}
+			metadata.RuleID = ruleID
+		case "severity":
+			severity, ok := value.(string)
+			if !ok {
+				return RuleMetadata{}, fmt.Errorf("custom.severity must be a string")
+			}
+			parsed, err := ParseSeverity(severity)
+			if err != nil {
+				return RuleMetadata{}, fmt.Errorf("custom.severity: %w", err)
+			}
+			metadata.Severity = parsed
+		case "remediation":
+			remediation, ok := value.(string)
+			if !ok {
+				return RuleMetadata{}, fmt.Errorf("custom.remediation must be a string")
+			}
+			metadata.Remediation = remediation
+		case "benchmarks":
+			benchmarks, err := parseBenchmarks(value)
+			if err != nil {
+				return RuleMetadata{}, err
+			}
+			metadata.Benchmarks = benchmarks
+		}
+	}
+
+	return metadata, nil
+}
+
+// parseBenchmarks accepts a map of framework to a control or a list of controls.
+func parseBenchmarks(value interface{}) ([]BenchmarkControl, error) {
+	frameworks, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("custom.benchmarks must map frameworks to controls")
+	}
+
+	var benchmarks []BenchmarkControl
+	for framework, controls := range frameworks {
+		switch c := controls.(type) {
+		case string:
+			benchmarks = append(benchmarks, BenchmarkControl{Framework: framework, Control: c})
+		case []interface{}:
+			for _, control := range c {
+				s, ok := control.(string)
+				if !ok {
+					return nil, fmt.Errorf("custom.benchmarks.%s: controls must be strings, got %v", framework, control)
+				}
+				benchmarks = append(benchmarks, BenchmarkControl{Framework: framework, Control: s})
+			}
+		default:
+			return nil, fmt.Errorf("custom.benchmarks.%s: controls must be a string or a list of strings", framework)
+		}
+	}
+
+	sort.Slice(benchmarks, func(i, j int) bool {
+		if benchmarks[i].Framework != benchmarks[j].Framework {
+			return benchmarks[i].Framework < benchmarks[j].Framework
+		}
+		return benchmarks[i].Control < benchmarks[j].Control
+	})
+	return benchmarks, nil
+}
+
+// ruleID is the rule ID a rule reports findings under: custom.rule_id of its annotation, or the
+// literal rule_id of its finding.
+func ruleID(rule *ast.Rule) string {
+	for _, a := range rule.Annotations {
+		if id, ok := a.Custom["rule_id"].(string); ok {
+			return id
+		}
+	}
+	return findingRuleID(rule)
+}
+
+// findingRuleID returns the rule_id of the first object literal in the rule with a string rule_id.
+func findingRuleID(rule *ast.Rule) string {
+	ruleID := ""
+	ast.WalkTerms(rule, func(term *ast.Term) bool {
+		if ruleID != "" {
+			return true
+		}
+		obj, ok := term.Value.(ast.Object)
+		if !ok {
+			return false
+		}
+		if value := obj.Get(ast.StringTerm("rule_id")); value != nil {
+			if s, ok := value.Value.(ast.String); ok {
+				ruleID = string(s)
+				return true
+			}
+		}
+		return false
+	})
+	return ruleID
+}
+
+// policyRules indexes the policy's rule metadata by rule ID. Policies stored before annotations
+// were parsed have no Rules, so their module is parsed here instead.
+func policyRules(regoPolicy *RegoPolicy) map[string]RuleMetadata {
+	rules := regoPolicy.Rules
+	if rules == nil {
+		parsed := *regoPolicy
+		if err := ParsePolicyMetadata(&parsed); err != nil {
+			log.Warn().Err(err).Str("function", "policyRules").Str("policy", regoPolicy.Name).Msg("Failed to parse policy annotations")
+		}
+		rules = parsed.Rules
+	}
+
+	index := make(map[string]RuleMetadata, len(rules))
+	for _, rule := range rules {
+		index[rule.RuleID] = rule
+	}
+	return index
+}
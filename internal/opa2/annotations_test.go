@@ -0,0 +1,89 @@
+package opa2_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+const annotatedModule = `# METADATA
+# description: Public bucket checks.
+package s3
+
+# METADATA
+# title: Bucket is public.
+# description: Anyone can list the bucket.
+# related_resources:
+# - ref: https://example.com/public-buckets
+# custom:
+#   severity: critical
+#   remediation: Turn on Block Public Access.
+#   benchmarks:
+#     cis-aws-3.0: ["2.1.4"]
+#     internal: S3-1
+deny contains {"rule_id": "S3-PUBLIC"} if input.config.public
+
+# METADATA
+# title: Ignored, the rule sets its own.
+# custom:
+#   severity: low
+deny contains {"rule_id": "S3-ACL", "title": "Bucket ACL grants access to everyone.", "severity": "high"} if input.config.acl == "public-read"
+`
+
+func TestParsePolicyMetadata(t *testing.T) {
+	policy := &opa2.RegoPolicy{ResourceType: "s3", Name: "public", Query: "data.s3.deny", Rego: annotatedModule}
+
+	err := opa2.ParsePolicyMetadata(policy)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Public bucket checks.", policy.Description)
+	if assert.Len(t, policy.Rules, 2) {
+		assert.Equal(t, opa2.RuleMetadata{
+			RuleID:      "S3-PUBLIC",
+			Title:       "Bucket is public.",
+			Description: "Anyone can list the bucket.",
+			Severity:    opa2.SeverityCritical,
+			Remediation: "Turn on Block Public Access.",
+			References:  []string{"https://example.com/public-buckets"},
+			Benchmarks: []opa2.BenchmarkControl{
+				{Framework: "cis-aws-3.0", Control: "2.1.4"},
+				{Framework: "internal", Control: "S3-1"},
+			},
+		}, policy.Rules[0])
+		assert.Equal(t, "S3-ACL", policy.Rules[1].RuleID)
+	}
+}
+
+func TestEvaluateConfigJoinsRuleMetadata(t *testing.T) {
+	policy := &opa2.RegoPolicy{ResourceType: "s3", Name: "public", Query: "data.s3.deny", Rego: annotatedModule}
+
+	outcome, findings, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: map[string]interface{}{"public": true, "acl": "public-read"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, "S3-PUBLIC", findings[0].RuleID)
+		assert.Equal(t, "Bucket is public.", findings[0].Title)
+		assert.Equal(t, opa2.SeverityCritical, findings[0].Severity)
+		assert.Equal(t, "Turn on Block Public Access.", findings[0].Remediation)
+		assert.Len(t, findings[0].Benchmarks, 2)
+
+		// fields set by the rule win over the annotation
+		assert.Equal(t, "Bucket ACL grants access to everyone.", findings[1].Title)
+		assert.Equal(t, opa2.SeverityHigh, findings[1].Severity)
+	}
+}
+
+func TestParsePolicyMetadataRejectsUnknownSeverity(t *testing.T) {
+	module := "package s3\n\n# METADATA\n# custom:\n#   severity: severe\ndeny contains {\"rule_id\": \"S3-1\", \"title\": \"x\"} if input.config.public\n"
+
+	err := opa2.ParsePolicyMetadata(&opa2.RegoPolicy{ResourceType: "s3", Name: "s3", Rego: module})
+
+	var policyErr *opa2.PolicyError
+	if assert.True(t, errors.As(err, &policyErr)) {
+		assert.Equal(t, 3, policyErr.Problems[0].Row)
+		assert.Equal(t, "rego_metadata_error", policyErr.Problems[0].Code)
+	}
+}
@@ -0,0 +1,295 @@
+package opa2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/iampolicy"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/types"
+)
+
+// The woz.* built-ins give policies the cloud semantics that plain string comparisons of the
+// retrieved JSON miss, e.g. that Principal "*" and {"AWS": "*"} are the same principal:
+//
+//	woz.arn.parse(arn)                        {"partition", "service", "region", "account", "resource"}, undefined if arn is not an ARN
+//	woz.iam.action_matches(pattern, a)        whether an IAM action pattern such as "s3:Get*" covers action a, case-insensitively
+//	woz.aws.principals(principal)             the set of {"type", "id", "account"} a policy Principal names, see iampolicy.PrincipalID
+//	woz.iam.is_public(document)               whether a policy document grants access to everyone, see iampolicy.Document.IsPublic
+//	woz.iam.principals_for(document, action)  the set of principals a policy document lets perform action
+//	woz.iam.cross_account(document, account)  the set of principals outside account a policy document grants access to
+//	woz.net.cidr_is_public(cidr)              whether a CIDR or IP address covers any address outside private and reserved ranges
+//	woz.gcp.member(member)                    {"type", "id", "domain", "public"} of a GCP IAM member, see gcpMember
+//
+// Policy documents may be parsed or JSON strings; "" is a resource without a policy. They are
+// registered for evaluation, for ValidatePolicy and for the test runner alike, all of which are
+// restricted to capabilities.
+type builtin struct {
+	decl   *rego.Function
+	option func(*rego.Rego)
+}
+
+var (
+	stringMap    = types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))
+	principalSet = types.NewSet(stringMap)
+
+	arnParse = &rego.Function{
+		Name:        "woz.arn.parse",
+		Description: "Splits an ARN into its partition, service, region, account and resource.",
+		Decl:        types.NewFunction(types.Args(types.Named("arn", types.S)), types.Named("parts", stringMap)),
+	}
+	iamActionMatches = &rego.Function{
+		Name:        "woz.iam.action_matches",
+		Description: "Reports whether an IAM action pattern covers an action.",
+		Decl:        types.NewFunction(types.Args(types.Named("pattern", types.S), types.Named("action", types.S)), types.Named("result", types.B)),
+	}
+	awsPrincipals = &rego.Function{
+		Name:        "woz.aws.principals",
+		Description: "Normalizes the Principal of a policy statement to a set of principals.",
+		Decl:        types.NewFunction(types.Args(types.Named("principal", types.A)), types.Named("principals", principalSet)),
+	}
+	iamIsPublic = &rego.Function{
+		Name:        "woz.iam.is_public",
+		Description: "Reports whether a policy document grants access to everyone.",
+		Decl:        types.NewFunction(types.Args(types.Named("document", types.A)), types.Named("result", types.B)),
+	}
+	iamPrincipalsFor = &rego.Function{
+		Name:        "woz.iam.principals_for",
+		Description: "Lists the principals a policy document lets perform an action.",
+		Decl:        types.NewFunction(types.Args(types.Named("document", types.A), types.Named("action", types.S)), types.Named("principals", principalSet)),
+	}
+	iamCrossAccount = &rego.Function{
+		Name:        "woz.iam.cross_account",
+		Description: "Lists the principals outside an account a policy document grants access to.",
+		Decl:        types.NewFunction(types.Args(types.Named("document", types.A), types.Named("account", types.S)), types.Named("principals", principalSet)),
+	}
+	cidrIsPublic = &rego.Function{
+		Name:        "woz.net.cidr_is_public",
+		Description: "Reports whether a CIDR or IP address covers addresses outside private and reserved ranges.",
+		Decl:        types.NewFunction(types.Args(types.Named("cidr", types.S)), types.Named("result", types.B)),
+	}
+	gcpMemberFunc = &rego.Function{
+		Name:        "woz.gcp.member",
+		Description: "Classifies a GCP IAM member.",
+		Decl:        types.NewFunction(types.Args(types.Named("member", types.S)), types.Named("member", stringMap)),
+	}
+
+	builtins = []builtin{
+		{arnParse, rego.Function1(arnParse, func(_ rego.BuiltinContext, arn *ast.Term) (*ast.Term, error) {
+			s, err := stringOperand(arn, 1)
+			if err != nil {
+				return nil, err
+			}
+			parts, ok := iampolicy.ParseARN(s)
+			if !ok {
+				return nil, nil
+			}
+			return valueTerm(parts)
+		})},
+		{iamActionMatches, rego.Function2(iamActionMatches, func(_ rego.BuiltinContext, pattern, action *ast.Term) (*ast.Term, error) {
+			p, err := stringOperand(pattern, 1)
+			if err != nil {
+				return nil, err
+			}
+			a, err := stringOperand(action, 2)
+			if err != nil {
+				return nil, err
+			}
+			return ast.BooleanTerm(iampolicy.MatchAction(p, a)), nil
+		})},
+		{awsPrincipals, rego.Function1(awsPrincipals, func(_ rego.BuiltinContext, principal *ast.Term) (*ast.Term, error) {
+			value, err := ast.JSON(principal.Value)
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			// anything but "*" or principals by type names no principal
+			var p iampolicy.Principal
+			if err := json.Unmarshal(data, &p); err != nil {
+				return principalsTerm(nil)
+			}
+			return principalsTerm(p.IDs())
+		})},
+		{iamIsPublic, rego.Function1(iamIsPublic, func(_ rego.BuiltinContext, document *ast.Term) (*ast.Term, error) {
+			d, err := documentOperand(document, 1)
+			if err != nil {
+				return nil, err
+			}
+			return ast.BooleanTerm(d.IsPublic()), nil
+		})},
+		{iamPrincipalsFor, rego.Function2(iamPrincipalsFor, func(_ rego.BuiltinContext, document, action *ast.Term) (*ast.Term, error) {
+			d, err := documentOperand(document, 1)
+			if err != nil {
+				return nil, err
+			}
+			a, err := stringOperand(action, 2)
+			if err != nil {
+				return nil, err
+			}
+			return principalsTerm(d.PrincipalsFor(a, ""))
+		})},
+		{iamCrossAccount, rego.Function2(iamCrossAccount, func(_ rego.BuiltinContext, document, account *ast.Term) (*ast.Term, error) {
+			d, err := documentOperand(document, 1)
+			if err != nil {
+				return nil, err
+			}
+			a, err := stringOperand(account, 2)
+			if err != nil {
+				return nil, err
+			}
+			return principalsTerm(d.CrossAccountPrincipals(a))
+		})},
+		{cidrIsPublic, rego.Function1(cidrIsPublic, func(_ rego.BuiltinContext, cidr *ast.Term) (*ast.Term, error) {
+			s, err := stringOperand(cidr, 1)
+			if err != nil {
+				return nil, err
+			}
+			public, err := iampolicy.PublicCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+			return ast.BooleanTerm(public), nil
+		})},
+		{gcpMemberFunc, rego.Function1(gcpMemberFunc, func(_ rego.BuiltinContext, member *ast.Term) (*ast.Term, error) {
+			s, err := stringOperand(member, 1)
+			if err != nil {
+				return nil, err
+			}
+			return valueTerm(gcpMember(s))
+		})},
+	}
+)
+
+// builtinOptions registers the woz.* built-ins with a rego.Rego.
+func builtinOptions() []func(*rego.Rego) {
+	options := make([]func(*rego.Rego), 0, len(builtins))
+	for _, b := range builtins {
+		options = append(options, b.option)
+	}
+	return options
+}
+
+// builtinDecls declares the woz.* built-ins to a compiler.
+func builtinDecls() map[string]*ast.Builtin {
+	decls := make(map[string]*ast.Builtin, len(builtins))
+	for _, b := range builtins {
+		decls[b.decl.Name] = &ast.Builtin{Name: b.decl.Name, Description: b.decl.Description, Decl: b.decl.Decl}
+	}
+	return decls
+}
+
+// capabilities are OPA's built-ins, less the non-deterministic ones, plus the woz.* built-ins.
+// Policies are written by clients and run with the scanner's network access, so they must not make
+// requests (http.send, net.lookup_ip_addr), read the runtime's config and environment (opa.runtime)
+// or depend on when and how often they run (time.now_ns, rand.intn, uuid.rfc4122, the io.jwt
+// signing and verifying built-ins). An empty AllowNet also keeps any network built-in from
+// reaching a host.
+func capabilities() *ast.Capabilities {
+	caps := ast.CapabilitiesForThisVersion()
+	allowed := make([]*ast.Builtin, 0, len(caps.Builtins)+len(builtins))
+	for _, b := range caps.Builtins {
+		if !b.Nondeterministic {
+			allowed = append(allowed, b)
+		}
+	}
+	for _, decl := range builtinDecls() {
+		allowed = append(allowed, decl)
+	}
+	caps.Builtins = allowed
+	caps.AllowNet = []string{}
+	return caps
+}
+
+func stringOperand(term *ast.Term, pos int) (string, error) {
+	s, ok := term.Value.(ast.String)
+	if !ok {
+		return "", fmt.Errorf("operand %d must be a string but got %s", pos, ast.ValueName(term.Value))
+	}
+	return string(s), nil
+}
+
+// documentOperand reads a policy document, parsed or as its JSON. Configs hold "" for resources
+// without a policy, which is an empty document.
+func documentOperand(term *ast.Term, pos int) (*iampolicy.Document, error) {
+	value, err := ast.JSON(term.Value)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return &iampolicy.Document{}, nil
+	}
+
+	document, err := iampolicy.FromValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("operand %d: %w", pos, err)
+	}
+	return document, nil
+}
+
+func principalsTerm(principals []iampolicy.PrincipalID) (*ast.Term, error) {
+	set := ast.NewSet()
+	for _, principal := range principals {
+		term, err := valueTerm(principal)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(term)
+	}
+	return ast.NewTerm(set), nil
+}
+
+func valueTerm(x interface{}) (*ast.Term, error) {
+	value, err := ast.InterfaceToValue(x)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewTerm(value), nil
+}
+
+// gcpMember classifies a GCP IAM member such as "user:ann@example.com". The type is the member's
+// prefix in snake case, e.g. service_account, or all_users and all_authenticated_users for the
+// public members, which are the ones with public set. Members of a deleted principal have the type
+// deleted. Domain is the domain of an email address or of a domain: member.
+func gcpMember(member string) map[string]interface{} {
+	switch member {
+	case "allUsers":
+		return map[string]interface{}{"type": "all_users", "id": member, "domain": "", "public": true}
+	case "allAuthenticatedUsers":
+		return map[string]interface{}{"type": "all_authenticated_users", "id": member, "domain": "", "public": true}
+	}
+
+	prefix, id, found := strings.Cut(member, ":")
+	if !found {
+		return map[string]interface{}{"type": "unknown", "id": member, "domain": "", "public": false}
+	}
+
+	memberType := "unknown"
+	switch prefix {
+	case "user", "group", "domain", "principal", "deleted":
+		memberType = prefix
+	case "serviceAccount":
+		memberType = "service_account"
+	case "principalSet":
+		memberType = "principal_set"
+	case "projectOwner", "projectEditor", "projectViewer":
+		memberType = "project_" + strings.ToLower(strings.TrimPrefix(prefix, "project"))
+	}
+
+	domain := ""
+	switch memberType {
+	case "domain":
+		domain = id
+	case "user", "group", "service_account":
+		if _, after, ok := strings.Cut(id, "@"); ok {
+			domain = strings.ToLower(after)
+		}
+	}
+
+	return map[string]interface{}{"type": memberType, "id": id, "domain": domain, "public": false}
+}
@@ -0,0 +1,76 @@
+package opa2_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"arn", `woz.arn.parse("arn:aws:iam::123456789012:role/app/reader")`, map[string]interface{}{"partition": "aws", "service": "iam", "region": "", "account": "123456789012", "resource": "role/app/reader"}},
+		{"not an arn", `[parts | parts := woz.arn.parse("123456789012")]`, []interface{}{}},
+		{"action wildcard", `woz.iam.action_matches("s3:Get*", "s3:GetObject")`, true},
+		{"action case", `woz.iam.action_matches("S3:getobject", "s3:GetObject")`, true},
+		{"action single character", `woz.iam.action_matches("s3:?etObject", "s3:PutObject")`, false},
+		{"action other service", `woz.iam.action_matches("s3:*", "s3express:CreateSession")`, false},
+		{"principal star", `woz.aws.principals("*")`, []interface{}{map[string]interface{}{"type": "AWS", "id": "*", "account": "*"}}},
+		{"principal aws star", `woz.aws.principals({"AWS": "*"})`, []interface{}{map[string]interface{}{"type": "AWS", "id": "*", "account": "*"}}},
+		{"principal list", `woz.aws.principals({"AWS": ["123456789012", "arn:aws:iam::999999999999:role/x"], "Service": "cloudtrail.amazonaws.com"})`, []interface{}{
+			map[string]interface{}{"type": "AWS", "id": "arn:aws:iam::123456789012:root", "account": "123456789012"},
+			map[string]interface{}{"type": "AWS", "id": "arn:aws:iam::999999999999:role/x", "account": "999999999999"},
+			map[string]interface{}{"type": "Service", "id": "cloudtrail.amazonaws.com", "account": ""},
+		}},
+		{"document public", `woz.iam.is_public({"Statement": [{"Effect": "Allow", "NotPrincipal": {"AWS": "123456789012"}, "Action": "sqs:SendMessage"}]})`, true},
+		{"document limited to an organization", `woz.iam.is_public("{\"Statement\": {\"Effect\": \"Allow\", \"Principal\": \"*\", \"Action\": \"kms:Decrypt\", \"Condition\": {\"StringEquals\": {\"aws:PrincipalOrgID\": \"o-abc\"}}}}")`, false},
+		{"no document", `woz.iam.is_public("")`, false},
+		{"principals for", `woz.iam.principals_for({"Statement": [{"Effect": "Allow", "Principal": {"AWS": "123456789012"}, "NotAction": "s3:Delete*", "Resource": "*"}]}, "s3:GetObject")`, []interface{}{
+			map[string]interface{}{"type": "AWS", "id": "arn:aws:iam::123456789012:root", "account": "123456789012"},
+		}},
+		{"cross account", `woz.iam.cross_account({"Statement": [{"Effect": "Allow", "Principal": {"AWS": ["123456789012", "arn:aws:iam::999999999999:role/x"]}, "Action": "s3:GetObject"}]}, "123456789012")`, []interface{}{
+			map[string]interface{}{"type": "AWS", "id": "arn:aws:iam::999999999999:role/x", "account": "999999999999"},
+		}},
+		{"cidr everything", `woz.net.cidr_is_public("0.0.0.0/0")`, true},
+		{"cidr private", `woz.net.cidr_is_public("10.1.0.0/16")`, false},
+		{"cidr spans private", `woz.net.cidr_is_public("10.0.0.0/7")`, true},
+		{"cidr address", `woz.net.cidr_is_public("52.95.110.1")`, true},
+		{"cidr ipv6 unique local", `woz.net.cidr_is_public("fd00::/8")`, false},
+		{"gcp all users", `woz.gcp.member("allUsers")`, map[string]interface{}{"type": "all_users", "id": "allUsers", "domain": "", "public": true}},
+		{"gcp service account", `woz.gcp.member("serviceAccount:app@acme-prod.iam.gserviceaccount.com")`, map[string]interface{}{"type": "service_account", "id": "app@acme-prod.iam.gserviceaccount.com", "domain": "acme-prod.iam.gserviceaccount.com", "public": false}},
+		{"gcp domain", `woz.gcp.member("domain:acme.com")`, map[string]interface{}{"type": "domain", "id": "acme.com", "domain": "acme.com", "public": false}},
+		{"gcp project role", `woz.gcp.member("projectViewer:acme-prod")`, map[string]interface{}{"type": "project_viewer", "id": "acme-prod", "domain": "", "public": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &opa2.RegoPolicy{ResourceType: "test", Name: "builtins", Query: "data.builtins.deny", Rego: "package builtins\n\ndeny contains {\"rule_id\": \"X\", \"title\": \"x\", \"evidence\": {\"value\": " + tt.expr + "}}\n"}
+			assert.NoError(t, opa2.ValidatePolicy(policy))
+
+			_, findings, err := opa2.EvaluateConfig(policy, nil, opa2.Input{})
+			assert.NoError(t, err)
+			if assert.Len(t, findings, 1) {
+				if expected, ok := tt.expected.([]interface{}); ok {
+					assert.ElementsMatch(t, expected, findings[0].Evidence["value"])
+				} else {
+					assert.Equal(t, tt.expected, findings[0].Evidence["value"])
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePolicyChecksBuiltinArguments(t *testing.T) {
+	policy := &opa2.RegoPolicy{ResourceType: "test", Name: "builtins", Query: "data.builtins.deny", Rego: "package builtins\n\ndeny contains \"x\" if woz.iam.action_matches(\"s3:*\")\n"}
+
+	err := opa2.ValidatePolicy(policy)
+
+	var policyErr *opa2.PolicyError
+	if assert.ErrorAs(t, err, &policyErr) {
+		assert.Equal(t, "rego_type_error", policyErr.Problems[0].Code)
+	}
+}
@@ -0,0 +1,175 @@
+package opa2
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// watchRetryDelay is how long Watch waits before reopening a failed change stream.
+const watchRetryDelay = 30 * time.Second
+
+// DefaultPolicyCacheSize bounds DefaultPolicyCache: enough for every embedded policy with the params
+// of a few dozen clients, while a Lambda scanning many clients does not hold each one's compiled
+// policies for its lifetime.
+const DefaultPolicyCacheSize = 512
+
+type policyKey struct {
+	id     bson.ObjectID // of the policy version, each version being a document of its own
+	params string        // Params.Hash of the data the policy was prepared with
+}
+
+// compiledPolicy is a prepared query and the rule metadata joined into its findings.
+type compiledPolicy struct {
+	query rego.PreparedEvalQuery
+	rules map[string]RuleMetadata
+}
+
+type cacheEntry struct {
+	key      policyKey
+	policy   string // resource type and name the version belongs to
+	compiled compiledPolicy
+}
+
+// PolicyCache holds compiled policies keyed by the ID of the policy version and the client params,
+// so a module is compiled once per version and parameter document instead of once per resource
+// config. A new version of a policy is stored as a new document and a stored module is never
+// rewritten, so an entry cannot go stale; compiling a version drops the other versions of its
+// policy. It holds at most size policies and evicts the least recently used one to make room.
+type PolicyCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[policyKey]*list.Element // values are *cacheEntry
+	lru     *list.List                  // most recently used first
+}
+
+// DefaultPolicyCache is shared by every scan in the process, and so across warm Lambda invocations.
+var DefaultPolicyCache = NewPolicyCache(DefaultPolicyCacheSize)
+
+func NewPolicyCache(size int) *PolicyCache {
+	return &PolicyCache{
+		size:    size,
+		entries: make(map[policyKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the policy compiled with params as data.params, preparing it on a miss. Policies
+// that were never stored have no ID to key on and are prepared every time.
+func (c *PolicyCache) Get(regoPolicy *RegoPolicy, params Params) (rego.PreparedEvalQuery, error) {
+	compiled, err := c.get(regoPolicy, params)
+	return compiled.query, err
+}
+
+func (c *PolicyCache) get(regoPolicy *RegoPolicy, params Params) (compiledPolicy, error) {
+	if regoPolicy.ID.IsZero() {
+		return compilePolicy(regoPolicy, params)
+	}
+
+	paramsHash, err := params.Hash()
+	if err != nil {
+		return compiledPolicy{}, err
+	}
+	key := policyKey{id: regoPolicy.ID, params: paramsHash}
+	policy := regoPolicy.ResourceType + "/" + regoPolicy.Name
+
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(element)
+	}
+	c.mu.Unlock()
+	if ok {
+		return element.Value.(*cacheEntry).compiled, nil
+	}
+
+	compiled, err := compilePolicy(regoPolicy, params)
+	if err != nil {
+		return compiledPolicy{}, err
+	}
+
+	c.mu.Lock()
+	// only the version being evaluated is kept, for every client's params: the others were
+	// replaced by it or, while a draft is tried out, will be compiled again when needed
+	for existing, element := range c.entries {
+		if existing.id != key.id && element.Value.(*cacheEntry).policy == policy {
+			c.remove(existing)
+		}
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, policy: policy, compiled: compiled})
+	}
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back().Value.(*cacheEntry).key)
+	}
+	c.mu.Unlock()
+
+	log.Debug().Str("function", "PolicyCache.Get").Str("policyID", regoPolicy.ID.Hex()).Int("version", regoPolicy.Version).Msg("Compiled policy cached")
+	return compiled, nil
+}
+
+// remove drops one entry; c.mu must be held.
+func (c *PolicyCache) remove(key policyKey) {
+	c.lru.Remove(c.entries[key])
+	delete(c.entries, key)
+}
+
+func compilePolicy(regoPolicy *RegoPolicy, params Params) (compiledPolicy, error) {
+	query, err := PreparePolicy(regoPolicy, params)
+	if err != nil {
+		return compiledPolicy{}, err
+	}
+	return compiledPolicy{query: query, rules: policyRules(regoPolicy)}, nil
+}
+
+// Invalidate drops the policy version with the ID, for every client's params.
+func (c *PolicyCache) Invalidate(id bson.ObjectID) {
+	c.mu.Lock()
+	for key := range c.entries {
+		if key.id == id {
+			c.remove(key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *PolicyCache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[policyKey]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+func (c *PolicyCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Watch invalidates cached policies as the rego collection changes, until ctx is done. Change
+// streams need a replica set; when the stream cannot be opened or breaks, the whole cache is purged
+// and the stream reopened after a delay. As stored modules never change, the stream only frees the
+// versions that were retired or replaced sooner.
+func (c *PolicyCache) Watch(ctx context.Context, regoRepo RegoRepository) {
+	for {
+		err := regoRepo.Watch(ctx, c.Invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Str("function", "PolicyCache.Watch").Msg("Rego change stream stopped, purging policy cache")
+		c.Purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package opa2_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func s3Policy(t testing.TB) *opa2.RegoPolicy {
+	module, err := os.ReadFile("policies/aws/s3.rego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &opa2.RegoPolicy{ResourceType: "s3", Name: "aws/s3", Query: "data.s3.deny", Rego: string(module), Version: 1}
+}
+
+func s3Configs(n int) []map[string]interface{} {
+	configs := make([]map[string]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		principal := "*"
+		if i%2 == 0 {
+			principal = fmt.Sprintf("arn:aws:iam::123456789012:role/reader-%d", i)
+		}
+		configs = append(configs, map[string]interface{}{
+			"bucket_policy": map[string]interface{}{
+				"Statement": []interface{}{
+					map[string]interface{}{"Effect": "Allow", "Principal": principal, "Action": "s3:GetObject"},
+				},
+			},
+		})
+	}
+	return configs
+}
+
+func TestPolicyCacheKeepsLatestVersion(t *testing.T) {
+	cache := opa2.NewPolicyCache(opa2.DefaultPolicyCacheSize)
+	policy := s3Policy(t)
+	policy.ID = bson.NewObjectID()
+
+	_, err := cache.Get(policy, nil)
+	assert.NoError(t, err)
+	_, err = cache.Get(policy, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+
+	// every version is a document of its own
+	next := s3Policy(t)
+	next.ID = bson.NewObjectID()
+	next.Version = 2
+	_, err = cache.Get(next, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+
+	other := s3Policy(t)
+	other.ID = bson.NewObjectID()
+	other.Name = "acme/s3"
+	_, err = cache.Get(other, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Invalidate(next.ID)
+	assert.Equal(t, 1, cache.Len())
+
+	unsaved := s3Policy(t)
+	_, err = cache.Get(unsaved, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+}
+
+// BenchmarkEvaluateConfigUncached compiles the module for every config, as every scan did before
+// the policy cache.
+func BenchmarkEvaluateConfigUncached(b *testing.B) {
+	policy := s3Policy(b)
+	configs := s3Configs(100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, config := range configs {
+			if _, _, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: config}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEvaluateConfigCached(b *testing.B) {
+	policy := s3Policy(b)
+	policy.ID = bson.NewObjectID()
+	configs := s3Configs(100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, config := range configs {
+			if _, _, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: config}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package opa2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityHigh     Severity = "high"
+	SeverityMedium   Severity = "medium"
+	SeverityLow      Severity = "low"
+	SeverityInfo     Severity = "info"
+)
+
+// Rank orders severities from info (0) to critical (4), for sorting and thresholds.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityCritical:
+		return 4
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func ParseSeverity(value string) (Severity, error) {
+	severity := Severity(strings.ToLower(strings.TrimSpace(value)))
+	switch severity {
+	case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo:
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity %q", value)
+}
+
+// Finding is one violation reported by a policy's deny rule for a resource.
+type Finding struct {
+	RuleID      string                 `bson:"rule_id" json:"rule_id"`
+	Title       string                 `bson:"title" json:"title"`
+	Severity    Severity               `bson:"severity" json:"severity"`
+	Description string                 `bson:"description,omitempty" json:"description,omitempty"`
+	Remediation string                 `bson:"remediation,omitempty" json:"remediation,omitempty"`
+	References  []string               `bson:"references,omitempty" json:"references,omitempty"`
+	Benchmarks  []BenchmarkControl     `bson:"benchmarks,omitempty" json:"benchmarks,omitempty"`
+	Evidence    map[string]interface{} `bson:"evidence,omitempty" json:"evidence,omitempty"`
+	Policy      string                 `bson:"policy,omitempty" json:"policy,omitempty"` // name of the policy that reported it, set by the scanner
+	RiskScore   int                    `bson:"risk_score" json:"-"`                      // see RiskScore, set by the scanner
+	Resource    *ResourceRef           `bson:"-" json:"resource,omitempty"`              // resource an account-scope finding is about, see AccountResourceType
+	Suppression *SuppressionRef        `bson:"suppression,omitempty" json:"-"`           // suppression that accepted it, see ScanResult.Suppressed
+}
+
+// ResourceRef names a resource of the job inventory.
+type ResourceRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// ParseFindings converts the value of a deny rule into findings. Deny rules are expected to be sets
+// of objects with rule_id, title and severity; sets of plain messages and the older partial-object
+// form (deny[msg]) are still accepted and become medium findings without a rule ID.
+func ParseFindings(value interface{}) ([]Finding, error) {
+	return parseFindings(value, nil)
+}
+
+// parseFindings is ParseFindings joining the rule metadata of the policy into each finding: fields
+// the deny rule sets win, the annotation fills in the rest.
+func parseFindings(value interface{}, rules map[string]RuleMetadata) ([]Finding, error) {
+	var entries []interface{}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		entries = v
+	case map[string]interface{}:
+		for msg := range v {
+			entries = append(entries, msg)
+		}
+	default:
+		return nil, fmt.Errorf("deny must be a set, got %T", value)
+	}
+
+	findings := make([]Finding, 0, len(entries))
+	for _, entry := range entries {
+		finding, err := parseFinding(entry, rules)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+
+	SortFindings(findings)
+	return findings, nil
+}
+
+func parseFinding(entry interface{}, rules map[string]RuleMetadata) (Finding, error) {
+	switch v := entry.(type) {
+	case string:
+		return Finding{Title: v, Severity: SeverityMedium}, nil
+	case map[string]interface{}:
+		// round trip through JSON so the tags above define the accepted fields
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return Finding{}, fmt.Errorf("failed to encode finding: %w", err)
+		}
+
+		var finding Finding
+		if err := json.Unmarshal(raw, &finding); err != nil {
+			return Finding{}, fmt.Errorf("invalid finding %s: %w", raw, err)
+		}
+		if metadata, ok := rules[finding.RuleID]; ok && finding.RuleID != "" {
+			joinRuleMetadata(&finding, metadata)
+		}
+		if finding.Title == "" {
+			return Finding{}, fmt.Errorf("finding %s has no title", raw)
+		}
+		if finding.Resource != nil && (finding.Resource.Type == "" || finding.Resource.ID == "") {
+			return Finding{}, fmt.Errorf("finding %s: resource needs a type and an id", raw)
+		}
+
+		if finding.Severity == "" {
+			finding.Severity = SeverityMedium
+		} else if finding.Severity, err = ParseSeverity(string(finding.Severity)); err != nil {
+			return Finding{}, fmt.Errorf("finding %s: %w", finding.RuleID, err)
+		}
+
+		return finding, nil
+	default:
+		return Finding{}, fmt.Errorf("finding must be an object or a string, got %T", entry)
+	}
+}
+
+func joinRuleMetadata(finding *Finding, metadata RuleMetadata) {
+	if finding.Title == "" {
+		finding.Title = metadata.Title
+	}
+	if finding.Severity == "" {
+		finding.Severity = metadata.Severity
+	}
+	if finding.Description == "" {
+		finding.Description = metadata.Description
+	}
+	if finding.Remediation == "" {
+		finding.Remediation = metadata.Remediation
+	}
+	if len(finding.References) == 0 {
+		finding.References = metadata.References
+	}
+	if len(finding.Benchmarks) == 0 {
+		finding.Benchmarks = metadata.Benchmarks
+	}
+}
+
+// SortFindings orders findings by severity, most severe first, then by rule ID.
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity.Rank() != findings[j].Severity.Rank() {
+			return findings[i].Severity.Rank() > findings[j].Severity.Rank()
+		}
+		if findings[i].RuleID != findings[j].RuleID {
+			return findings[i].RuleID < findings[j].RuleID
+		}
+		return findings[i].Title < findings[j].Title
+	})
+}
+
+// MaxSeverity is the severity of the most severe finding, or "" when there are none.
+func MaxSeverity(findings []Finding) Severity {
+	var max Severity
+	for _, finding := range findings {
+		if max == "" || finding.Severity.Rank() > max.Rank() {
+			max = finding.Severity
+		}
+	}
+	return max
+}
@@ -0,0 +1,137 @@
+package opa2_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateConfigReturnsStructuredFindings(t *testing.T) {
+	module, err := os.ReadFile("policies/aws/s3.rego")
+	assert.NoError(t, err)
+
+	policy := &opa2.RegoPolicy{ResourceType: "s3", Query: "data.s3.deny", Rego: string(module)}
+	config := map[string]interface{}{
+		"bucket_policy": map[string]interface{}{
+			"Statement": []interface{}{
+				map[string]interface{}{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject"},
+			},
+		},
+	}
+
+	outcome, findings, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: config})
+
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, "AWS-S3-003", findings[0].RuleID)
+		assert.Equal(t, opa2.SeverityCritical, findings[0].Severity)
+		assert.Equal(t, "AWS-S3-001", findings[1].RuleID)
+		assert.Equal(t, opa2.SeverityHigh, findings[1].Severity)
+		assert.NotEmpty(t, findings[1].Remediation)
+		assert.Contains(t, findings[1].Evidence, "statement")
+	}
+	assert.Equal(t, opa2.SeverityCritical, opa2.MaxSeverity(findings))
+}
+
+func TestParseFindingsAcceptsLegacyMessages(t *testing.T) {
+	findings, err := opa2.ParseFindings(map[string]interface{}{"Bucket is public": true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []opa2.Finding{{Title: "Bucket is public", Severity: opa2.SeverityMedium}}, findings)
+}
+
+func TestParseFindingsRejectsUnknownSeverity(t *testing.T) {
+	_, err := opa2.ParseFindings([]interface{}{
+		map[string]interface{}{"rule_id": "X-1", "title": "bad", "severity": "urgent"},
+	})
+
+	assert.ErrorContains(t, err, `unknown severity "urgent"`)
+}
+
+func TestEvaluateConfigOutcomes(t *testing.T) {
+	module := `package s3
+
+deny contains "public" if input.config.public
+
+deny contains "unreadable" if input.config.policy == concat("", input.config.broken)
+`
+	policy := &opa2.RegoPolicy{ResourceType: "s3", Query: "data.s3.deny", Rego: module}
+
+	outcome, findings, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: map[string]interface{}{"public": false}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+	assert.Empty(t, findings)
+
+	outcome, findings, err = opa2.EvaluateConfig(policy, nil, opa2.Input{Config: map[string]interface{}{"public": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	assert.Len(t, findings, 1)
+
+	outcome, _, err = opa2.EvaluateConfig(policy, nil, opa2.Input{Config: map[string]interface{}{"policy": "x", "broken": 42}})
+	assert.Error(t, err)
+	assert.Equal(t, opa2.OutcomeError, outcome)
+
+	undefined := &opa2.RegoPolicy{ResourceType: "s3", Query: "data.s3.missing", Rego: module}
+	outcome, _, err = opa2.EvaluateConfig(undefined, nil, opa2.Input{Config: map[string]interface{}{}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeNotApplicable, outcome)
+
+	broken := &opa2.RegoPolicy{ResourceType: "s3", Query: "data.s3.deny", Rego: "package s3\ndeny {"}
+	outcome, _, err = opa2.EvaluateConfig(broken, nil, opa2.Input{Config: map[string]interface{}{}})
+	assert.Error(t, err)
+	assert.Equal(t, opa2.OutcomeError, outcome)
+}
+
+func TestEvaluatePoliciesMergesFindings(t *testing.T) {
+	public := opa2.RegoPolicy{ResourceType: "s3", Name: "public", Query: "data.s3.public.deny", Rego: `package s3.public
+
+deny contains {"rule_id": "S3-PUB", "title": "public", "severity": "low"} if input.config.public
+`}
+	versioning := opa2.RegoPolicy{ResourceType: "s3", Name: "versioning", Query: "data.s3.versioning.deny", Rego: `package s3.versioning
+
+deny contains {"rule_id": "S3-VER", "title": "unversioned", "severity": "high"} if not input.config.versioned
+`}
+	broken := opa2.RegoPolicy{ResourceType: "s3", Name: "broken", Query: "data.s3.broken.deny", Rego: "package s3.broken\ndeny {"}
+
+	outcome, findings, err := opa2.EvaluatePolicies(opa2.ResolvePolicies("", []opa2.RegoPolicy{public, versioning}, nil), nil, opa2.Input{Config: map[string]interface{}{"public": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, "S3-VER", findings[0].RuleID)
+		assert.Equal(t, "S3-PUB", findings[1].RuleID)
+	}
+
+	outcome, _, err = opa2.EvaluatePolicies(opa2.ResolvePolicies("", []opa2.RegoPolicy{public, versioning}, nil), nil, opa2.Input{Config: map[string]interface{}{"versioned": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+
+	outcome, findings, err = opa2.EvaluatePolicies(opa2.ResolvePolicies("", []opa2.RegoPolicy{broken, public}, nil), nil, opa2.Input{Config: map[string]interface{}{"public": true}})
+	assert.ErrorContains(t, err, "policy broken")
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	assert.Len(t, findings, 1)
+
+	outcome, _, err = opa2.EvaluatePolicies(opa2.ResolvePolicies("", []opa2.RegoPolicy{broken, public}, nil), nil, opa2.Input{Config: map[string]interface{}{}})
+	assert.Error(t, err)
+	assert.Equal(t, opa2.OutcomeError, outcome)
+}
+
+func TestEvaluatePoliciesDoesNotRetryPermanentErrors(t *testing.T) {
+	conflict := opa2.RegoPolicy{ResourceType: "s3", Name: "conflict", Query: "data.s3.conflict.deny", Rego: `package s3.conflict
+
+owner := "a"
+owner := "b" if input.config.public
+
+deny contains owner
+`}
+
+	start := time.Now()
+	outcome, _, err := opa2.EvaluatePolicies(opa2.ResolvePolicies("", []opa2.RegoPolicy{conflict}, nil), nil, opa2.Input{Config: map[string]interface{}{"public": true}})
+
+	assert.ErrorContains(t, err, "eval_conflict_error")
+	assert.Equal(t, opa2.OutcomeError, outcome)
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "a conflict fails the same way every time and is not retried")
+}
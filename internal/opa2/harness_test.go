@@ -0,0 +1,341 @@
+package opa2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/cover"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/tester"
+)
+
+// PolicyFixture is a sample resource config and what the policies of its resource type are
+// expected to make of it. Fixtures are read from one JSON array per resource type, named after it,
+// e.g. testdata/fixtures/s3.json. The policies see the fixture as the input of a resource named
+// after it, see Input. Account-scope fixtures, in account.json, also list the inventory the
+// policies see as data.inventory, see AccountResourceType.
+type PolicyFixture struct {
+	Name         string                                       `json:"name"`
+	ResourceType string                                       `json:"-"`
+	Region       string                                       `json:"region,omitempty"`
+	Tags         map[string]string                            `json:"tags,omitempty"`
+	Config       map[string]interface{}                       `json:"config"`
+	Params       Params                                       `json:"params,omitempty"`    // the client params the policies see as data.params
+	Inventory    map[string]map[string]map[string]interface{} `json:"inventory,omitempty"` // configs by resource type and ID, for account-scope fixtures
+	Outcome      Outcome                                      `json:"outcome"`
+	RuleIDs      []string                                     `json:"rule_ids"` // every rule ID expected in the findings, in any order
+}
+
+// PolicyTestResult is the result of one test_ rule of a _test.rego file.
+type PolicyTestResult struct {
+	File    string
+	Name    string
+	Pass    bool
+	Message string
+}
+
+// FixtureResult is what the policies actually made of a fixture.
+type FixtureResult struct {
+	Fixture PolicyFixture
+	Outcome Outcome
+	RuleIDs []string
+	Err     error
+}
+
+// Pass reports whether the fixture got the expected outcome and exactly the expected rule IDs.
+func (r FixtureResult) Pass() bool {
+	expected := slices.Clone(r.Fixture.RuleIDs)
+	sort.Strings(expected)
+	return r.Outcome == r.Fixture.Outcome && slices.Equal(expected, r.RuleIDs)
+}
+
+// RuleCoverage is how much of one rule the tests and fixtures evaluated. RuleID is the rule_id of
+// the finding the rule builds, if any.
+type RuleCoverage struct {
+	File            string
+	Row             int
+	Rule            string
+	RuleID          string
+	CoveredLines    int
+	NotCoveredLines int
+}
+
+// Coverage is the percentage of the rule's lines that were evaluated.
+func (c RuleCoverage) Coverage() float64 {
+	total := c.CoveredLines + c.NotCoveredLines
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(c.CoveredLines) / float64(total)
+}
+
+// PolicyTestReport collects the results of RunPolicyTests.
+type PolicyTestReport struct {
+	Tests    []PolicyTestResult
+	Fixtures []FixtureResult
+	Coverage []RuleCoverage
+}
+
+// LoadFixtures reads every <resource type>.json file of a fixture tree.
+func LoadFixtures(tree fs.FS) ([]PolicyFixture, error) {
+	var fixtures []PolicyFixture
+
+	err := fs.WalkDir(tree, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(filePath) != ".json" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(tree, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		var table []PolicyFixture
+		if err := json.Unmarshal(data, &table); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+
+		resourceType := strings.TrimSuffix(path.Base(filePath), ".json")
+		for i := range table {
+			table[i].ResourceType = resourceType
+		}
+		fixtures = append(fixtures, table...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fixtures: %w", err)
+	}
+
+	return fixtures, nil
+}
+
+// RunPolicyTests runs the _test.rego files of a policy tree with the OPA test runner, evaluates
+// every fixture against the tree's policies of its resource type the way a scan merges them, and
+// reports the line coverage of each rule of the policies across both. Like the rest of this file
+// it is only built into the tests, which run it from TestRegoPolicies.
+func RunPolicyTests(ctx context.Context, tree fs.FS, fixtures []PolicyFixture) (*PolicyTestReport, error) {
+	modules, err := loadModules(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := LoadPolicyFiles(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := cover.New()
+	report := &PolicyTestReport{}
+
+	results, err := tester.NewRunner().
+		SetCompiler(ast.NewCompiler().WithCapabilities(capabilities()).WithDefaultRegoVersion(ast.RegoV1)).
+		SetDefaultRegoVersion(ast.RegoV1).
+		RaiseBuiltinErrors(true).
+		AddCustomBuiltins(testerBuiltins()).
+		SetCoverageQueryTracer(coverage).
+		Run(ctx, modules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rego tests: %w", err)
+	}
+	for result := range results {
+		report.Tests = append(report.Tests, testResult(result))
+	}
+
+	for _, file := range files {
+		if file.Err != nil {
+			return nil, file.Err
+		}
+	}
+
+	// policies are prepared once per resource type and params document, and account-scope
+	// policies once per fixture as every fixture has its own inventory
+	prepared := make(map[string][]preparedPolicy)
+	for _, fixture := range fixtures {
+		paramsHash, err := fixture.Params.Hash()
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", fixture.Name, err)
+		}
+		key := fixture.ResourceType + "/" + paramsHash
+		if fixture.ResourceType == AccountResourceType {
+			key += "/" + fixture.Name
+		}
+		if _, ok := prepared[key]; !ok {
+			prepared[key] = prepareFixturePolicies(ctx, files, fixture, coverage)
+		}
+
+		result := evaluatePolicies(prepared[key], fixture.input())
+
+		ruleIDs := make([]string, 0, len(result.findings))
+		for _, finding := range result.findings {
+			if !slices.Contains(ruleIDs, finding.RuleID) {
+				ruleIDs = append(ruleIDs, finding.RuleID)
+			}
+		}
+		sort.Strings(ruleIDs)
+
+		report.Fixtures = append(report.Fixtures, FixtureResult{Fixture: fixture, Outcome: result.outcome, RuleIDs: ruleIDs, Err: result.err})
+	}
+
+	policyModules := make(map[string]*ast.Module)
+	for _, file := range files {
+		policyModules[file.Path] = modules[file.Path]
+	}
+	report.Coverage = ruleCoverage(coverage.Report(policyModules), policyModules)
+
+	return report, nil
+}
+
+func (f PolicyFixture) input() Input {
+	return Input{ResourceID: f.Name, ResourceType: f.ResourceType, Region: f.Region, Tags: f.Tags, Config: f.Config}
+}
+
+func (f PolicyFixture) inventory() map[string]interface{} {
+	if f.ResourceType != AccountResourceType {
+		return nil
+	}
+
+	var configs []cloud.ResourceConfig
+	for resourceType, resources := range f.Inventory {
+		for resourceID, config := range resources {
+			configs = append(configs, cloud.ResourceConfig{ResourceType: resourceType, ResourceID: resourceID, Config: config})
+		}
+	}
+	return inventoryDocument(configs)
+}
+
+func prepareFixturePolicies(ctx context.Context, files []PolicyFile, fixture PolicyFixture, coverage *cover.Cover) []preparedPolicy {
+	data := policyData(fixture.Params, fixture.inventory())
+
+	var policies []preparedPolicy
+	for _, file := range files {
+		if file.Policy.ResourceType != fixture.ResourceType {
+			continue
+		}
+
+		policy := file.Policy
+		options := append([]func(*rego.Rego){
+			rego.Query(policy.Query),
+			rego.Module(file.Path, policy.Rego),
+			rego.Store(inmem.NewFromObject(data)),
+			rego.StrictBuiltinErrors(true),
+			rego.Capabilities(capabilities()),
+			rego.QueryTracer(coverage),
+		}, builtinOptions()...)
+		query, err := rego.New(options...).PrepareForEval(ctx)
+		policies = append(policies, preparedPolicy{policy: &policy, query: query, rules: policyRules(&policy), err: err})
+	}
+	return policies
+}
+
+// testerBuiltins registers the woz.* built-ins with the test runner.
+func testerBuiltins() []*tester.Builtin {
+	decls := builtinDecls()
+	testers := make([]*tester.Builtin, 0, len(builtins))
+	for _, b := range builtins {
+		testers = append(testers, &tester.Builtin{Decl: decls[b.decl.Name], Func: b.option})
+	}
+	return testers
+}
+
+func loadModules(tree fs.FS) (map[string]*ast.Module, error) {
+	modules := make(map[string]*ast.Module)
+
+	err := fs.WalkDir(tree, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(filePath) != ".rego" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(tree, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		module, err := ast.ParseModuleWithOpts(filePath, string(data), ast.ParserOptions{RegoVersion: ast.RegoV1, ProcessAnnotation: true})
+		if err != nil {
+			return policyError(filePath, err)
+		}
+		modules[filePath] = module
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rego modules: %w", err)
+	}
+
+	return modules, nil
+}
+
+func testResult(result *tester.Result) PolicyTestResult {
+	r := PolicyTestResult{
+		Name: result.Package + "." + result.Name,
+		Pass: result.Pass(),
+	}
+	if result.Location != nil {
+		r.File = result.Location.File
+	}
+
+	switch {
+	case result.Error != nil:
+		r.Message = result.Error.Error()
+	case result.Fail && result.FailedAt != nil:
+		r.Message = fmt.Sprintf("failed at %s:%d: %s", result.FailedAt.Location.File, result.FailedAt.Location.Row, result.FailedAt)
+	case result.Fail:
+		r.Message = "failed"
+	case result.Skip:
+		r.Message = "skipped"
+	}
+
+	return r
+}
+
+// ruleCoverage splits the per-file coverage report into one entry per rule, ordered by file and
+// line.
+func ruleCoverage(report cover.Report, modules map[string]*ast.Module) []RuleCoverage {
+	var rules []RuleCoverage
+
+	for file, module := range modules {
+		fileReport := report.Files[file]
+		for _, rule := range module.Rules {
+			c := RuleCoverage{
+				File:   file,
+				Row:    rule.Location.Row,
+				Rule:   rule.Head.Ref().String(),
+				RuleID: ruleID(rule),
+			}
+
+			last := rule.Location.Row + strings.Count(string(rule.Location.Text), "\n")
+			for row := rule.Location.Row; fileReport != nil && row <= last; row++ {
+				if fileReport.IsCovered(row) {
+					c.CoveredLines++
+				} else if fileReport.IsNotCovered(row) {
+					c.NotCoveredLines++
+				}
+			}
+
+			rules = append(rules, c)
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].File != rules[j].File {
+			return rules[i].File < rules[j].File
+		}
+		return rules[i].Row < rules[j].Row
+	})
+	return rules
+}
@@ -0,0 +1,111 @@
+package opa2
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// inputSchema is the JSON schema of Input. Policies are type checked against it when stored, so a
+// reference such as input.resource.tag fails to compile instead of never matching.
+//
+//go:embed schemas/input.json
+var inputSchema []byte
+
+// Input is the document every policy sees as input, for every provider:
+//
+//	{
+//	  "resource": {"id": "reports", "type": "s3", "region": "eu-west-1", "tags": {"env": "prod"}},
+//	  "config":   {"bucket_policy": {...}},
+//	  "account":  {"id": "123456789012", "provider": "AWS"},
+//	  "client":   {"id": "acme"},
+//	  "run":      {"discovery_job_id": "...", "scanned_at": "2025-01-01T00:00:00Z"}
+//	}
+//
+// See schemas/input.json.
+type Input struct {
+	ResourceID     string
+	ResourceType   string
+	Region         string
+	Tags           map[string]string
+	Config         map[string]interface{}
+	AccountID      string
+	Provider       string
+	ClientID       string
+	DiscoveryJobID bson.ObjectID
+	ScannedAt      time.Time
+}
+
+// NewInput builds the input of a retrieved resource config for a scan started at scannedAt.
+func NewInput(config cloud.ResourceConfig, scannedAt time.Time) Input {
+	return Input{
+		ResourceID:     config.ResourceID,
+		ResourceType:   config.ResourceType,
+		Region:         config.Region,
+		Tags:           config.Tags,
+		Config:         config.Config,
+		AccountID:      config.AccountID,
+		Provider:       config.Provider,
+		ClientID:       config.ClientID,
+		DiscoveryJobID: config.DiscoveryJobID,
+		ScannedAt:      scannedAt,
+	}
+}
+
+// document is the input as evaluated. Config is passed through as retrieved; absent values are
+// empty strings and objects so that policies never have to guard against undefined fields.
+func (i Input) document() map[string]interface{} {
+	tags := make(map[string]interface{}, len(i.Tags))
+	for key, value := range i.Tags {
+		tags[key] = value
+	}
+
+	config := i.Config
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+
+	scannedAt := ""
+	if !i.ScannedAt.IsZero() {
+		scannedAt = i.ScannedAt.UTC().Format(time.RFC3339)
+	}
+	jobID := ""
+	if !i.DiscoveryJobID.IsZero() {
+		jobID = i.DiscoveryJobID.Hex()
+	}
+
+	return map[string]interface{}{
+		"resource": map[string]interface{}{
+			"id":     i.ResourceID,
+			"type":   i.ResourceType,
+			"region": i.Region,
+			"tags":   tags,
+		},
+		"config":  config,
+		"account": map[string]interface{}{"id": i.AccountID, "provider": i.Provider},
+		"client":  map[string]interface{}{"id": i.ClientID},
+		"run":     map[string]interface{}{"discovery_job_id": jobID, "scanned_at": scannedAt},
+	}
+}
+
+// InputSchema returns the JSON schema of Input.
+func InputSchema() []byte {
+	return inputSchema
+}
+
+func inputSchemaSet() (*ast.SchemaSet, error) {
+	var schema interface{}
+	if err := json.Unmarshal(inputSchema, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse input schema: %w", err)
+	}
+
+	schemas := ast.NewSchemaSet()
+	schemas.Put(ast.SchemaRootRef, schema)
+	return schemas, nil
+}
@@ -0,0 +1,58 @@
+package opa2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestEvaluateConfigSeesInputEnvelope(t *testing.T) {
+	policy := &opa2.RegoPolicy{ID: bson.NewObjectID(), Version: 1, ResourceType: "s3", Name: "aws/s3-prod", Query: "data.s3.prod.deny", Rego: `package s3.prod
+
+deny contains {"rule_id": "S3-PROD", "title": "Production bucket outside the EU.", "evidence": {"bucket": input.resource.id, "job": input.run.discovery_job_id}} if {
+    input.account.provider == "AWS"
+    input.client.id == "acme"
+    input.resource.tags.env == "prod"
+    not startswith(input.resource.region, "eu-")
+    is_object(input.config.bucket_policy)
+    time.parse_rfc3339_ns(input.run.scanned_at) > 0
+}
+`}
+	assert.NoError(t, opa2.ValidatePolicy(policy))
+
+	jobID := bson.NewObjectID()
+	config := cloud.ResourceConfig{
+		DiscoveryJobID: jobID,
+		ClientID:       "acme",
+		AccountID:      "123456789012",
+		Provider:       "AWS",
+		ResourceType:   "s3",
+		ResourceID:     "reports",
+		Region:         "us-east-1",
+		Tags:           map[string]string{"env": "prod"},
+		Config:         map[string]interface{}{"bucket_policy": map[string]interface{}{"Statement": []interface{}{}}},
+	}
+
+	outcome, findings, err := opa2.EvaluateConfig(policy, nil, opa2.NewInput(config, time.Now()))
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, "reports", findings[0].Evidence["bucket"])
+		assert.Equal(t, jobID.Hex(), findings[0].Evidence["job"])
+	}
+
+	config.Region = "eu-west-1"
+	outcome, _, err = opa2.EvaluateConfig(policy, nil, opa2.NewInput(config, time.Now()))
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+
+	// a resource without tags still has an object to look them up in
+	config.Tags = nil
+	outcome, _, err = opa2.EvaluateConfig(policy, nil, opa2.NewInput(config, time.Now()))
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"sort"
+	"time"
 
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
 	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
@@ -13,6 +16,8 @@ import (
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/notify"
 
 	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/topdown"
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
@@ -20,155 +25,234 @@ import (
 //go:embed scanResultEmailTemplate.tmpl
 var tmplContent string
 
-func RunScan(configRepo awscloud.ConfigRepository, scanRepo ScanRepository, regoRepo RegoRepository, discoveryID bson.ObjectID, clientID string, accountID string, clientEmail string, provider string, resources []awscloud.ResourceDiscovery) error {
-	log.Info().Str("Discovery ID", discoveryID.Hex()).Msg("Starting misconfig scan")
-
-	for _, resource := range resources {
-		log.Info().Str("Discovery ID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Running misconfig scan")
-
-		configs, err := configRepo.FindByTypeAndJobID(resource.Name(), discoveryID)
-		if err != nil {
-			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to find config")
-			continue
-		}
-
-		// policyPaths, query, err := setupScan(resource.Name())
-		// if err != nil {
-		// 	log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get policy")
-		// 	continue
-		// }
-
-		regoPolicy, err := regoRepo.FindByResourceType(resource.Name())
-		if err != nil {
-			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get rego policy")
-			continue
-		}
-
-		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Str("Rego Query", regoPolicy.Query).Str("Rego Policy", regoPolicy.Rego).Msg("rego debug")
-
-		var scanResults []interface{}
-		var filteredResults []ScanResult
+const (
+	// maxEvaluationAttempts bounds how often a resource is evaluated before it is reported as an error
+	maxEvaluationAttempts = 3
+	evaluationRetryDelay  = 100 * time.Millisecond
+)
 
-		for _, config := range configs {
+// ConfigFinder is the part of the AWS and GCP config repositories the scanner needs.
+type ConfigFinder interface {
+	FindByTypeAndJobID(resourceType string, discoveryJobID bson.ObjectID) ([]cloud.ResourceConfig, error)
+}
 
-			log.Info().Str("function", "EvaluateConfig").Str("resource name", config.ResourceID).Msg("Running evaluation for specific resource")
+func RunScan(configRepo awscloud.ConfigRepository, scanRepo ScanRepository, regoRepo RegoRepository, paramsRepo ParamsRepository, overrideRepo OverrideRepository, suppressionRepo SuppressionRepository, firstSeen FirstSeen, sender notify.Sender, discoveryID bson.ObjectID, clientID string, accountID string, clientEmail string, provider string, resources []awscloud.ResourceDiscovery) error {
+	resourceTypes := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		resourceTypes = append(resourceTypes, resource.Name())
+	}
 
-			misconfigResult, err := EvaluateConfig(regoPolicy, config.Config)
-			status := "completed"
-			if err != nil {
-				log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get scan result")
-				status = "error"
-			}
+	return runScan(configRepo, scanRepo, regoRepo, paramsRepo, overrideRepo, suppressionRepo, firstSeen, sender, discoveryID, clientID, accountID, clientEmail, provider, resourceTypes)
+}
 
-			scanResult := ScanResult{
-				DiscoveryJobID:   discoveryID,
-				ResourceType:     resource.Name(),
-				ResourceID:       config.ResourceID,
-				Status:           status,
-				Pass:             len(misconfigResult) == 0,
-				Misconfiguration: misconfigResult,
-				ClientID:         clientID,
-				AccountID:        accountID,
-				Provider:         provider,
-			}
+func RunGCPScan(configRepo gcpcloud.ConfigRepository, scanRepo ScanRepository, regoRepo RegoRepository, paramsRepo ParamsRepository, overrideRepo OverrideRepository, suppressionRepo SuppressionRepository, firstSeen FirstSeen, sender notify.Sender, discoveryID bson.ObjectID, clientID string, accountID string, clientEmail string, provider string, resources []gcpcloud.ResourceDiscovery) error {
+	resourceTypes := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		resourceTypes = append(resourceTypes, resource.Name())
+	}
 
-			scanResults = append(scanResults, scanResult)
+	return runScan(configRepo, scanRepo, regoRepo, paramsRepo, overrideRepo, suppressionRepo, firstSeen, sender, discoveryID, clientID, accountID, clientEmail, provider, resourceTypes)
+}
 
-			if len(misconfigResult) != 0 {
-				filteredResults = append(filteredResults, scanResult)
-			}
+// runScan evaluates every resource type of the job with the client's effective policy set, see
+// ResolvePolicies. paramsRepo may be nil, in which case policies see an empty data.params,
+// overrideRepo may be nil, in which case no built-in policy is disabled, and suppressionRepo may be
+// nil, in which case no finding is suppressed. firstSeen ages the risk scores of tracked findings,
+// see ScoreRisk, and may be nil. A client whose params, overrides or suppressions cannot be loaded
+// is not scanned, as its allowlists, disabled rules and accepted risks would otherwise be reported
+// as findings.
+func runScan(configRepo ConfigFinder, scanRepo ScanRepository, regoRepo RegoRepository, paramsRepo ParamsRepository, overrideRepo OverrideRepository, suppressionRepo SuppressionRepository, firstSeen FirstSeen, sender notify.Sender, discoveryID bson.ObjectID, clientID string, accountID string, clientEmail string, provider string, resourceTypes []string) error {
+	log.Info().Str("Discovery ID", discoveryID.Hex()).Msg("Starting misconfig scan")
+	scan := scanContext{discoveryID: discoveryID, clientID: clientID, accountID: accountID, provider: provider, scannedAt: time.Now()}
 
+	var params Params
+	if paramsRepo != nil {
+		var err error
+		params, err = paramsRepo.FindByClientID(clientID)
+		if err != nil {
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("clientID", clientID).Msg("Failed to load client params")
+			return fmt.Errorf("RunScan: %w", err)
 		}
+	}
+	paramsHash, err := params.Hash()
+	if err != nil {
+		return fmt.Errorf("RunScan: %w", err)
+	}
+	scan.paramsHash = paramsHash
 
-		result, err := scanRepo.InsertMany(scanResults)
-
+	var overrides []PolicyOverride
+	if overrideRepo != nil {
+		overrides, err = overrideRepo.FindByClientID(clientID)
 		if err != nil {
-			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to insert scan result")
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("clientID", clientID).Msg("Failed to load policy overrides")
 			return fmt.Errorf("RunScan: %w", err)
 		}
-		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Int("inserted", len(result)).Msg("Scan result inserted successfully")
-
-		sendScanResultEmail(filteredResults, clientEmail)
 	}
 
-	return nil
-}
+	var suppressions []Suppression
+	if suppressionRepo != nil {
+		suppressions, err = suppressionRepo.FindByClientID(clientID)
+		if err != nil {
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("clientID", clientID).Msg("Failed to load suppressions")
+			return fmt.Errorf("RunScan: %w", err)
+		}
+	}
 
-func RunGCPScan(configRepo gcpcloud.ConfigRepository, scanRepo ScanRepository, regoRepo RegoRepository, discoveryID bson.ObjectID, clientID string, accountID string, clientEmail string, provider string, resources []gcpcloud.ResourceDiscovery) error {
-	log.Info().Str("Discovery ID", discoveryID.Hex()).Msg("Starting misconfig scan")
+	// results are only written once the account-scope policies, which can report findings on any
+	// resource of the job, have been evaluated too
+	var inventory []cloud.ResourceConfig
+	var scanned []resourceTypeResults
 
-	for _, resource := range resources {
-		log.Info().Str("Discovery ID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Running misconfig scan")
+	for _, resourceType := range resourceTypes {
+		log.Info().Str("Discovery ID", discoveryID.Hex()).Str("resource", resourceType).Msg("Running misconfig scan")
 
-		configs, err := configRepo.FindByTypeAndJobID(resource.Name(), discoveryID)
+		configs, err := configRepo.FindByTypeAndJobID(resourceType, discoveryID)
 		if err != nil {
-			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to find config")
+			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Msg("Failed to find config")
 			continue
 		}
+		inventory = append(inventory, configs...)
 
-		// policyPaths, query, err := setupScan(resource.Name())
-		// if err != nil {
-		// 	log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get policy")
-		// 	continue
-		// }
-
-		regoPolicy, err := regoRepo.FindByResourceType(resource.Name())
+		regoPolicies, err := regoRepo.FindByResourceType(resourceType, clientID)
 		if err != nil {
-			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get rego policy")
+			log.Warn().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Msg("Failed to get rego policies")
+			continue
+		}
+		effective := ResolvePolicies(clientID, regoPolicies, overrides)
+		if len(effective) == 0 {
+			log.Warn().Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Msg("No enabled rego policy for resource type")
 			continue
 		}
 
-		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Str("Rego Query", regoPolicy.Query).Str("Rego Policy", regoPolicy.Rego).Msg("rego debug")
-
-		var scanResults []interface{}
-		var filteredResults []ScanResult
+		policies := preparePolicies(effective, params)
+		policyRefs := policyRefsOf(effective)
 
+		var scanResults []ScanResult
 		for _, config := range configs {
 
-			log.Info().Str("function", "EvaluateConfig").Str("resource name", config.ResourceID).Msg("Running evaluation for specific resource")
+			log.Info().Str("function", "EvaluateConfig").Str("resource name", config.ResourceID).Int("policies", len(policies)).Msg("Running evaluation for specific resource")
 
-			misconfigResult, err := EvaluateConfig(regoPolicy, config.Config)
-			status := "completed"
-			if err != nil {
-				log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to get scan result")
-				status = "error"
+			result := evaluatePolicies(policies, NewInput(config, scan.scannedAt))
+			if result.err != nil {
+				log.Error().Err(result.err).Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Str("resourceID", config.ResourceID).Int("attempts", result.attempts).Msg("Failed to evaluate resource")
 			}
 
-			scanResult := ScanResult{
-				DiscoveryJobID:   discoveryID,
-				ResourceType:     resource.Name(),
-				ResourceID:       config.ResourceID,
-				Status:           status,
-				Pass:             len(misconfigResult) == 0,
-				Misconfiguration: misconfigResult,
-				ClientID:         clientID,
-				AccountID:        accountID,
-				Provider:         provider,
-			}
-
-			scanResults = append(scanResults, scanResult)
-
-			if len(misconfigResult) != 0 {
-				filteredResults = append(filteredResults, scanResult)
-			}
+			scanResults = append(scanResults, scan.result(resourceType, config.ResourceID, result, policyRefs))
+		}
 
+		if len(scanResults) == 0 {
+			log.Warn().Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Msg("No configurations to scan")
+			continue
 		}
+		scanned = append(scanned, resourceTypeResults{resourceType: resourceType, results: scanResults})
+	}
 
-		result, err := scanRepo.InsertMany(scanResults)
+	scanned = scanAccount(regoRepo, scan, overrides, params, inventory, scanned)
+	for _, typeResults := range scanned {
+		ApplySuppressions(typeResults.results, suppressions, inventory, scan.scannedAt)
+		ScoreRisk(typeResults.results, inventory, firstSeen, scan.scannedAt)
+	}
 
+	// every result is written before any email goes out: a failed write fails the scan, which is
+	// retried, and the retry must not notify the client of resource types it was already told about
+	for _, typeResults := range scanned {
+		written, err := scanRepo.UpsertMany(typeResults.results)
 		if err != nil {
-			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Msg("Failed to insert scan result")
+			log.Error().Err(err).Str("discoveryID", discoveryID.Hex()).Str("resource", typeResults.resourceType).Msg("Failed to upsert scan result")
 			return fmt.Errorf("RunScan: %w", err)
 		}
-		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resource.Name()).Int("inserted", len(result)).Msg("Scan result inserted successfully")
+		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", typeResults.resourceType).Int64("written", written).Msg("Scan result upserted successfully")
+	}
+
+	for _, typeResults := range scanned {
+		resourceType := typeResults.resourceType
+
+		var failedResults []ScanResult
+		var erroredResults []ScanResult
+		for _, scanResult := range typeResults.results {
+			if scanResult.Outcome == OutcomeFail {
+				failedResults = append(failedResults, scanResult)
+			}
+			if scanResult.Error != "" {
+				erroredResults = append(erroredResults, scanResult)
+			}
+		}
+		log.Info().Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Int("failed", len(failedResults)).Int("errored", len(erroredResults)).Msg("Scan results of resource type")
 
-		sendScanResultEmail(filteredResults, clientEmail)
+		if len(erroredResults) > 0 {
+			log.Warn().Str("discoveryID", discoveryID.Hex()).Str("resource", resourceType).Int("errored", len(erroredResults)).Msg("Some resources could not be evaluated")
+		}
+
+		if (len(failedResults) > 0 || len(erroredResults) > 0) && sender != nil && clientEmail != "" {
+			sendScanResultEmail(sender, resourceType, failedResults, erroredResults, clientEmail)
+		}
 	}
 
 	return nil
 }
 
-func sendScanResultEmail(misconfigs []ScanResult, clientEmail string) {
+// scanContext is what every scan result of a job shares.
+type scanContext struct {
+	discoveryID bson.ObjectID
+	clientID    string
+	accountID   string
+	provider    string
+	paramsHash  string
+	scannedAt   time.Time
+}
+
+// resourceTypeResults are the scan results of one resource type, written and notified together.
+type resourceTypeResults struct {
+	resourceType string
+	results      []ScanResult
+}
+
+// result turns the evaluation of one resource into its scan result. An error next to findings
+// means some policies could not be evaluated; the resource is reported both as failed and as
+// incompletely evaluated.
+func (s scanContext) result(resourceType string, resourceID string, result evaluation, policyRefs []PolicyRef) ScanResult {
+	scanResult := ScanResult{
+		DiscoveryJobID:   s.discoveryID,
+		ResourceType:     resourceType,
+		ResourceID:       resourceID,
+		Status:           CompletedStatus,
+		Outcome:          result.outcome,
+		Pass:             result.outcome == OutcomePass,
+		Attempts:         result.attempts,
+		Policies:         policyRefs,
+		ParamsHash:       s.paramsHash,
+		CheckedRules:     result.checked,
+		Findings:         result.findings,
+		Severity:         MaxSeverity(result.findings),
+		Misconfiguration: findingTitles(result.findings),
+		ClientID:         s.clientID,
+		AccountID:        s.accountID,
+		Provider:         s.provider,
+	}
+	if result.err != nil {
+		scanResult.Status = ErrorStatus
+		scanResult.Error = result.err.Error()
+	}
+	return scanResult
+}
+
+func policyRefsOf(policies []EffectivePolicy) []PolicyRef {
+	policyRefs := make([]PolicyRef, 0, len(policies))
+	for _, policy := range policies {
+		policyRefs = append(policyRefs, PolicyRef{ID: policy.ID, Name: policy.Name, Version: policy.Version})
+	}
+	return policyRefs
+}
+
+// scanResultEmail is the data of scanResultEmailTemplate.tmpl. Resources that could not be
+// evaluated are listed apart from failures, as their state is unknown rather than bad.
+type scanResultEmail struct {
+	ResourceType string
+	Failed       []ScanResult
+	Errored      []ScanResult
+}
+
+func sendScanResultEmail(sender notify.Sender, resourceType string, failed []ScanResult, errored []ScanResult, clientEmail string) {
 
 	//templateFile := "./internal/notifyscanResultEmailTempalte.tmpl"
 	//tmpl, err := template.ParseFiles(templateFile)
@@ -178,20 +262,28 @@ func sendScanResultEmail(misconfigs []ScanResult, clientEmail string) {
 		return
 	}
 
+	// riskiest resources first; findings within a result are already sorted
+	SortByRisk(failed)
+
 	var body bytes.Buffer
-	err = tmpl.Execute(&body, misconfigs)
+	err = tmpl.Execute(&body, scanResultEmail{ResourceType: resourceType, Failed: failed, Errored: errored})
 	if err != nil {
 		log.Warn().Err(err).Str("function", "sendScanResultEmail").Msg("failed to generate email template")
 		return
 	}
 
+	subject := "ProjectWoz Notification - Security Scan Failed for Resource " + resourceType
+	if len(failed) == 0 {
+		subject = "ProjectWoz Notification - Security Scan Incomplete for Resource " + resourceType
+	}
+
 	config := notify.EmailConfig{
 		To:      []string{clientEmail},
-		Subject: "ProjectWoz Notification - Security Scan Failed for Resource " + misconfigs[0].ResourceType,
+		Subject: subject,
 		Body:    body.String(),
 	}
 
-	if err := notify.SendEmail(config); err != nil {
+	if err := sender.SendEmail(config); err != nil {
 		log.Warn().Err(err).Str("function", "sendScanResultEmail").Msg("failed to send email")
 		return
 	}
@@ -215,50 +307,230 @@ func setupScan(name string) ([]string, string, error) {
 	return policyPaths, query, nil
 }
 
-func EvaluateConfig(regoPolicy *RegoPolicy, config map[string]interface{}) ([]string, error) {
-	// func EvaluateConfig(policyPaths []string, query string, config map[string]interface{}) ([]string, error) {
-	ctx := context.TODO()
+// PreparePolicy compiles the policy's module and query once, for evaluation against many resources.
+// Like ValidatePolicy it only allows the built-ins of capabilities, so a module stored before that
+// check cannot make requests either. params is loaded as data.params, an empty object when the
+// client has none. Built-in errors are strict so that a rule failing on unexpected input is
+// reported as an error instead of silently not matching, which would make the resource look clean.
+func PreparePolicy(regoPolicy *RegoPolicy, params Params) (rego.PreparedEvalQuery, error) {
+	return prepareQuery(regoPolicy, policyData(params, nil))
+}
+
+// policyData is the data document policies are evaluated with: data.params, and data.inventory for
+// account-scope policies.
+func policyData(params Params, inventory map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		params = Params{}
+	}
+
+	data := map[string]interface{}{"params": map[string]interface{}(params)}
+	if inventory != nil {
+		data["inventory"] = inventory
+	}
+	return data
+}
+
+func prepareQuery(regoPolicy *RegoPolicy, data map[string]interface{}) (rego.PreparedEvalQuery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	rq, err := rego.New(
+	options := append([]func(*rego.Rego){
 		rego.Query(regoPolicy.Query),
 		rego.Module("rego", regoPolicy.Rego),
-	).PrepareForEval(ctx)
+		rego.Store(inmem.NewFromObject(data)),
+		rego.StrictBuiltinErrors(true),
+		rego.Capabilities(capabilities()),
+	}, builtinOptions()...)
 
+	query, err := rego.New(options...).PrepareForEval(ctx)
 	if err != nil {
-		// Handle error.
-		log.Error().Err(err).Str("function", "EvaluateConfig").Msg("Failed to prepare OPA query")
-		return []string{}, err
+		log.Error().Err(err).Str("function", "PreparePolicy").Msg("Failed to prepare OPA query")
+		return rego.PreparedEvalQuery{}, fmt.Errorf("failed to prepare policy for %s: %w", regoPolicy.ResourceType, err)
 	}
 
-	results, err := rq.Eval(context.Background(), rego.EvalInput(config))
-	if err != nil {
-		log.Error().Err(err).Str("function", "EvaluateConfig").Msg("Failed to evaluate OPA query")
+	return query, nil
+}
+
+type preparedPolicy struct {
+	policy   *RegoPolicy
+	query    rego.PreparedEvalQuery
+	rules    map[string]RuleMetadata
+	disabled map[string]bool // rule IDs whose findings are dropped, see EffectivePolicy
+	err      error           // compile error, reported for every resource rather than retried
+}
+
+func preparePolicies(effective []EffectivePolicy, params Params) []preparedPolicy {
+	policies := make([]preparedPolicy, 0, len(effective))
+	for i := range effective {
+		regoPolicy := &effective[i].RegoPolicy
+		compiled, err := DefaultPolicyCache.get(regoPolicy, params)
+		if err != nil {
+			log.Error().Err(err).Str("function", "preparePolicies").Str("policy", regoPolicy.Name).Msg("Failed to prepare rego policy")
+		}
+
+		disabled := make(map[string]bool, len(effective[i].DisabledRules))
+		for _, ruleID := range effective[i].DisabledRules {
+			disabled[ruleID] = true
+		}
+		policies = append(policies, preparedPolicy{policy: regoPolicy, query: compiled.query, rules: compiled.rules, disabled: disabled, err: err})
 	}
+	return policies
+}
 
-	log.Debug().Err(err).Str("function", "EvaluateConfig").Msg("Debug")
-	for _, r := range results {
-		for _, e := range r.Expressions {
-			log.Info().
-				Str("expression_text", e.Text).
-				Interface("expression_value", e.Value).
-				Msg("Expression result")
+// evaluation is the merged result of every policy of a resource type for one config.
+type evaluation struct {
+	outcome  Outcome
+	findings []Finding
+	attempts int
+	checked  []string // rule IDs of the policies that applied to the config and evaluated without error
+	err      error
+}
+
+// evaluatePolicies evaluates every policy of a resource type against one input and merges the
+// outcomes: any finding makes the resource fail, otherwise any error makes it an error, and it only
+// passes when at least one policy applied. Errors are returned alongside the findings of the
+// policies that did evaluate. Findings of disabled rules are dropped and every other finding
+// records the policy that reported it.
+func evaluatePolicies(policies []preparedPolicy, input Input) evaluation {
+	var result evaluation
+	var errs []error
+	applied := false
+	document := input.document()
+
+	for _, p := range policies {
+		if p.err != nil {
+			errs = append(errs, fmt.Errorf("policy %s: %w", p.policy.Name, p.err))
+			continue
+		}
+
+		outcome, policyFindings, policyAttempts, err := evaluateWithRetry(p.query, p.rules, document)
+		result.attempts = max(result.attempts, policyAttempts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("policy %s: %w", p.policy.Name, err))
+			continue
+		}
+
+		if outcome != OutcomeNotApplicable {
+			applied = true
+			for ruleID := range p.rules {
+				if !p.disabled[ruleID] {
+					result.checked = append(result.checked, ruleID)
+				}
+			}
+		}
+		for _, finding := range policyFindings {
+			if finding.RuleID != "" && p.disabled[finding.RuleID] {
+				continue
+			}
+			finding.Policy = p.policy.Name
+			result.findings = append(result.findings, finding)
 		}
 	}
 
-	var misconfiguration []string
+	SortFindings(result.findings)
+	sort.Strings(result.checked)
+	result.err = errors.Join(errs...)
+
+	switch {
+	case len(result.findings) > 0:
+		result.outcome = OutcomeFail
+	case result.err != nil:
+		result.outcome = OutcomeError
+		result.findings = nil
+	case applied:
+		result.outcome = OutcomePass
+	default:
+		result.outcome = OutcomeNotApplicable
+	}
+	return result
+}
+
+// EvaluatePolicies evaluates the effective policy set of a client for one resource type, see
+// ResolvePolicies, against the input of one resource and merges their findings, the way a scan does.
+func EvaluatePolicies(policies []EffectivePolicy, params Params, input Input) (Outcome, []Finding, error) {
+	result := evaluatePolicies(preparePolicies(policies, params), input)
+	return result.outcome, result.findings, result.err
+}
 
-	if exp, ok := results[0].Expressions[0].Value.(map[string]interface{}); ok {
-		for k, v := range exp {
-			misconfiguration = append(misconfiguration, k)
-			log.Info().
-				Str("expression_text", k).
-				Interface("expression_value", v).
-				Msg("Expression result")
+// EvaluateConfig runs the policy's deny query against the input of one resource, see Input, and
+// returns the outcome and its findings, most severe first. A non-nil error always comes with
+// OutcomeError. The compiled policy comes from DefaultPolicyCache. params is the client's parameter
+// document, see Params.
+func EvaluateConfig(regoPolicy *RegoPolicy, params Params, input Input) (Outcome, []Finding, error) {
+	compiled, err := DefaultPolicyCache.get(regoPolicy, params)
+	if err != nil {
+		return OutcomeError, nil, err
+	}
+
+	return evaluate(compiled.query, compiled.rules, input.document())
+}
+
+// evaluateWithRetry retries evaluations that timed out or were cancelled before giving up on the
+// resource. Any other error, e.g. a conflict or a failing built-in, fails the same way every time
+// and is returned on the first attempt.
+func evaluateWithRetry(query rego.PreparedEvalQuery, rules map[string]RuleMetadata, input map[string]interface{}) (Outcome, []Finding, int, error) {
+	var err error
+	for attempt := 1; attempt <= maxEvaluationAttempts; attempt++ {
+		var outcome Outcome
+		var findings []Finding
+		outcome, findings, err = evaluate(query, rules, input)
+		if err == nil {
+			return outcome, findings, attempt, nil
+		}
+
+		if !isTransient(err) {
+			return OutcomeError, nil, attempt, err
+		}
+
+		log.Warn().Err(err).Str("function", "evaluateWithRetry").Int("attempt", attempt).Msg("Evaluation failed")
+		if attempt < maxEvaluationAttempts {
+			time.Sleep(time.Duration(attempt) * evaluationRetryDelay)
 		}
 	}
 
-	return misconfiguration, nil
+	return OutcomeError, nil, maxEvaluationAttempts, err
+}
 
+// isTransient reports whether an evaluation error may not recur: OPA reports a query stopped by its
+// context as a cancel error, built-ins may return the context's error.
+func isTransient(err error) bool {
+	return topdown.IsCancel(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+func evaluate(query rego.PreparedEvalQuery, rules map[string]RuleMetadata, input map[string]interface{}) (Outcome, []Finding, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		log.Error().Err(err).Str("function", "EvaluateConfig").Msg("Failed to evaluate OPA query")
+		return OutcomeError, nil, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+
+	// an undefined query, e.g. a deny rule guarded by a condition the input does not meet, has no
+	// results at all; that is not the same as an empty deny set
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return OutcomeNotApplicable, nil, nil
+	}
+
+	findings, err := parseFindings(results[0].Expressions[0].Value, rules)
+	if err != nil {
+		log.Error().Err(err).Str("function", "EvaluateConfig").Msg("Failed to parse deny result")
+		return OutcomeError, nil, err
+	}
+
+	if len(findings) == 0 {
+		return OutcomePass, nil, nil
+	}
+	return OutcomeFail, findings, nil
+}
+
+func findingTitles(findings []Finding) []string {
+	titles := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		titles = append(titles, finding.Title)
+	}
+	return titles
 }
 
 func EvaluateS3BucketPolicy(config cloud.ResourceConfig, regoPolicy *RegoPolicy) (string, error) {
@@ -330,6 +602,10 @@ func EvaluateS3BucketPolicy(config cloud.ResourceConfig, regoPolicy *RegoPolicy)
 		break
 	}
 
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return "", nil
+	}
+
 	if valueMap, ok := results[0].Expressions[0].Value.(map[string]interface{}); ok {
 		for key, value := range valueMap {
 			// Now you can range over the map
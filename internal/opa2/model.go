@@ -1,25 +1,112 @@
 package opa2
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+const (
+	CompletedStatus = "completed"
+	ErrorStatus     = "error"
+)
+
+// Outcome is the verdict for one resource. Only OutcomePass and OutcomeFail mean the policy was
+// actually evaluated against the resource.
+type Outcome string
+
+const (
+	OutcomePass          Outcome = "pass"           // evaluated, no findings
+	OutcomeFail          Outcome = "fail"           // evaluated, at least one finding
+	OutcomeError         Outcome = "error"          // the policy could not be evaluated
+	OutcomeNotApplicable Outcome = "not-applicable" // the deny query was undefined for the resource
+)
+
 type ScanResult struct {
 	ID               bson.ObjectID `bson:"_id,omitempty"`
 	DiscoveryJobID   bson.ObjectID `bson:"discovery_job_id"` // Link to the discovery job
 	ResourceType     string        `bson:"resource_type"`    // e.g., "s3", "ec2", "rds", "gcs"
 	ResourceID       string        `bson:"resource_id"`      // e.g., S3 bucket name, EC2 instance ARN
 	Status           string        `bson:"status"`           // status of the Job
-	Pass             bool          `bson:"pass"`             // Fixed type from 'boolean' to 'bool'
-	Misconfiguration []string      `bson:"misconfiguration"` // misconfiguration details
+	Outcome          Outcome       `bson:"outcome"`
+	Pass             bool          `bson:"pass"`                    // true only for OutcomePass
+	Error            string        `bson:"error,omitempty"`         // evaluation errors; next to findings when only some policies evaluated
+	Attempts         int           `bson:"attempts"`                // evaluations made, including retries
+	Policies         []PolicyRef   `bson:"policies"`                // policy versions the resource was evaluated with
+	ParamsHash       string        `bson:"params_hash,omitempty"`   // Params.Hash of the client params the policies saw
+	CheckedRules     []string      `bson:"checked_rules,omitempty"` // rule IDs of the policies that applied and evaluated without error
+	Findings         []Finding     `bson:"findings"`                // sorted most severe first
+	Suppressed       []Finding     `bson:"suppressed,omitempty"`    // findings covered by an active suppression, which do not fail the resource
+	Severity         Severity      `bson:"severity,omitempty"`      // most severe finding, for filtering
+	Risk             Risk          `bson:"risk"`                    // exposure, sensitivity and environment of the resource
+	RiskScore        int           `bson:"risk_score"`              // highest risk score of the findings, for sorting
+	Misconfiguration []string      `bson:"misconfiguration"`        // finding titles, kept for existing readers
 	ClientID         string        `bson:"client_id"`
 	AccountID        string        `bson:"account_id"`
 	Provider         string        `bson:"provider"` // Cloud Provider
 }
 
+// PolicyState is the lifecycle state of one version of a policy. At most one version of a policy
+// is active at a time; only active versions are evaluated.
+type PolicyState string
+
+const (
+	PolicyDraft   PolicyState = "draft"
+	PolicyActive  PolicyState = "active"
+	PolicyRetired PolicyState = "retired"
+)
+
+// RegoPolicy is one version of an independently managed policy module. A resource type can have
+// many policies; the scanner evaluates the active version of every enabled one and merges their
+// findings. Versions are immutable once stored: a change is a new draft that is then activated.
+// Built-in policies apply to every client; a policy with a ClientID only applies to that client,
+// see ResolvePolicies.
 type RegoPolicy struct {
-	ID           bson.ObjectID `bson:"_id,omitempty"`
-	ResourceType string        `bson:"resource_type"` // e.g., "s3", "ec2", "rds", "gcs"
-	Query        string        `bson:"query"`
-	Rego         string        `bson:"rego"` // rego policy for a specific resource type
+	ID           bson.ObjectID     `bson:"_id,omitempty"`
+	ResourceType string            `bson:"resource_type"`       // e.g., "s3", "ec2", "rds", "gcs"
+	Name         string            `bson:"name"`                // unique within the resource type across clients, e.g. "s3-public-access"
+	ClientID     string            `bson:"client_id,omitempty"` // empty for built-in policies
+	Description  string            `bson:"description,omitempty"`
+	Rules        []RuleMetadata    `bson:"rules,omitempty"` // from the module's # METADATA annotations, see ParsePolicyMetadata
+	Enabled      bool              `bson:"enabled"`
+	Metadata     map[string]string `bson:"metadata,omitempty"` // free-form, e.g. owner or ticket
+	Query        string            `bson:"query"`
+	Version      int               `bson:"version"`          // 1 for the first version of a policy, keys the compiled-policy cache
+	State        PolicyState       `bson:"state"`            // policies stored before versioning have none and count as active
+	Rego         string            `bson:"rego"`             // rego module evaluated by Query
+	Hash         string            `bson:"hash,omitempty"`   // sha256 of Query and Rego, compared by policy sync
+	Source       string            `bson:"source,omitempty"` // EmbeddedSource for policies managed by policy sync
+	CreatedAt    time.Time         `bson:"created_at"`
+	ActivatedAt  *time.Time        `bson:"activated_at,omitempty"`
+	RetiredAt    *time.Time        `bson:"retired_at,omitempty"`
+}
+
+// EmbeddedSource marks policies loaded from the policies/ tree shipped in the binary. Only these
+// are changed or retired by policy sync.
+const EmbeddedSource = "embedded"
+
+const (
+	ActivateAction = "activate"
+	RollbackAction = "rollback"
+	RetireAction   = "retire"
+)
+
+// PolicyActivation records one change of a policy's active version. Version is 0 when the policy
+// was retired without a replacement, PreviousVersion is 0 when nothing was active before.
+type PolicyActivation struct {
+	ID              bson.ObjectID `bson:"_id,omitempty"`
+	ResourceType    string        `bson:"resource_type"`
+	Name            string        `bson:"name"`
+	Action          string        `bson:"action"`
+	Version         int           `bson:"version"`
+	PreviousVersion int           `bson:"previous_version"`
+	Reason          string        `bson:"reason,omitempty"`
+	CreatedAt       time.Time     `bson:"created_at"`
+}
+
+// PolicyRef identifies the policy version a scan result was evaluated with.
+type PolicyRef struct {
+	ID      bson.ObjectID `bson:"id"`
+	Name    string        `bson:"name"`
+	Version int           `bson:"version"`
 }
@@ -0,0 +1,186 @@
+package opa2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// PolicyOverride disables a built-in policy or rule for one client. With only Policy set the whole
+// policy is skipped; with RuleID set findings with that rule ID are dropped, from Policy only when
+// it is set too. Client policies are not affected: a client removes its own rule by retiring it.
+type PolicyOverride struct {
+	ID           bson.ObjectID `bson:"_id,omitempty"`
+	ClientID     string        `bson:"client_id"`
+	ResourceType string        `bson:"resource_type"`
+	Policy       string        `bson:"policy,omitempty"`  // name of a built-in policy
+	RuleID       string        `bson:"rule_id,omitempty"` // rule ID of a built-in rule
+	Reason       string        `bson:"reason,omitempty"`
+	CreatedAt    time.Time     `bson:"created_at"`
+}
+
+// EffectivePolicy is a policy as it applies to one client. Findings with a rule ID in
+// DisabledRules are dropped and the rule does not count as checked.
+type EffectivePolicy struct {
+	RegoPolicy
+	DisabledRules []string
+}
+
+// ResolvePolicies works out the effective policy set of a client from the policies of a resource
+// type, built-in and client-scoped, and the client's overrides:
+//
+//   - policies of other clients are left out;
+//   - built-in policies disabled by an override are left out;
+//   - rules disabled by an override are disabled in the built-in policies they match;
+//   - a client policy reporting a rule ID also reported by a built-in policy overrides it, so the
+//     rule is disabled in every built-in policy.
+func ResolvePolicies(clientID string, regoPolicies []RegoPolicy, overrides []PolicyOverride) []EffectivePolicy {
+	disabledPolicies := make(map[string]bool)
+	var disabledRules []PolicyOverride
+	for _, override := range overrides {
+		if override.ClientID != clientID {
+			continue
+		}
+		if override.RuleID == "" {
+			disabledPolicies[override.ResourceType+"/"+override.Policy] = true
+			continue
+		}
+		disabledRules = append(disabledRules, override)
+	}
+
+	overridden := make(map[string]bool)
+	for i := range regoPolicies {
+		if regoPolicies[i].ClientID != "" && regoPolicies[i].ClientID == clientID {
+			for ruleID := range policyRules(&regoPolicies[i]) {
+				overridden[ruleID] = true
+			}
+		}
+	}
+
+	var policies []EffectivePolicy
+	for i := range regoPolicies {
+		policy := EffectivePolicy{RegoPolicy: regoPolicies[i]}
+		if policy.ClientID != "" {
+			if policy.ClientID == clientID {
+				policies = append(policies, policy)
+			}
+			continue
+		}
+		if disabledPolicies[policyKeyOf(policy.RegoPolicy)] {
+			continue
+		}
+
+		for ruleID := range policyRules(&policy.RegoPolicy) {
+			if overridden[ruleID] || ruleDisabled(disabledRules, policy.RegoPolicy, ruleID) {
+				policy.DisabledRules = append(policy.DisabledRules, ruleID)
+			}
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies
+}
+
+func ruleDisabled(overrides []PolicyOverride, policy RegoPolicy, ruleID string) bool {
+	for _, override := range overrides {
+		if override.RuleID != ruleID || override.ResourceType != policy.ResourceType {
+			continue
+		}
+		if override.Policy == "" || override.Policy == policy.Name {
+			return true
+		}
+	}
+	return false
+}
+
+type OverrideRepository interface {
+	FindByClientID(clientID string) ([]PolicyOverride, error)
+	Create(override *PolicyOverride) (bson.ObjectID, error)
+	Delete(clientID string, id bson.ObjectID) error
+}
+
+type overrideRepository struct {
+	db database.Service
+}
+
+func NewOverrideRepository(db database.Service) OverrideRepository {
+	return &overrideRepository{
+		db: db,
+	}
+}
+
+func (r *overrideRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("policy_override")
+}
+
+// FindByClientID returns every override of a client, oldest first.
+func (r *overrideRepository) FindByClientID(clientID string) ([]PolicyOverride, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection().Find(ctx, bson.M{"client_id": clientID}, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "FindByClientID").Str("clientID", clientID).Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to find policy overrides of client %s: %w", clientID, err)
+	}
+	defer cursor.Close(ctx)
+
+	var overrides []PolicyOverride
+	if err := cursor.All(ctx, &overrides); err != nil {
+		log.Error().Err(err).Str("function", "FindByClientID").Str("clientID", clientID).Msg("Failed to decode policy overrides")
+		return nil, fmt.Errorf("failed to decode policy overrides of client %s: %w", clientID, err)
+	}
+
+	return overrides, nil
+}
+
+// Create stores an override. It needs a client, a resource type and a policy or rule ID.
+func (r *overrideRepository) Create(override *PolicyOverride) (bson.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if override.ClientID == "" || override.ResourceType == "" {
+		return bson.NilObjectID, fmt.Errorf("policy override needs a client and a resource type")
+	}
+	if override.Policy == "" && override.RuleID == "" {
+		return bson.NilObjectID, fmt.Errorf("policy override needs a policy or a rule ID")
+	}
+
+	override.CreatedAt = time.Now()
+
+	result, err := r.collection().InsertOne(ctx, override)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Create").Str("clientID", override.ClientID).Msg("Failed to insert policy override")
+		return bson.NilObjectID, fmt.Errorf("failed to insert policy override for client %s: %w", override.ClientID, err)
+	}
+	override.ID = result.InsertedID.(bson.ObjectID)
+
+	log.Info().Str("function", "Create").Str("clientID", override.ClientID).Str("policy", override.Policy).Str("ruleID", override.RuleID).Msg("Policy override created")
+	return override.ID, nil
+}
+
+// Delete removes one of the client's overrides.
+func (r *overrideRepository) Delete(clientID string, id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection().DeleteOne(ctx, bson.M{"_id": id, "client_id": clientID})
+	if err != nil {
+		log.Error().Err(err).Str("function", "Delete").Str("clientID", clientID).Str("id", id.Hex()).Msg("Failed to delete policy override")
+		return fmt.Errorf("failed to delete policy override %s: %w", id.Hex(), err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no policy override %s found for client %s", id.Hex(), clientID)
+	}
+
+	log.Info().Str("function", "Delete").Str("clientID", clientID).Str("id", id.Hex()).Msg("Policy override deleted")
+	return nil
+}
@@ -0,0 +1,70 @@
+package opa2_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePolicies(t *testing.T) {
+	builtin := opa2.RegoPolicy{ResourceType: "s3", Name: "aws/s3", Query: "data.s3.builtin.deny", Rego: `package s3.builtin
+
+deny contains {"rule_id": "S3-PUB", "title": "Bucket is public.", "severity": "high"} if input.config.public
+
+deny contains {"rule_id": "S3-VER", "title": "Bucket is not versioned.", "severity": "low"} if not input.config.versioned
+
+deny contains {"rule_id": "S3-LOG", "title": "Bucket does not log access.", "severity": "low"} if not input.config.logging
+`}
+	encryption := opa2.RegoPolicy{ResourceType: "s3", Name: "aws/s3-encryption", Query: "data.s3.encryption.deny", Rego: `package s3.encryption
+
+deny contains {"rule_id": "S3-ENC", "title": "Bucket is not encrypted.", "severity": "medium"} if not input.config.encrypted
+`}
+	// acme hosts a website from public buckets and only minds those without the website tag
+	custom := opa2.RegoPolicy{ResourceType: "s3", Name: "acme/s3", ClientID: "acme", Query: "data.s3.acme.deny", Rego: `package s3.acme
+
+deny contains {"rule_id": "S3-PUB", "title": "Bucket is public but not a website.", "severity": "critical"} if {
+    input.config.public
+    not input.resource.tags.website
+}
+`}
+	other := opa2.RegoPolicy{ResourceType: "s3", Name: "globex/s3", ClientID: "globex", Query: "data.s3.globex.deny", Rego: `package s3.globex
+
+deny contains {"rule_id": "S3-GLX", "title": "globex"} if true
+`}
+	overrides := []opa2.PolicyOverride{
+		{ClientID: "acme", ResourceType: "s3", Policy: "aws/s3-encryption"},
+		{ClientID: "acme", ResourceType: "s3", RuleID: "S3-VER"},
+		{ClientID: "globex", ResourceType: "s3", RuleID: "S3-LOG"},
+	}
+
+	policies := opa2.ResolvePolicies("acme", []opa2.RegoPolicy{builtin, encryption, custom, other}, overrides)
+	if assert.Len(t, policies, 2) {
+		assert.Equal(t, "aws/s3", policies[0].Name)
+		assert.ElementsMatch(t, []string{"S3-PUB", "S3-VER"}, policies[0].DisabledRules)
+		assert.Equal(t, "acme/s3", policies[1].Name)
+		assert.Empty(t, policies[1].DisabledRules)
+	}
+
+	outcome, findings, err := opa2.EvaluatePolicies(policies, nil, opa2.Input{Config: map[string]interface{}{"public": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, "S3-PUB", findings[0].RuleID)
+		assert.Equal(t, opa2.SeverityCritical, findings[0].Severity)
+		assert.Equal(t, "acme/s3", findings[0].Policy)
+		assert.Equal(t, "S3-LOG", findings[1].RuleID)
+		assert.Equal(t, "aws/s3", findings[1].Policy)
+	}
+
+	outcome, _, err = opa2.EvaluatePolicies(policies, nil, opa2.Input{Tags: map[string]string{"website": "true"}, Config: map[string]interface{}{"public": true, "logging": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+
+	// without overrides every built-in policy applies in full, and client policies never do
+	policies = opa2.ResolvePolicies("initech", []opa2.RegoPolicy{builtin, encryption, custom, other}, overrides)
+	if assert.Len(t, policies, 2) {
+		assert.Empty(t, policies[0].DisabledRules)
+		assert.Empty(t, policies[1].DisabledRules)
+	}
+}
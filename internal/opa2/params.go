@@ -0,0 +1,100 @@
+package opa2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Params is a client's parameter document, e.g. trusted account IDs and approved CIDRs. Policies
+// read it as data.params, so a shared policy can check each client's allowlists:
+//
+//	default approved_cidrs := []
+//	approved_cidrs := data.params.approved_cidrs
+type Params map[string]interface{}
+
+// Hash identifies the content of the document, "" when it is empty. Compiled policies are cached
+// per policy version and params hash.
+func (p Params) Hash() (string, error) {
+	if len(p) == 0 {
+		return "", nil
+	}
+
+	// map keys are marshalled sorted, so equal documents hash the same
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode params: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ClientParams is the parameter document of one client.
+type ClientParams struct {
+	ClientID  string    `bson:"_id"`
+	Params    Params    `bson:"params"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+type ParamsRepository interface {
+	FindByClientID(clientID string) (Params, error)
+	Save(clientID string, params Params) error
+}
+
+type paramsRepository struct {
+	db database.Service
+}
+
+func NewParamsRepository(db database.Service) ParamsRepository {
+	return &paramsRepository{
+		db: db,
+	}
+}
+
+func (r *paramsRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("client_params")
+}
+
+// FindByClientID returns the client's parameters, or nil when the client has none.
+func (r *paramsRepository) FindByClientID(clientID string) (Params, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc ClientParams
+	err := r.collection().FindOne(ctx, bson.M{"_id": clientID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Error().Err(err).Str("function", "FindByClientID").Str("clientID", clientID).Msg("Failed to find client params")
+		return nil, fmt.Errorf("failed to find params of client %s: %w", clientID, err)
+	}
+
+	return doc.Params, nil
+}
+
+// Save replaces the client's parameter document.
+func (r *paramsRepository) Save(clientID string, params Params) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc := ClientParams{ClientID: clientID, Params: params, UpdatedAt: time.Now()}
+	_, err := r.collection().ReplaceOne(ctx, bson.M{"_id": clientID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Error().Err(err).Str("function", "Save").Str("clientID", clientID).Msg("Failed to save client params")
+		return fmt.Errorf("failed to save params of client %s: %w", clientID, err)
+	}
+
+	log.Info().Str("function", "Save").Str("clientID", clientID).Msg("Client params saved")
+	return nil
+}
@@ -0,0 +1,101 @@
+package opa2_test
+
+import (
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const paramsModule = `package s3
+
+default approved_cidrs := []
+
+approved_cidrs := data.params.approved_cidrs
+
+deny contains {"rule_id": "S3-IP", "title": "Source IP is not approved."} if {
+    count(approved_cidrs) > 0
+    not approved
+}
+
+approved if {
+    some cidr in approved_cidrs
+    net.cidr_contains(cidr, input.config.source_ip)
+}
+`
+
+func TestEvaluateConfigInjectsParams(t *testing.T) {
+	policy := &opa2.RegoPolicy{ID: bson.NewObjectID(), Version: 1, ResourceType: "s3", Query: "data.s3.deny", Rego: paramsModule}
+	config := map[string]interface{}{"source_ip": "203.0.113.7"}
+
+	outcome, _, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: config})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+
+	outcome, findings, err := opa2.EvaluateConfig(policy, opa2.Params{"approved_cidrs": []interface{}{"10.0.0.0/8"}}, opa2.Input{Config: config})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomeFail, outcome)
+	assert.Len(t, findings, 1)
+
+	outcome, _, err = opa2.EvaluateConfig(policy, opa2.Params{"approved_cidrs": []interface{}{"203.0.113.0/24"}}, opa2.Input{Config: config})
+	assert.NoError(t, err)
+	assert.Equal(t, opa2.OutcomePass, outcome)
+}
+
+func TestPolicyCacheKeysOnParams(t *testing.T) {
+	cache := opa2.NewPolicyCache(opa2.DefaultPolicyCacheSize)
+	policy := &opa2.RegoPolicy{ID: bson.NewObjectID(), Version: 1, ResourceType: "s3", Query: "data.s3.deny", Rego: paramsModule}
+	first := opa2.Params{"approved_cidrs": []interface{}{"10.0.0.0/8"}}
+	second := opa2.Params{"approved_cidrs": []interface{}{"192.168.0.0/16"}}
+
+	for _, params := range []opa2.Params{nil, first, second, {"approved_cidrs": []interface{}{"10.0.0.0/8"}}} {
+		_, err := cache.Get(policy, params)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, cache.Len())
+
+	// the next version, a document of its own, replaces every params' entry of the first
+	next := *policy
+	next.ID = bson.NewObjectID()
+	next.Version = 2
+	_, err := cache.Get(&next, first)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestPolicyCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := opa2.NewPolicyCache(2)
+	policy := &opa2.RegoPolicy{ID: bson.NewObjectID(), Version: 1, ResourceType: "s3", Query: "data.s3.deny", Rego: paramsModule}
+	first := opa2.Params{"approved_cidrs": []interface{}{"10.0.0.0/8"}}
+	second := opa2.Params{"approved_cidrs": []interface{}{"192.168.0.0/16"}}
+	third := opa2.Params{"approved_cidrs": []interface{}{"172.16.0.0/12"}}
+
+	for _, params := range []opa2.Params{first, second, first, third} {
+		_, err := cache.Get(policy, params)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, cache.Len())
+
+	// a module that no longer compiles shows which entries are served from the cache
+	policy.Rego = "package s3\ndeny {"
+	_, err := cache.Get(policy, first)
+	assert.NoError(t, err, "recently used params stay cached")
+	_, err = cache.Get(policy, third)
+	assert.NoError(t, err)
+	_, err = cache.Get(policy, second)
+	assert.Error(t, err, "least recently used params are evicted and compiled again")
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestParamsHash(t *testing.T) {
+	empty, err := opa2.Params{}.Hash()
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	a, _ := opa2.Params{"trusted_accounts": []interface{}{"1"}, "approved_cidrs": []interface{}{"10.0.0.0/8"}}.Hash()
+	b, _ := opa2.Params{"approved_cidrs": []interface{}{"10.0.0.0/8"}, "trusted_accounts": []interface{}{"1"}}.Hash()
+	c, _ := opa2.Params{"approved_cidrs": []interface{}{"10.0.0.0/16"}}.Hash()
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
@@ -0,0 +1,136 @@
+package opa2
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// policyFiles is the policies/ tree as committed, so a binary can seed the rego collection with
+// exactly the policies in git.
+//
+//go:embed policies
+var policyFiles embed.FS
+
+// PolicyFile is one module of a policy tree. Err is set when the module could not be loaded; such
+// a file is reported by policy sync and its stored policy is left alone.
+type PolicyFile struct {
+	Path   string
+	Policy RegoPolicy
+	Err    error
+}
+
+// EmbeddedPolicies loads the policies/ tree compiled into the binary.
+func EmbeddedPolicies() ([]PolicyFile, error) {
+	tree, err := fs.Sub(policyFiles, "policies")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded policies: %w", err)
+	}
+	return LoadPolicyFiles(tree)
+}
+
+// LoadPolicyFiles turns every .rego module of a policy tree, except _test.rego files, into a
+// policy. The name is the path without the extension, the resource type is the first segment of
+// the package and the query is the package's deny rule.
+func LoadPolicyFiles(tree fs.FS) ([]PolicyFile, error) {
+	var files []PolicyFile
+
+	err := fs.WalkDir(tree, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(filePath) != ".rego" || strings.HasSuffix(filePath, "_test.rego") {
+			return nil
+		}
+
+		data, err := fs.ReadFile(tree, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		policy, err := policyFromModule(strings.TrimSuffix(filePath, ".rego"), string(data))
+		files = append(files, PolicyFile{Path: filePath, Policy: policy, Err: err})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy files: %w", err)
+	}
+
+	return files, nil
+}
+
+func policyFromModule(name string, module string) (RegoPolicy, error) {
+	parsed, err := ast.ParseModuleWithOpts(name+".rego", module, ast.ParserOptions{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return RegoPolicy{}, policyError(name+".rego", err)
+	}
+
+	pkg := parsed.Package.Path
+	if len(pkg) < 2 {
+		return RegoPolicy{}, fmt.Errorf("%s: package has no name", name)
+	}
+	resourceType, ok := pkg[1].Value.(ast.String)
+	if !ok {
+		return RegoPolicy{}, fmt.Errorf("%s: unexpected package %s", name, pkg)
+	}
+
+	policy := RegoPolicy{
+		ResourceType: string(resourceType),
+		Name:         name,
+		Enabled:      true,
+		Query:        pkg.String() + ".deny",
+		Rego:         module,
+		Source:       EmbeddedSource,
+	}
+	policy.Hash = PolicyHash(policy.Query, policy.Rego)
+
+	// validated here as well as on write so that sync reports every broken file up front
+	if err := ValidatePolicy(&policy); err != nil {
+		return RegoPolicy{}, err
+	}
+	if err := ParsePolicyMetadata(&policy); err != nil {
+		return RegoPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// PolicyHash identifies the content of a policy version.
+func PolicyHash(query string, module string) string {
+	sum := sha256.Sum256([]byte(query + "\n" + module))
+	return hex.EncodeToString(sum[:])
+}
+
+// UploadClientPolicy stores module as the next version of the client's policy <client ID>/<name>
+// and activates it. The resource type and query are derived from the package like for the
+// policies/ tree, so the module only applies to that client, see ResolvePolicies.
+func UploadClientPolicy(regoRepo RegoRepository, clientID string, name string, module string, reason string) (*RegoPolicy, error) {
+	if clientID == "" || name == "" {
+		return nil, fmt.Errorf("client policy needs a client and a name")
+	}
+
+	policy, err := policyFromModule(clientID+"/"+name, module)
+	if err != nil {
+		return nil, err
+	}
+	policy.ClientID = clientID
+	policy.Source = ""
+
+	versions, err := regoRepo.FindVersions(policy.ResourceType, policy.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.ClientID != clientID {
+			return nil, fmt.Errorf("rego policy %s of resource type %s does not belong to client %s", policy.Name, policy.ResourceType, clientID)
+		}
+	}
+
+	return storeAndActivate(regoRepo, policy, versions, reason)
+}
@@ -0,0 +1,52 @@
+# METADATA
+# title: AWS account-scope checks
+# description: >-
+#   Relates the S3 buckets of the job inventory, data.inventory.s3, to each other. Findings name the
+#   bucket they are about and are reported on its scan result.
+package account.aws
+
+# METADATA
+# title: CloudTrail bucket does not have server access logging.
+# description: Without access logs on the bucket that stores the audit trail, nobody can tell who read or deleted it.
+# custom:
+#   severity: high
+#   remediation: Enable server access logging on the CloudTrail bucket, delivering the logs to a separate bucket.
+#   benchmarks:
+#     cis-aws-3.0: ["3.4"]
+deny contains finding if {
+    some name, bucket in trail_buckets
+    bucket.config.logging == ""
+    finding := {"rule_id": "AWS-ACCT-001", "resource": {"type": "s3", "id": name}}
+}
+
+# METADATA
+# title: CloudTrail bucket delivers its access logs to a public bucket.
+# description: The access logs of the audit trail bucket land in a bucket whose policy allows every principal.
+# custom:
+#   severity: critical
+#   remediation: Deliver the access logs to a bucket without public access, or remove the public statement from the target bucket.
+deny contains finding if {
+    some name, bucket in trail_buckets
+    target := bucket.config.logging.target_bucket
+    public(s3_buckets[target])
+    finding := {"rule_id": "AWS-ACCT-002", "resource": {"type": "s3", "id": name}, "evidence": {"target_bucket": target}}
+}
+
+default s3_buckets := {}
+
+s3_buckets := data.inventory.s3
+
+# buckets whose policy lets CloudTrail write log files
+trail_buckets[name] := bucket if {
+    some name, bucket in s3_buckets
+    some statement in bucket.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    "cloudtrail.amazonaws.com" in as_set(statement.Principal.Service)
+    "s3:PutObject" in as_set(statement.Action)
+}
+
+public(bucket) if woz.iam.is_public(bucket.config.bucket_policy)
+
+as_set(value) := {v | some v in value} if is_array(value)
+
+as_set(value) := {value} if is_string(value)
@@ -0,0 +1,50 @@
+package account.aws_test
+
+import data.account.aws
+
+findings_about(findings) := {[finding.rule_id, finding.resource.id] | some finding in findings}
+
+trail_policy := {"Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "cloudtrail.amazonaws.com"},
+    "Action": "s3:PutObject",
+    "Resource": "arn:aws:s3:::trail/AWSLogs/*",
+}]}
+
+public_policy := {"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::logs/*"}]}
+
+bucket(name, config) := {"resource": {"id": name, "type": "s3", "region": "eu-west-1", "tags": {}}, "config": config}
+
+test_trail_bucket_without_access_logging if {
+    inventory := {"s3": {"trail": bucket("trail", {"bucket_policy": trail_policy, "logging": ""})}}
+    findings := aws.deny with data.inventory as inventory
+    findings_about(findings) == {["AWS-ACCT-001", "trail"]}
+}
+
+test_trail_bucket_logging_to_public_bucket if {
+    inventory := {"s3": {
+        "trail": bucket("trail", {"bucket_policy": trail_policy, "logging": {"target_bucket": "logs", "target_prefix": "trail/"}}),
+        "logs": bucket("logs", {"bucket_policy": public_policy, "logging": ""}),
+    }}
+    findings := aws.deny with data.inventory as inventory
+    findings_about(findings) == {["AWS-ACCT-002", "trail"]}
+}
+
+test_trail_bucket_logging_to_private_bucket if {
+    inventory := {"s3": {
+        "trail": bucket("trail", {"bucket_policy": trail_policy, "logging": {"target_bucket": "logs", "target_prefix": "trail/"}}),
+        "logs": bucket("logs", {"bucket_policy": "", "logging": ""}),
+    }}
+    findings := aws.deny with data.inventory as inventory
+    count(findings) == 0
+}
+
+test_other_buckets_need_no_access_logging if {
+    inventory := {"s3": {"logs": bucket("logs", {"bucket_policy": public_policy, "logging": ""})}}
+    findings := aws.deny with data.inventory as inventory
+    count(findings) == 0
+}
+
+test_empty_inventory if {
+    count(aws.deny) == 0
+}
@@ -1,29 +1,75 @@
+# METADATA
+# title: S3 bucket policy access
+# description: Flags bucket policy statements that open the bucket to every principal.
 package s3
 
 default allow := false
 
-deny[msg] if {
-    bucket_policy := input.bucket_policy
+# METADATA
+# title: Principal is too wide. Restrict access to specific roles or users.
+# description: An Allow statement with Principal "*" applies to every AWS account and to anonymous requests.
+# related_resources:
+# - ref: https://docs.aws.amazon.com/AmazonS3/latest/userguide/example-bucket-policies.html
+# custom:
+#   severity: high
+#   remediation: Replace the wildcard principal in the bucket policy with the specific IAM roles or users that need access.
+#   benchmarks:
+#     cis-aws-3.0: ["2.1.4"]
+deny contains finding if {
+    bucket_policy := input.config.bucket_policy
     statement := bucket_policy.Statement[_]
-    statement.Principal == "*"
-    msg := "Principal is too wide. Restrict access to specific roles or users."
+    statement.Effect == "Allow"
+    everyone(statement)
+    finding := {"rule_id": "AWS-S3-001", "evidence": {"statement": statement}}
 }
 
-deny[msg] if {
-    bucket_policy := input.bucket_policy
-    statement := bucket_policy.Statement[_]
-    statement.Condition["IpAddress"]["aws:SourceIp"] == "0.0.0.0/0"
-    msg := "The SourceIp condition allows access from any IP address. Restrict access to specific IP ranges."
+# METADATA
+# title: The SourceIp condition allows access from public IP addresses. Restrict access to specific private IP ranges.
+# description: >-
+#   An aws:SourceIp condition, given as one CIDR or a list, allows a range with public addresses,
+#   e.g. 0.0.0.0/0, ::/0 or 8.0.0.0/8, so it does not keep requests from the internet out.
+# related_resources:
+# - ref: https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_condition-keys.html#condition-keys-sourceip
+# custom:
+#   severity: high
+#   remediation: Limit the aws:SourceIp condition to the CIDR ranges that need access to the bucket.
+deny contains finding if {
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    some cidr in as_set(statement.Condition.IpAddress["aws:SourceIp"])
+    woz.net.cidr_is_public(cidr)
+    finding := {"rule_id": "AWS-S3-002", "evidence": {"statement": statement, "source_ip": cidr}}
 }
 
-deny[msg] if {
-    bucket_policy := input.bucket_policy
+# METADATA
+# title: 'Allowing access to all (Principal: *) without conditions is a security risk. Please add restrictive conditions.'
+# description: The statement makes the bucket public; nothing limits who can use the granted actions.
+# related_resources:
+# - ref: https://docs.aws.amazon.com/AmazonS3/latest/userguide/access-control-block-public-access.html
+# custom:
+#   severity: critical
+#   remediation: Add conditions such as aws:SourceVpce, aws:SourceIp or aws:PrincipalOrgID to the statement, or remove it.
+#   benchmarks:
+#     cis-aws-3.0: ["2.1.4"]
+deny contains finding if {
+    bucket_policy := input.config.bucket_policy
     statement := bucket_policy.Statement[_]
-    statement.Principal == "*"
+    statement.Effect == "Allow"
+    everyone(statement)
     not statement.Condition
-    msg := "Allowing access to all (Principal: *) without conditions is a security risk. Please add restrictive conditions."
+    finding := {"rule_id": "AWS-S3-003", "evidence": {"statement": statement}}
 }
 
 allow if {
     count(deny) == 0
-}
\ No newline at end of file
+}
+
+# Principal "*" and {"AWS": "*"} both name every principal
+everyone(statement) if {
+    some principal in woz.aws.principals(statement.Principal)
+    principal.id == "*"
+}
+
+as_set(value) := {v | some v in value} if is_array(value)
+
+as_set(value) := {value} if is_string(value)
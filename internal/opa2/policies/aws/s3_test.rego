@@ -0,0 +1,76 @@
+package s3_test
+
+import data.s3
+
+rule_ids(findings) := {finding.rule_id | some finding in findings}
+
+bucket(statements) := {"config": {"bucket_policy": {"Version": "2012-10-17", "Statement": statements}}}
+
+test_public_statement_without_condition if {
+    findings := s3.deny with input as bucket([{
+        "Effect": "Allow",
+        "Principal": "*",
+        "Action": "s3:GetObject",
+        "Resource": "arn:aws:s3:::reports/*",
+    }])
+    rule_ids(findings) == {"AWS-S3-001", "AWS-S3-003"}
+}
+
+test_source_ip_open_to_everyone if {
+    findings := s3.deny with input as bucket([{
+        "Effect": "Allow",
+        "Principal": "*",
+        "Action": "s3:GetObject",
+        "Resource": "arn:aws:s3:::reports/*",
+        "Condition": {"IpAddress": {"aws:SourceIp": "0.0.0.0/0"}},
+    }])
+    rule_ids(findings) == {"AWS-S3-001", "AWS-S3-002"}
+}
+
+test_public_source_ips_in_any_form if {
+    every source_ip in ["::/0", ["10.0.0.0/8", "0.0.0.0/0"], ["8.0.0.0/8"]] {
+        findings := s3.deny with input as bucket([{
+            "Effect": "Allow",
+            "Principal": "*",
+            "Action": "s3:GetObject",
+            "Resource": "arn:aws:s3:::reports/*",
+            "Condition": {"IpAddress": {"aws:SourceIp": source_ip}},
+        }])
+        rule_ids(findings) == {"AWS-S3-001", "AWS-S3-002"}
+    }
+}
+
+test_private_source_ips_are_not_flagged if {
+    findings := s3.deny with input as bucket([{
+        "Effect": "Allow",
+        "Principal": {"AWS": "arn:aws:iam::123456789012:role/reader"},
+        "Action": "s3:GetObject",
+        "Resource": "arn:aws:s3:::reports/*",
+        "Condition": {"IpAddress": {"aws:SourceIp": ["10.0.0.0/8", "192.168.1.0/24"]}},
+    }])
+    count(findings) == 0
+}
+
+test_deny_statement_is_not_flagged if {
+    findings := s3.deny with input as bucket([{
+        "Effect": "Deny",
+        "Principal": "*",
+        "Action": "s3:*",
+        "Resource": "arn:aws:s3:::reports/*",
+        "Condition": {"Bool": {"aws:SecureTransport": "false"}},
+    }])
+    count(findings) == 0
+}
+
+test_specific_principal_is_allowed if {
+    s3.allow with input as bucket([{
+        "Effect": "Allow",
+        "Principal": {"AWS": "arn:aws:iam::123456789012:role/reader"},
+        "Action": "s3:GetObject",
+        "Resource": "arn:aws:s3:::reports/*",
+    }])
+}
+
+test_bucket_without_policy_is_allowed if {
+    s3.allow with input as {"config": {"bucket_policy": ""}}
+}
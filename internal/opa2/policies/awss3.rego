@@ -1,27 +1,149 @@
-package s3
+# METADATA
+# title: S3 bucket policy hardening
+# description: >-
+#   Checks input.config of S3 buckets, whose bucket_policy is the parsed bucket policy document, or ""
+#   when the bucket has none.
+package s3.bucket_hardening
 
-# Check if the bucket has public access (should deny any access for *)
-deny_public_access {
-    input.Statement[_].Principal == "*"
-    input.Statement[_].Effect == "Allow"
-    input.Statement[_].Action == "s3:*"
-    input.Statement[_].Resource == "arn:aws:s3:::*"
+# METADATA
+# title: Bucket policy grants every S3 action to everyone.
+# description: An Allow statement for Principal "*" and Action "s3:*" lets anyone read, overwrite and delete objects.
+# custom:
+#   severity: critical
+#   remediation: Remove the statement or restrict both its principal and its actions.
+#   benchmarks:
+#     cis-aws-3.0: ["2.1.4"]
+deny contains finding if {
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    everyone(statement)
+    some action in as_set(statement.Action)
+    woz.iam.action_matches(action, "s3:*")
+    finding := {"rule_id": "AWS-S3-101", "evidence": {"statement": statement}}
 }
 
-# Check if the bucket has unrestricted access (e.g., * is used for actions or resources)
-deny_unrestricted_access {
-    input.Statement[_].Principal == "*"
-    input.Statement[_].Effect == "Allow"
-    input.Statement[_].Action == "s3:*"
-    input.Statement[_].Resource == "arn:aws:s3:::my-bucket/*"
+# METADATA
+# title: Bucket policy allows unrestricted actions or resources.
+# description: A wildcard action or resource grants more than the statement's principals need.
+# custom:
+#   severity: high
+#   remediation: List the specific actions and the bucket or object ARNs the statement needs.
+deny contains finding if {
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    unrestricted(statement)
+    finding := {"rule_id": "AWS-S3-102", "evidence": {"statement": statement}}
 }
 
-# Check if the bucket has no encryption (should have encryption enabled)
-deny_missing_encryption {
-    not input.Statement[_].Condition.encryption
+# METADATA
+# title: Bucket policy does not deny requests made without TLS.
+# description: Without a Deny on aws:SecureTransport, objects can be read and written over plain HTTP.
+# related_resources:
+# - ref: https://docs.aws.amazon.com/AmazonS3/latest/userguide/security-best-practices.html
+# custom:
+#   severity: medium
+#   remediation: 'Add a Deny statement for all principals with the condition {"Bool": {"aws:SecureTransport": "false"}}.'
+#   benchmarks:
+#     cis-aws-3.0: ["2.1.1"]
+deny contains finding if {
+    is_object(input.config.bucket_policy)
+    not enforces_tls
+    finding := {"rule_id": "AWS-S3-103"}
 }
 
-# Ensure only specific IPs have access (whitelisted IPs)
-deny_non_whitelisted_ip {
-    not input.Statement[_].Condition.IpAddress["aws:SourceIp"] == "10.0.0.0/24"
-}
\ No newline at end of file
+# METADATA
+# title: Bucket policy grants access to an account the client does not trust.
+# description: >-
+#   An Allow statement names an AWS principal outside the client's trusted_accounts and
+#   partner_principals params. Only checked when the client lists trusted accounts.
+# custom:
+#   severity: high
+#   remediation: Remove the principal, or add its account to the client's trusted_accounts params if the access is intended.
+deny contains finding if {
+    count(trusted_accounts) > 0
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    some principal in woz.aws.principals(statement.Principal)
+    principal.type == "AWS"
+    not partner(principal)
+    not principal.account in {"", "*"}
+    not principal.account in trusted_accounts
+    finding := {"rule_id": "AWS-S3-104", "evidence": {"principal": principal.id, "account": principal.account}}
+}
+
+# METADATA
+# title: Bucket policy allows source IPs outside the approved ranges.
+# description: >-
+#   An aws:SourceIp condition allows a range that no CIDR of the client's approved_cidrs params
+#   contains. Only checked when the client lists approved CIDRs.
+# custom:
+#   severity: medium
+#   remediation: Narrow the aws:SourceIp condition to the approved ranges, or add the range to the client's approved_cidrs params.
+deny contains finding if {
+    count(approved_cidrs) > 0
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Allow"
+    some cidr in source_ips(statement)
+    not approved(cidr)
+    finding := {"rule_id": "AWS-S3-105", "evidence": {"source_ip": cidr}}
+}
+
+# Client params, see opa2.Params. Every list is empty for clients without params.
+default trusted_accounts := []
+
+trusted_accounts := data.params.trusted_accounts
+
+default partner_principals := []
+
+partner_principals := data.params.partner_principals
+
+default approved_cidrs := []
+
+approved_cidrs := data.params.approved_cidrs
+
+# Action and Resource may be a string or a list, e.g. "*" or ["s3:GetObject", "*"]
+unrestricted(statement) if {
+    some action in as_set(statement.Action)
+    woz.iam.action_matches(action, "*")
+}
+
+unrestricted(statement) if {
+    some resource in as_set(statement.Resource)
+    resource in {"*", "arn:aws:s3:::*"}
+}
+
+# the condition value may be the string "false" or the boolean false, or a list of either
+enforces_tls if {
+    some statement in input.config.bucket_policy.Statement
+    statement.Effect == "Deny"
+    some value in as_set(statement.Condition.Bool["aws:SecureTransport"])
+    lower(sprintf("%v", [value])) == "false"
+}
+
+# Principal "*" and {"AWS": "*"} both name every principal
+everyone(statement) if {
+    some principal in woz.aws.principals(statement.Principal)
+    principal.id == "*"
+}
+
+# partner principals may be listed as ARNs or as account IDs
+partner(principal) if {
+    some partner in partner_principals
+    principal.id in {partner, sprintf("arn:aws:iam::%s:root", [partner])}
+}
+
+as_set(value) := {v | some v in value} if is_array(value)
+
+as_set(value) := {value} if {
+    not is_array(value)
+    not is_object(value)
+}
+
+source_ips(statement) := {c | some c in statement.Condition.IpAddress["aws:SourceIp"]} if is_array(statement.Condition.IpAddress["aws:SourceIp"])
+
+source_ips(statement) := {statement.Condition.IpAddress["aws:SourceIp"]} if is_string(statement.Condition.IpAddress["aws:SourceIp"])
+
+approved(cidr) if {
+    some range in approved_cidrs
+    net.cidr_contains(range, cidr)
+}
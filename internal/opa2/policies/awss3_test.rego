@@ -0,0 +1,159 @@
+package s3.bucket_hardening_test
+
+import data.s3.bucket_hardening
+
+rule_ids(findings) := {finding.rule_id | some finding in findings}
+
+enforce_tls := {
+    "Effect": "Deny",
+    "Principal": "*",
+    "Action": "s3:*",
+    "Resource": ["arn:aws:s3:::reports", "arn:aws:s3:::reports/*"],
+    "Condition": {"Bool": {"aws:SecureTransport": "false"}},
+}
+
+bucket(statements) := {"config": {"bucket_policy": {"Version": "2012-10-17", "Statement": statements}}}
+
+test_full_access_for_everyone if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    rule_ids(findings) == {"AWS-S3-101"}
+}
+
+test_full_access_for_everyone_in_any_form if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": ["*"]}, "Action": ["s3:GetObject", "S3:*"], "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    rule_ids(findings) == {"AWS-S3-101"}
+}
+
+test_wildcard_action if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "*", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    rule_ids(findings) == {"AWS-S3-102"}
+}
+
+test_wildcard_resource if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::*"},
+        enforce_tls,
+    ])
+    rule_ids(findings) == {"AWS-S3-102"}
+}
+
+test_wildcard_action_in_a_list if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": ["s3:GetObject", "*"], "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    rule_ids(findings) == {"AWS-S3-102"}
+}
+
+test_wildcard_resource_in_a_list if {
+    every resources in [["*"], ["arn:aws:s3:::reports/*", "arn:aws:s3:::*"]] {
+        findings := bucket_hardening.deny with input as bucket([
+            {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": resources},
+            enforce_tls,
+        ])
+        rule_ids(findings) == {"AWS-S3-102"}
+    }
+}
+
+test_tls_enforced_with_a_boolean if {
+    every value in [false, [false], "False"] {
+        findings := bucket_hardening.deny with input as bucket([
+            {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+            object.union(enforce_tls, {"Condition": {"Bool": {"aws:SecureTransport": value}}}),
+        ])
+        count(findings) == 0
+    }
+}
+
+test_tls_allowed_is_not_enforcement if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        object.union(enforce_tls, {"Condition": {"Bool": {"aws:SecureTransport": true}}}),
+    ])
+    rule_ids(findings) == {"AWS-S3-103"}
+}
+
+test_missing_tls_enforcement if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+    ])
+    rule_ids(findings) == {"AWS-S3-103"}
+}
+
+test_hardened_bucket if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    count(findings) == 0
+}
+
+test_bucket_without_policy if {
+    findings := bucket_hardening.deny with input as {"config": {"bucket_policy": ""}}
+    count(findings) == 0
+}
+
+params := {
+    "trusted_accounts": ["123456789012"],
+    "partner_principals": ["arn:aws:iam::444455556666:role/auditor"],
+    "approved_cidrs": ["10.0.0.0/8"],
+}
+
+test_untrusted_account if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::123456789012:role/reader", "arn:aws:iam::999999999999:root"]}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ]) with data.params as params
+    rule_ids(findings) == {"AWS-S3-104"}
+    some finding in findings
+    finding.evidence.account == "999999999999"
+}
+
+test_partner_principal_is_trusted if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::444455556666:role/auditor"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ]) with data.params as params
+    count(findings) == 0
+}
+
+test_partner_account_is_trusted if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "444455556666"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ]) with data.params as object.union(params, {"partner_principals": ["444455556666"]})
+    count(findings) == 0
+}
+
+test_accounts_are_not_checked_without_params if {
+    findings := bucket_hardening.deny with input as bucket([
+        {"Effect": "Allow", "Principal": {"AWS": "999999999999"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::reports/*"},
+        enforce_tls,
+    ])
+    count(findings) == 0
+}
+
+test_source_ip_outside_approved_ranges if {
+    findings := bucket_hardening.deny with input as bucket([
+        {
+            "Effect": "Allow",
+            "Principal": {"AWS": "123456789012"},
+            "Action": "s3:GetObject",
+            "Resource": "arn:aws:s3:::reports/*",
+            "Condition": {"IpAddress": {"aws:SourceIp": ["10.1.0.0/16", "203.0.113.0/24"]}},
+        },
+        enforce_tls,
+    ]) with data.params as params
+    rule_ids(findings) == {"AWS-S3-105"}
+    some finding in findings
+    finding.evidence.source_ip == "203.0.113.0/24"
+}
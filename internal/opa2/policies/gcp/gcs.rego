@@ -0,0 +1,36 @@
+# METADATA
+# title: GCS bucket IAM access
+# description: >-
+#   Flags bucket IAM bindings that open the bucket to everyone. The bucket policy is the list of
+#   bindings of the bucket's IAM policy, each a role and its members.
+package gcs
+
+default allow := false
+
+# METADATA
+# title: Bucket is publicly accessible. Remove allUsers and allAuthenticatedUsers from its IAM policy.
+# description: >-
+#   A binding grants a role to allUsers, anyone on the internet, or to allAuthenticatedUsers, anyone
+#   signed in to a Google account, so the bucket is not limited to the project's principals.
+# related_resources:
+# - ref: https://cloud.google.com/storage/docs/access-control/making-data-public
+# custom:
+#   severity: critical
+#   remediation: Remove allUsers and allAuthenticatedUsers from the bucket's IAM bindings and enforce public access prevention on the bucket.
+#   benchmarks:
+#     cis-gcp-2.0: ["5.1"]
+deny contains finding if {
+    some binding in bindings
+    some member in binding.members
+    woz.gcp.member(member).public
+    finding := {"rule_id": "GCP-GCS-001", "evidence": {"role": binding.role, "member": member}}
+}
+
+allow if {
+    count(deny) == 0
+}
+
+default bindings := []
+
+# "" is a bucket whose IAM policy could not be read
+bindings := input.config.bucket_policy if is_array(input.config.bucket_policy)
@@ -0,0 +1,38 @@
+package gcs_test
+
+import data.gcs
+
+rule_ids(findings) := {finding.rule_id | some finding in findings}
+
+bucket(bindings) := {"config": {"bucket_policy": bindings}}
+
+test_all_users_is_public if {
+    findings := gcs.deny with input as bucket([
+        {"role": "roles/storage.legacyBucketOwner", "members": ["projectOwner:media-prod"]},
+        {"role": "roles/storage.objectViewer", "members": ["allUsers"]},
+    ])
+    rule_ids(findings) == {"GCP-GCS-001"}
+    some finding in findings
+    finding.evidence == {"role": "roles/storage.objectViewer", "member": "allUsers"}
+}
+
+test_all_authenticated_users_is_public if {
+    findings := gcs.deny with input as bucket([
+        {"role": "roles/storage.objectViewer", "members": ["group:media@example.com", "allAuthenticatedUsers"]},
+    ])
+    rule_ids(findings) == {"GCP-GCS-001"}
+}
+
+test_project_members_are_not_flagged if {
+    findings := gcs.deny with input as bucket([
+        {"role": "roles/storage.legacyBucketOwner", "members": ["projectOwner:media-prod", "projectEditor:media-prod"]},
+        {"role": "roles/storage.objectAdmin", "members": ["serviceAccount:uploader@media-prod.iam.gserviceaccount.com"]},
+        {"role": "roles/storage.objectViewer", "members": ["domain:example.com", "user:alice@example.com"]},
+    ])
+    count(findings) == 0
+    gcs.allow with input as bucket([])
+}
+
+test_unreadable_policy_is_not_flagged if {
+    count(gcs.deny) == 0 with input as bucket("")
+}
@@ -0,0 +1,44 @@
+package opa2_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegoPolicies runs the _test.rego files next to the policies and the fixtures under
+// testdata/fixtures. Run it with -v to see the coverage of each rule.
+func TestRegoPolicies(t *testing.T) {
+	fixtures, err := opa2.LoadFixtures(os.DirFS("testdata/fixtures"))
+	require.NoError(t, err)
+
+	report, err := opa2.RunPolicyTests(context.Background(), os.DirFS("policies"), fixtures)
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Tests)
+
+	for _, result := range report.Tests {
+		t.Run(result.Name, func(t *testing.T) {
+			assert.True(t, result.Pass, "%s: %s", result.File, result.Message)
+		})
+	}
+
+	for _, result := range report.Fixtures {
+		t.Run(result.Fixture.ResourceType+"/"+result.Fixture.Name, func(t *testing.T) {
+			assert.NoError(t, result.Err)
+			assert.Equal(t, result.Fixture.Outcome, result.Outcome)
+			assert.ElementsMatch(t, result.Fixture.RuleIDs, result.RuleIDs)
+		})
+	}
+
+	for _, rule := range report.Coverage {
+		name := rule.Rule
+		if rule.RuleID != "" {
+			name += " " + rule.RuleID
+		}
+		t.Logf("%s:%d %-24s %5.1f%%", rule.File, rule.Row, name, rule.Coverage())
+	}
+}
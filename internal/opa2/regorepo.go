@@ -2,6 +2,7 @@ package opa2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,34 +11,113 @@ import (
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type RegoRepository interface {
 	Create(rego *RegoPolicy) (bson.ObjectID, error)
-	FindByResourceType(resourceType string) (*RegoPolicy, error)
+	CreateDraft(rego *RegoPolicy) (*RegoPolicy, error)
+	FindByResourceType(resourceType string, clientID string) ([]RegoPolicy, error)
+	FindByName(resourceType string, name string) (*RegoPolicy, error)
+	FindVersions(resourceType string, name string) ([]RegoPolicy, error)
+	FindActive() ([]RegoPolicy, error)
+	SetEnabled(resourceType string, name string, enabled bool) error
+	Activate(resourceType string, name string, version int, reason string) error
+	Rollback(resourceType string, name string, reason string) (int, error)
+	Retire(resourceType string, name string, reason string) error
+	History(resourceType string, name string) ([]PolicyActivation, error)
+	Watch(ctx context.Context, changed func(id bson.ObjectID)) error
 }
 
+var ErrNoPreviousVersion = errors.New("no previous version to roll back to")
+
+// ErrPolicyExists is returned when a policy, or the version of it being created, is already stored.
+var ErrPolicyExists = errors.New("rego policy already exists")
+
 type regoRepository struct {
-	collection *mongo.Collection
+	db database.Service
 }
 
 func NewRegoRepository(db database.Service) RegoRepository {
 	return &regoRepository{
-		collection: db.GetCollection("rego"),
+		db: db,
 	}
 }
 
+func (r *regoRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("rego")
+}
+
+func (r *regoRepository) history() *mongo.Collection {
+	return r.db.GetCollection("rego_activation")
+}
+
+// EnsureRegoIndexes creates the unique index on the resource type, name and version of rego
+// policies, so that two concurrent writers cannot both create a policy or the same version of it.
+// It is idempotent and meant to run before policies are written.
+func EnsureRegoIndexes(db database.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "resource_type", Value: 1}, {Key: "name", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetName("rego_version").SetUnique(true),
+	}
+	if _, err := db.GetCollection("rego").Indexes().CreateOne(ctx, index); err != nil {
+		log.Error().Err(err).Str("function", "EnsureRegoIndexes").Msg("Failed to create rego index")
+		return fmt.Errorf("failed to create rego index: %w", err)
+	}
+	return nil
+}
+
+// activeFilter matches the active version of a policy. Policies stored before versioning have no
+// state and count as active.
+func activeFilter(resourceType string, name string) bson.M {
+	return bson.M{
+		"resource_type": resourceType,
+		"name":          name,
+		"state":         bson.M{"$nin": bson.A{PolicyDraft, PolicyRetired}},
+	}
+}
+
+// Create stores version 1 of a new policy as a draft. Names are unique within a resource type, an
+// existing name is rejected with ErrPolicyExists, and a module that does not pass ValidatePolicy is
+// rejected with a *PolicyError. Rule metadata is read
+// from its annotations, see ParsePolicyMetadata.
 func (r *regoRepository) Create(rego *RegoPolicy) (bson.ObjectID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	existingRego, _ := r.FindByResourceType(rego.ResourceType)
-	if existingRego != nil {
-		log.Error().Str("function", "Create").Str("ResourceType", rego.ResourceType).Msg("rego policy with the same resource type already exists")
-		return bson.NilObjectID, fmt.Errorf("rego policy with resource type %s already exists", rego.ResourceType)
+	if err := ValidatePolicy(rego); err != nil {
+		log.Warn().Err(err).Str("function", "Create").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rejected invalid rego policy")
+		return bson.NilObjectID, err
+	}
+	if err := ParsePolicyMetadata(rego); err != nil {
+		log.Warn().Err(err).Str("function", "Create").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rejected rego policy with invalid annotations")
+		return bson.NilObjectID, err
+	}
+
+	// the unique index of EnsureRegoIndexes settles concurrent creates; the count also catches
+	// policies stored before versioning, which have no version 1
+	existing, err := r.collection().CountDocuments(ctx, bson.M{"resource_type": rego.ResourceType, "name": rego.Name})
+	if err != nil {
+		log.Error().Err(err).Str("function", "Create").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("failed to check for existing rego policy")
+		return bson.NilObjectID, fmt.Errorf("failed to check for existing rego policy %s: %w", rego.Name, err)
 	}
+	if existing > 0 {
+		log.Error().Str("function", "Create").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rego policy with the same name already exists")
+		return bson.NilObjectID, fmt.Errorf("%w: %s for resource type %s", ErrPolicyExists, rego.Name, rego.ResourceType)
+	}
+
+	rego.Version = 1
+	rego.State = PolicyDraft
+	rego.CreatedAt = time.Now()
 
-	result, err := r.collection.InsertOne(ctx, rego)
+	result, err := r.collection().InsertOne(ctx, rego)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Error().Str("function", "Create").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rego policy with the same name already exists")
+		return bson.NilObjectID, fmt.Errorf("%w: %s for resource type %s", ErrPolicyExists, rego.Name, rego.ResourceType)
+	}
 	if err != nil {
 		log.Error().Err(err).Str("function", "Create").Str("Rego ID", rego.ID.Hex()).Msg("failed to create new rego poilicy")
 		return bson.NilObjectID, fmt.Errorf("failed to insert rego")
@@ -53,22 +133,353 @@ func (r *regoRepository) Create(rego *RegoPolicy) (bson.ObjectID, error) {
 	return insertedID, nil
 }
 
-func (r *regoRepository) FindByResourceType(resourceType string) (*RegoPolicy, error) {
+// CreateDraft stores the next version of an existing policy as a draft. The active version keeps
+// being evaluated until the draft is activated. The module is validated like in Create.
+func (r *regoRepository) CreateDraft(rego *RegoPolicy) (*RegoPolicy, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var rego RegoPolicy
+	if err := ValidatePolicy(rego); err != nil {
+		log.Warn().Err(err).Str("function", "CreateDraft").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rejected invalid rego policy")
+		return nil, err
+	}
+	if err := ParsePolicyMetadata(rego); err != nil {
+		log.Warn().Err(err).Str("function", "CreateDraft").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("rejected rego policy with invalid annotations")
+		return nil, err
+	}
 
-	err := r.collection.FindOne(ctx, bson.M{"resource_type": resourceType}).Decode(&rego)
+	var latest RegoPolicy
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := r.collection().FindOne(ctx, bson.M{"resource_type": rego.ResourceType, "name": rego.Name}, opts).Decode(&latest)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			log.Warn().Str("function", "FindByResourceType").Str("Resoruce Type:", resourceType).Msg("No rego policy found for resource type")
-			return nil, fmt.Errorf("no rego policy found for resource type %s", resourceType)
+			return nil, fmt.Errorf("no rego policy %s found for resource type %s", rego.Name, rego.ResourceType)
 		}
+		log.Error().Err(err).Str("function", "CreateDraft").Str("ResourceType", rego.ResourceType).Str("Name", rego.Name).Msg("Failed to find latest version")
+		return nil, fmt.Errorf("failed to find latest version of rego policy %s: %w", rego.Name, err)
+	}
+
+	draft := *rego
+	draft.ID = bson.NilObjectID
+	draft.Version = latest.Version + 1
+	draft.State = PolicyDraft
+	draft.Enabled = latest.Enabled
+	draft.CreatedAt = time.Now()
+	draft.ActivatedAt = nil
+	draft.RetiredAt = nil
+
+	result, err := r.collection().InsertOne(ctx, draft)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Error().Str("function", "CreateDraft").Str("Name", rego.Name).Int("version", draft.Version).Msg("rego policy version was created concurrently")
+		return nil, fmt.Errorf("%w: version %d of %s for resource type %s", ErrPolicyExists, draft.Version, rego.Name, rego.ResourceType)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("function", "CreateDraft").Str("Name", rego.Name).Int("version", draft.Version).Msg("failed to create rego policy draft")
+		return nil, fmt.Errorf("failed to insert version %d of rego policy %s: %w", draft.Version, rego.Name, err)
+	}
+	draft.ID = result.InsertedID.(bson.ObjectID)
+
+	log.Info().Str("function", "CreateDraft").Str("Rego ID", draft.ID.Hex()).Str("Name", draft.Name).Int("version", draft.Version).Msg("rego policy draft created successfully")
+	return &draft, nil
+}
+
+// FindByResourceType returns the active version of every enabled policy of a resource type that
+// applies to the client: the built-in policies and the client's own, ordered by name. Policies
+// stored before the enabled flag or client IDs existed count as enabled built-in policies.
+func (r *regoRepository) FindByResourceType(resourceType string, clientID string) ([]RegoPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"resource_type": resourceType,
+		"client_id":     bson.M{"$in": bson.A{"", nil, clientID}}, // nil also matches a missing client_id
+		"enabled":       bson.M{"$ne": false},
+		"state":         bson.M{"$nin": bson.A{PolicyDraft, PolicyRetired}},
+	}
+
+	cursor, err := r.collection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
 		log.Error().Err(err).Str("function", "FindByResourceType").Str("ResourceType", resourceType).Msg("Failed to execute find")
-		return nil, fmt.Errorf("failed to execute find for rego policy by resource type %s", resourceType)
+		return nil, fmt.Errorf("failed to execute find for rego policies by resource type %s: %w", resourceType, err)
+	}
+	defer cursor.Close(ctx)
+
+	var regos []RegoPolicy
+	if err := cursor.All(ctx, &regos); err != nil {
+		log.Error().Err(err).Str("function", "FindByResourceType").Str("ResourceType", resourceType).Msg("Failed to decode rego policies")
+		return nil, fmt.Errorf("failed to decode rego policies for resource type %s: %w", resourceType, err)
+	}
+
+	return regos, nil
+}
+
+// FindByName returns the active version of a policy.
+func (r *regoRepository) FindByName(resourceType string, name string) (*RegoPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rego RegoPolicy
+
+	err := r.collection().FindOne(ctx, activeFilter(resourceType, name)).Decode(&rego)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no active rego policy %s found for resource type %s", name, resourceType)
+		}
+		log.Error().Err(err).Str("function", "FindByName").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to execute find for rego policy %s: %w", name, err)
 	}
 
 	return &rego, nil
+}
+
+// FindVersions returns every version of a policy, newest first.
+func (r *regoRepository) FindVersions(resourceType string, name string) ([]RegoPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := r.collection().Find(ctx, bson.M{"resource_type": resourceType, "name": name}, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "FindVersions").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to find versions of rego policy %s: %w", name, err)
+	}
+	defer cursor.Close(ctx)
+
+	var regos []RegoPolicy
+	if err := cursor.All(ctx, &regos); err != nil {
+		log.Error().Err(err).Str("function", "FindVersions").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to decode rego policies")
+		return nil, fmt.Errorf("failed to decode versions of rego policy %s: %w", name, err)
+	}
+
+	return regos, nil
+}
+
+// FindActive returns the active version of every policy, enabled or not.
+func (r *regoRepository) FindActive() ([]RegoPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"state": bson.M{"$nin": bson.A{PolicyDraft, PolicyRetired}}}
+	opts := options.Find().SetSort(bson.D{{Key: "resource_type", Value: 1}, {Key: "name", Value: 1}})
+
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "FindActive").Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to find active rego policies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var regos []RegoPolicy
+	if err := cursor.All(ctx, &regos); err != nil {
+		log.Error().Err(err).Str("function", "FindActive").Msg("Failed to decode rego policies")
+		return nil, fmt.Errorf("failed to decode active rego policies: %w", err)
+	}
+
+	return regos, nil
+}
 
+// SetEnabled switches every version of a policy on or off without changing which one is active.
+func (r *regoRepository) SetEnabled(resourceType string, name string, enabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection().UpdateMany(ctx, bson.M{"resource_type": resourceType, "name": name}, bson.M{"$set": bson.M{"enabled": enabled}})
+	if err != nil {
+		log.Error().Err(err).Str("function", "SetEnabled").Str("ResourceType", resourceType).Str("Name", name).Msg("failed to update rego policy")
+		return fmt.Errorf("failed to set enabled on rego policy %s: %w", name, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no rego policy %s found for resource type %s", name, resourceType)
+	}
+
+	log.Info().Str("function", "SetEnabled").Str("ResourceType", resourceType).Str("Name", name).Bool("enabled", enabled).Msg("rego policy updated successfully")
+	return nil
+}
+
+// Activate makes version the active version of a policy, retiring the version it replaces, and
+// records the change in the activation history. Both happen in one transaction.
+func (r *regoRepository) Activate(resourceType string, name string, version int, reason string) error {
+	return r.activate(resourceType, name, version, ActivateAction, reason)
+}
+
+// Rollback reactivates the version that was active before the policy's last activation or
+// retirement, and returns it.
+func (r *regoRepository) Rollback(resourceType string, name string, reason string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var last PolicyActivation
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	err := r.history().FindOne(ctx, bson.M{"resource_type": resourceType, "name": name}, opts).Decode(&last)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, ErrNoPreviousVersion
+		}
+		log.Error().Err(err).Str("function", "Rollback").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to find last activation")
+		return 0, fmt.Errorf("failed to find last activation of rego policy %s: %w", name, err)
+	}
+	if last.PreviousVersion == 0 {
+		return 0, ErrNoPreviousVersion
+	}
+
+	if err := r.activate(resourceType, name, last.PreviousVersion, RollbackAction, reason); err != nil {
+		return 0, err
+	}
+	return last.PreviousVersion, nil
+}
+
+func (r *regoRepository) activate(resourceType string, name string, version int, action string, reason string) error {
+	err := database.WithTransaction(r.collection().Database().Client(), func(ctx context.Context) error {
+		var target RegoPolicy
+		err := r.collection().FindOne(ctx, bson.M{"resource_type": resourceType, "name": name, "version": version}).Decode(&target)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("no version %d of rego policy %s found for resource type %s", version, name, resourceType)
+			}
+			return fmt.Errorf("failed to find version %d of rego policy %s: %w", version, name, err)
+		}
+		if target.State == PolicyActive {
+			return fmt.Errorf("version %d of rego policy %s is already active", version, name)
+		}
+
+		now := time.Now()
+
+		previous, err := r.retireActive(ctx, resourceType, name, now)
+		if err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"state": PolicyActive, "activated_at": now},
+			"$unset": bson.M{"retired_at": ""},
+		}
+		if _, err := r.collection().UpdateByID(ctx, target.ID, update); err != nil {
+			return fmt.Errorf("failed to activate version %d of rego policy %s: %w", version, name, err)
+		}
+
+		return r.recordActivation(ctx, PolicyActivation{
+			ResourceType:    resourceType,
+			Name:            name,
+			Action:          action,
+			Version:         version,
+			PreviousVersion: previous,
+			Reason:          reason,
+			CreatedAt:       now,
+		})
+	})
+	if err != nil {
+		log.Error().Err(err).Str("function", "activate").Str("ResourceType", resourceType).Str("Name", name).Int("version", version).Msg("Failed to activate rego policy")
+		return err
+	}
+
+	log.Info().Str("function", "activate").Str("ResourceType", resourceType).Str("Name", name).Int("version", version).Str("action", action).Msg("rego policy activated successfully")
+	return nil
+}
+
+// Retire stops evaluating a policy by retiring its active version without a replacement.
+func (r *regoRepository) Retire(resourceType string, name string, reason string) error {
+	err := database.WithTransaction(r.collection().Database().Client(), func(ctx context.Context) error {
+		now := time.Now()
+
+		previous, err := r.retireActive(ctx, resourceType, name, now)
+		if err != nil {
+			return err
+		}
+		if previous == 0 {
+			return fmt.Errorf("no active rego policy %s found for resource type %s", name, resourceType)
+		}
+
+		return r.recordActivation(ctx, PolicyActivation{
+			ResourceType:    resourceType,
+			Name:            name,
+			Action:          RetireAction,
+			PreviousVersion: previous,
+			Reason:          reason,
+			CreatedAt:       now,
+		})
+	})
+	if err != nil {
+		log.Error().Err(err).Str("function", "Retire").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to retire rego policy")
+		return err
+	}
+
+	log.Info().Str("function", "Retire").Str("ResourceType", resourceType).Str("Name", name).Msg("rego policy retired successfully")
+	return nil
+}
+
+// retireActive retires the active version of a policy, if any, and returns its version.
+func (r *regoRepository) retireActive(ctx context.Context, resourceType string, name string, now time.Time) (int, error) {
+	var current RegoPolicy
+	err := r.collection().FindOne(ctx, activeFilter(resourceType, name)).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find active version of rego policy %s: %w", name, err)
+	}
+
+	update := bson.M{"$set": bson.M{"state": PolicyRetired, "retired_at": now}}
+	if _, err := r.collection().UpdateByID(ctx, current.ID, update); err != nil {
+		return 0, fmt.Errorf("failed to retire version %d of rego policy %s: %w", current.Version, name, err)
+	}
+
+	return current.Version, nil
+}
+
+func (r *regoRepository) recordActivation(ctx context.Context, activation PolicyActivation) error {
+	if _, err := r.history().InsertOne(ctx, activation); err != nil {
+		return fmt.Errorf("failed to record activation of rego policy %s: %w", activation.Name, err)
+	}
+	return nil
+}
+
+// History returns the activations of a policy, newest first.
+func (r *regoRepository) History(resourceType string, name string) ([]PolicyActivation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := r.history().Find(ctx, bson.M{"resource_type": resourceType, "name": name}, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "History").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to find activation history of rego policy %s: %w", name, err)
+	}
+	defer cursor.Close(ctx)
+
+	var activations []PolicyActivation
+	if err := cursor.All(ctx, &activations); err != nil {
+		log.Error().Err(err).Str("function", "History").Str("ResourceType", resourceType).Str("Name", name).Msg("Failed to decode activation history")
+		return nil, fmt.Errorf("failed to decode activation history of rego policy %s: %w", name, err)
+	}
+
+	return activations, nil
+}
+
+// Watch calls changed with the ID of every policy inserted, updated or deleted, until ctx is done or
+// the change stream fails. It needs MongoDB to run as a replica set.
+func (r *regoRepository) Watch(ctx context.Context, changed func(id bson.ObjectID)) error {
+	stream, err := r.collection().Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return fmt.Errorf("failed to watch rego collection: %w", err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			DocumentKey struct {
+				ID bson.ObjectID `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return fmt.Errorf("failed to decode rego change event: %w", err)
+		}
+		if !event.DocumentKey.ID.IsZero() {
+			changed(event.DocumentKey.ID)
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return fmt.Errorf("rego change stream failed: %w", err)
+	}
+	return fmt.Errorf("rego change stream closed")
 }
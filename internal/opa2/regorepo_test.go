@@ -0,0 +1,87 @@
+package opa2_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/config"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// newDatabase connects to the MongoDB of MONGO_DB_STRING.
+func newDatabase(t *testing.T) database.Service {
+	cfg := config.Defaults().Mongo
+	cfg.URI = os.Getenv("MONGO_DB_STRING")
+	if cfg.URI == "" {
+		t.Skip("MONGO_DB_STRING not set")
+	}
+
+	db, err := database.New(cfg)
+	require.NoError(t, err)
+	return db
+}
+
+func TestFindByResourceTypeOnlyReturnsClientPolicies(t *testing.T) {
+	db := newDatabase(t)
+	// a resource type of its own, so runs do not see each other's policies
+	resourceType := "test-" + bson.NewObjectID().Hex()
+
+	_, err := db.GetCollection("rego").InsertMany(context.Background(), []interface{}{
+		bson.M{"resource_type": resourceType, "name": "builtin", "client_id": "", "state": opa2.PolicyActive, "enabled": true},
+		bson.M{"resource_type": resourceType, "name": "legacy"}, // stored before policies had a client
+		bson.M{"resource_type": resourceType, "name": "acme/own", "client_id": "acme", "state": opa2.PolicyActive, "enabled": true},
+		bson.M{"resource_type": resourceType, "name": "globex/own", "client_id": "globex", "state": opa2.PolicyActive, "enabled": true},
+	})
+	require.NoError(t, err)
+
+	repo := opa2.NewRegoRepository(db)
+
+	policies, err := repo.FindByResourceType(resourceType, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme/own", "builtin", "legacy"}, policyNames(policies))
+
+	policies, err = repo.FindByResourceType(resourceType, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"builtin", "legacy"}, policyNames(policies))
+}
+
+func TestCreateRejectsExistingPolicies(t *testing.T) {
+	db := newDatabase(t)
+	require.NoError(t, opa2.EnsureRegoIndexes(db))
+	repo := opa2.NewRegoRepository(db)
+
+	// a resource type of its own, so runs do not see each other's policies
+	resourceType := "test" + bson.NewObjectID().Hex()
+	first := &opa2.RegoPolicy{
+		ResourceType: resourceType,
+		Name:         "public",
+		Query:        "data." + resourceType + ".deny",
+		Rego:         "package " + resourceType + "\n\ndeny contains \"public\" if input.config.public\n",
+	}
+	_, err := repo.Create(first)
+	require.NoError(t, err)
+
+	again := *first
+	again.ID = bson.NilObjectID
+	_, err = repo.Create(&again)
+	assert.ErrorIs(t, err, opa2.ErrPolicyExists)
+
+	// a version 1 written past the existence check, as by a concurrent create, hits the index
+	_, err = db.GetCollection("rego").InsertOne(context.Background(), bson.M{"resource_type": first.ResourceType, "name": first.Name, "version": 1})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+}
+
+func policyNames(policies []opa2.RegoPolicy) []string {
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
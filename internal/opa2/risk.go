@@ -0,0 +1,172 @@
+package opa2
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/iampolicy"
+)
+
+// Exposure is who can reach a resource.
+type Exposure string
+
+const (
+	ExposurePublic   Exposure = "public"   // anyone on the internet, e.g. through a bucket policy or binding to allUsers
+	ExposureInternal Exposure = "internal" // only principals of the client, or not known to be public
+)
+
+// Risk is what the risk of a resource's findings depends on besides their severity and age. It is
+// read from the resource's config and tags, see ResourceRisk.
+type Risk struct {
+	Exposure    Exposure `bson:"exposure" json:"exposure"`
+	Sensitive   bool     `bson:"sensitive" json:"sensitive"`                         // tagged as holding sensitive data
+	Environment string   `bson:"environment,omitempty" json:"environment,omitempty"` // prod, staging or dev, empty when untagged
+}
+
+// Tags that mark a resource as holding sensitive data when they have one of sensitiveTagValues,
+// and tags that name its environment. GCP labels are lower case, so values are compared lower cased.
+var (
+	sensitivityTagKeys = []string{"data-classification", "data_classification", "classification", "sensitivity"}
+	sensitiveTagValues = []string{"confidential", "restricted", "sensitive", "secret", "pii", "phi", "pci"}
+	environmentTagKeys = []string{"environment", "env", "stage"}
+	environmentAliases = map[string]string{
+		"prod": "prod", "production": "prod", "prd": "prod", "live": "prod",
+		"staging": "staging", "stage": "staging", "stg": "staging", "uat": "staging",
+		"dev": "dev", "development": "dev", "test": "dev", "sandbox": "dev", "qa": "dev",
+	}
+)
+
+// ResourceRisk reads the risk of a retrieved resource: public when its bucket policy (S3) or IAM
+// bindings (GCS) grant access to everyone, sensitive and in an environment according to its tags.
+func ResourceRisk(config cloud.ResourceConfig) Risk {
+	risk := Risk{Exposure: ExposureInternal}
+	if isPublic(config) {
+		risk.Exposure = ExposurePublic
+	}
+
+	for key, value := range config.Tags {
+		key, value = strings.ToLower(key), strings.ToLower(strings.TrimSpace(value))
+		if slices.Contains(sensitivityTagKeys, key) && slices.Contains(sensitiveTagValues, value) {
+			risk.Sensitive = true
+		}
+		if environment, ok := environmentAliases[value]; ok && slices.Contains(environmentTagKeys, key) {
+			risk.Environment = environment
+		}
+	}
+	return risk
+}
+
+// isPublic reports whether the resource's policy grants access to everyone. A policy that cannot
+// be read is not taken as public: the policies report it, the score only ranks what they report.
+func isPublic(config cloud.ResourceConfig) bool {
+	policy, ok := config.Config["bucket_policy"]
+	if !ok || policy == "" || policy == nil {
+		return false
+	}
+
+	switch config.ResourceType {
+	case "s3":
+		document, err := iampolicy.FromValue(policy)
+		return err == nil && document.IsPublic()
+	case "gcs":
+		raw, err := json.Marshal(policy)
+		if err != nil {
+			return false
+		}
+		var bindings []struct {
+			Members []string `json:"members"`
+		}
+		if err := json.Unmarshal(raw, &bindings); err != nil {
+			return false
+		}
+		for _, binding := range bindings {
+			if slices.Contains(binding.Members, "allUsers") || slices.Contains(binding.Members, "allAuthenticatedUsers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RiskScore ranks a finding from 0 to 100. The severity sets a base, critical 25 down to info 1,
+// which is multiplied by 2 for a public resource, 1.5 for sensitive data, 1.5 in prod and 0.5 in
+// dev, and by up to 1.5 with age, 0.1 for every 30 days the finding has been open. A critical
+// finding on a public prod bucket scores 75 when first seen; the same finding on an internal dev
+// bucket scores 13.
+func RiskScore(severity Severity, risk Risk, age time.Duration) int {
+	score := [...]float64{1, 3, 8, 15, 25}[severity.Rank()]
+	if risk.Exposure == ExposurePublic {
+		score *= 2
+	}
+	if risk.Sensitive {
+		score *= 1.5
+	}
+	switch risk.Environment {
+	case "prod":
+		score *= 1.5
+	case "dev":
+		score *= 0.5
+	}
+	if age > 0 {
+		score *= math.Min(1.5, 1+0.1*math.Floor(age.Hours()/(30*24)))
+	}
+	return int(math.Min(100, math.Round(score)))
+}
+
+// FirstSeen returns when a finding of a resource was first reported, for findings tracked across
+// scans. ok is false for a finding reported for the first time.
+type FirstSeen func(resourceType string, resourceID string, finding Finding) (firstSeen time.Time, ok bool)
+
+// ScoreRisk sets the risk of every result from its resource in the job inventory, and the risk
+// score of its findings as of scannedAt, aged from when firstSeen says they were first reported.
+// firstSeen may be nil, in which case every finding is scored as new. Account results have no
+// resource and are scored as internal.
+func ScoreRisk(results []ScanResult, inventory []cloud.ResourceConfig, firstSeen FirstSeen, scannedAt time.Time) {
+	risks := make(map[string]Risk, len(inventory))
+	for _, config := range inventory {
+		risks[config.ResourceType+"/"+config.ResourceID] = ResourceRisk(config)
+	}
+
+	age := func(result *ScanResult, finding Finding) time.Duration {
+		if firstSeen == nil {
+			return 0
+		}
+		seen, ok := firstSeen(result.ResourceType, result.ResourceID, finding)
+		if !ok || seen.IsZero() {
+			return 0
+		}
+		return scannedAt.Sub(seen)
+	}
+
+	for i := range results {
+		result := &results[i]
+		risk, ok := risks[result.ResourceType+"/"+result.ResourceID]
+		if !ok {
+			risk = Risk{Exposure: ExposureInternal}
+		}
+		result.Risk = risk
+		result.RiskScore = 0
+		for _, findings := range [][]Finding{result.Findings, result.Suppressed} {
+			for j := range findings {
+				findings[j].RiskScore = RiskScore(findings[j].Severity, risk, age(result, findings[j]))
+			}
+		}
+		for _, finding := range result.Findings {
+			result.RiskScore = max(result.RiskScore, finding.RiskScore)
+		}
+	}
+}
+
+// SortByRisk orders results by risk score, highest first, then by severity.
+func SortByRisk(results []ScanResult) {
+	slices.SortStableFunc(results, func(a ScanResult, b ScanResult) int {
+		if a.RiskScore != b.RiskScore {
+			return b.RiskScore - a.RiskScore
+		}
+		return b.Severity.Rank() - a.Severity.Rank()
+	})
+}
@@ -0,0 +1,88 @@
+package opa2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiskScore(t *testing.T) {
+	publicProd := opa2.Risk{Exposure: opa2.ExposurePublic, Environment: "prod"}
+	internalDev := opa2.Risk{Exposure: opa2.ExposureInternal, Environment: "dev"}
+	day := 24 * time.Hour
+
+	assert.Equal(t, 75, opa2.RiskScore(opa2.SeverityCritical, publicProd, 0))
+	assert.Equal(t, 13, opa2.RiskScore(opa2.SeverityCritical, internalDev, 0))
+	assert.Equal(t, 8, opa2.RiskScore(opa2.SeverityMedium, opa2.Risk{}, 29*day))
+	assert.Equal(t, 10, opa2.RiskScore(opa2.SeverityMedium, opa2.Risk{}, 90*day))
+	assert.Equal(t, 12, opa2.RiskScore(opa2.SeverityMedium, opa2.Risk{}, 720*day), "age counts for at most 1.5")
+	assert.Equal(t, 100, opa2.RiskScore(opa2.SeverityCritical, opa2.Risk{Exposure: opa2.ExposurePublic, Sensitive: true, Environment: "prod"}, 365*day))
+	assert.Greater(t, opa2.RiskScore(opa2.SeverityMedium, publicProd, 0), opa2.RiskScore(opa2.SeverityHigh, internalDev, 0))
+}
+
+func TestScoreRisk(t *testing.T) {
+	publicPolicy := map[string]interface{}{"Version": "2012-10-17", "Statement": []interface{}{
+		map[string]interface{}{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::www/*"},
+	}}
+	inventory := []cloud.ResourceConfig{
+		{ResourceType: "s3", ResourceID: "www", Config: map[string]interface{}{"bucket_policy": publicPolicy}},
+		{ResourceType: "s3", ResourceID: "payroll", Tags: map[string]string{"Data-Classification": "Confidential", "env": "production"}, Config: map[string]interface{}{"bucket_policy": ""}},
+		{ResourceType: "gcs", ResourceID: "media", Config: map[string]interface{}{"bucket_policy": []interface{}{
+			map[string]interface{}{"role": "roles/storage.objectViewer", "members": []interface{}{"allUsers"}},
+		}}},
+	}
+	high := opa2.Finding{RuleID: "R-1", Severity: opa2.SeverityHigh}
+	low := opa2.Finding{RuleID: "R-2", Severity: opa2.SeverityLow}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "payroll", Severity: opa2.SeverityHigh, Findings: []opa2.Finding{high}},
+		{ResourceType: "s3", ResourceID: "www", Severity: opa2.SeverityLow, Findings: []opa2.Finding{low}, Suppressed: []opa2.Finding{high}},
+		{ResourceType: "gcs", ResourceID: "media", Severity: opa2.SeverityLow, Findings: []opa2.Finding{low}},
+		{ResourceType: opa2.AccountResourceType, ResourceID: "123456789012", Severity: opa2.SeverityHigh, Findings: []opa2.Finding{high}},
+	}
+
+	opa2.ScoreRisk(results, inventory, nil, time.Now())
+
+	assert.Equal(t, opa2.Risk{Exposure: opa2.ExposureInternal, Sensitive: true, Environment: "prod"}, results[0].Risk)
+	assert.Equal(t, 34, results[0].RiskScore)
+	assert.Equal(t, opa2.ExposurePublic, results[1].Risk.Exposure)
+	assert.Equal(t, 6, results[1].RiskScore, "suppressed findings are scored but do not count")
+	assert.Equal(t, 30, results[1].Suppressed[0].RiskScore)
+	assert.Equal(t, opa2.ExposurePublic, results[2].Risk.Exposure)
+	assert.Equal(t, opa2.Risk{Exposure: opa2.ExposureInternal}, results[3].Risk)
+
+	opa2.SortByRisk(results)
+	var order []string
+	for _, result := range results {
+		order = append(order, result.ResourceID)
+	}
+	assert.Equal(t, []string{"payroll", "123456789012", "www", "media"}, order)
+}
+
+func TestScoreRiskAgesTrackedFindings(t *testing.T) {
+	scannedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	inventory := []cloud.ResourceConfig{
+		{ResourceType: "s3", ResourceID: "new", Tags: map[string]string{"env": "prod"}},
+		{ResourceType: "s3", ResourceID: "old", Tags: map[string]string{"env": "prod"}},
+	}
+	high := opa2.Finding{RuleID: "R-1", Severity: opa2.SeverityHigh}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "new", Severity: opa2.SeverityHigh, Findings: []opa2.Finding{high}},
+		{ResourceType: "s3", ResourceID: "old", Severity: opa2.SeverityHigh, Findings: []opa2.Finding{high}},
+	}
+	firstSeen := func(resourceType string, resourceID string, finding opa2.Finding) (time.Time, bool) {
+		if resourceID == "old" && finding.RuleID == "R-1" {
+			return scannedAt.Add(-90 * 24 * time.Hour), true
+		}
+		return time.Time{}, false
+	}
+
+	opa2.ScoreRisk(results, inventory, firstSeen, scannedAt)
+	opa2.SortByRisk(results)
+
+	assert.Equal(t, "old", results[0].ResourceID, "a finding open for 90 days outranks the same finding seen for the first time")
+	assert.Equal(t, 29, results[0].RiskScore)
+	assert.Equal(t, 23, results[1].RiskScore)
+}
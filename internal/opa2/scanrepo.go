@@ -8,29 +8,36 @@ import (
 	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
 
 	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type ScanRepository interface {
 	InsertMany(scanResults []interface{}) ([]interface{}, error)
+	UpsertMany(scanResults []ScanResult) (int64, error)
+	FindByJobID(discoveryJobID bson.ObjectID) ([]ScanResult, error)
 }
 
 type scanRepository struct {
-	collection *mongo.Collection
+	db database.Service
 }
 
 func NewScanRepository(db database.Service) ScanRepository {
 	return &scanRepository{
-		collection: db.GetCollection("scan_result"),
+		db: db,
 	}
 }
 
+func (r *scanRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("scan_result")
+}
+
 func (r *scanRepository) InsertMany(scanResults []interface{}) ([]interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Insert the documents into the MongoDB collection
-	insertResult, err := r.collection.InsertMany(ctx, scanResults)
+	insertResult, err := r.collection().InsertMany(ctx, scanResults)
 	if err != nil {
 		log.Error().Err(err).Str("function", "InsertMany").Msg("Failed to insert scan results")
 		return nil, fmt.Errorf("failed to insert scan results: %w", err)
@@ -43,3 +50,53 @@ func (r *scanRepository) InsertMany(scanResults []interface{}) ([]interface{}, e
 	// Return inserted IDs
 	return insertResult.InsertedIDs, nil
 }
+
+// UpsertMany writes scan results keyed on (discovery job, resource type, resource id),
+// so a redelivered scan message replaces the earlier results for the job instead of duplicating them.
+func (r *scanRepository) UpsertMany(scanResults []ScanResult) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(scanResults))
+	for _, scanResult := range scanResults {
+		filter := bson.M{
+			"discovery_job_id": scanResult.DiscoveryJobID,
+			"resource_type":    scanResult.ResourceType,
+			"resource_id":      scanResult.ResourceID,
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(scanResult).SetUpsert(true))
+	}
+
+	result, err := r.collection().BulkWrite(ctx, models)
+	if err != nil {
+		log.Error().Err(err).Str("function", "UpsertMany").Msg("Failed to upsert scan results")
+		return 0, fmt.Errorf("failed to upsert scan results: %w", err)
+	}
+
+	log.Info().Str("function", "UpsertMany").
+		Int64("upsertedCount", result.UpsertedCount).
+		Int64("modifiedCount", result.ModifiedCount).
+		Msg("Scan results upserted successfully")
+
+	return result.UpsertedCount + result.MatchedCount, nil
+}
+
+func (r *scanRepository) FindByJobID(discoveryJobID bson.ObjectID) ([]ScanResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection().Find(ctx, bson.M{"discovery_job_id": discoveryJobID})
+	if err != nil {
+		log.Error().Err(err).Str("function", "FindByJobID").Str("jobID", discoveryJobID.Hex()).Msg("Failed to find scan results")
+		return nil, fmt.Errorf("failed to find scan results for job %s: %w", discoveryJobID.Hex(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []ScanResult
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Error().Err(err).Str("function", "FindByJobID").Str("jobID", discoveryJobID.Hex()).Msg("Failed to decode scan results")
+		return nil, fmt.Errorf("failed to decode scan results for job %s: %w", discoveryJobID.Hex(), err)
+	}
+
+	return results, nil
+}
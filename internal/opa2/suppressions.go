@@ -0,0 +1,230 @@
+package opa2
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Suppression is a client's acceptance of the risk of some findings until it expires, e.g. of a
+// bucket that is public because it hosts a website. It matches the findings that every scope it
+// sets matches: a rule ID, a resource type, a resource ID pattern where * matches any run of
+// characters, an account, and resource tags that must all be present with the same values.
+// Suppressed findings are kept apart from the failing ones, see ScanResult.Suppressed.
+type Suppression struct {
+	ID              bson.ObjectID     `bson:"_id,omitempty"`
+	ClientID        string            `bson:"client_id"`
+	RuleID          string            `bson:"rule_id,omitempty"`
+	ResourceType    string            `bson:"resource_type,omitempty"`
+	ResourcePattern string            `bson:"resource_pattern,omitempty"` // e.g. "www-*"
+	AccountID       string            `bson:"account_id,omitempty"`
+	Tags            map[string]string `bson:"tags,omitempty"`
+	Justification   string            `bson:"justification"`
+	Owner           string            `bson:"owner"` // who accepted the risk
+	ExpiresAt       time.Time         `bson:"expires_at"`
+	CreatedAt       time.Time         `bson:"created_at"`
+}
+
+// SuppressionRef is the suppression a finding was suppressed by.
+type SuppressionRef struct {
+	ID        bson.ObjectID `bson:"id" json:"id"`
+	Owner     string        `bson:"owner" json:"owner"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+// Active reports whether the suppression has not expired at now.
+func (s Suppression) Active(now time.Time) bool {
+	return now.Before(s.ExpiresAt)
+}
+
+// Matches reports whether the suppression covers a finding of a rule on a resource with tags.
+func (s Suppression) Matches(ruleID string, resourceType string, resourceID string, accountID string, tags map[string]string) bool {
+	if s.RuleID != "" && s.RuleID != ruleID {
+		return false
+	}
+	if s.ResourceType != "" && s.ResourceType != resourceType {
+		return false
+	}
+	if s.AccountID != "" && s.AccountID != accountID {
+		return false
+	}
+	if s.ResourcePattern != "" && !matchResourcePattern(s.ResourcePattern, resourceID) {
+		return false
+	}
+	for key, value := range s.Tags {
+		if tagValue, ok := tags[key]; !ok || tagValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func matchResourcePattern(pattern string, resourceID string) bool {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(resourceID)
+}
+
+// ApplySuppressions moves the findings an active suppression covers from Findings to Suppressed,
+// in every result. The tags of a result's resource are looked up in the job inventory. A result
+// left without findings passes, or stays errored if some of its policies could not be evaluated,
+// so that it is neither notified nor counted as failing.
+func ApplySuppressions(results []ScanResult, suppressions []Suppression, inventory []cloud.ResourceConfig, now time.Time) {
+	var active []Suppression
+	for _, suppression := range suppressions {
+		if suppression.Active(now) {
+			active = append(active, suppression)
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	tags := make(map[string]map[string]string, len(inventory))
+	for _, config := range inventory {
+		tags[config.ResourceType+"/"+config.ResourceID] = config.Tags
+	}
+
+	for i := range results {
+		result := &results[i]
+		resourceTags := tags[result.ResourceType+"/"+result.ResourceID]
+
+		var failing []Finding
+		for _, finding := range result.Findings {
+			suppression := matchingSuppression(active, finding.RuleID, result, resourceTags)
+			if suppression == nil {
+				failing = append(failing, finding)
+				continue
+			}
+			finding.Suppression = &SuppressionRef{ID: suppression.ID, Owner: suppression.Owner, ExpiresAt: suppression.ExpiresAt}
+			result.Suppressed = append(result.Suppressed, finding)
+		}
+		if len(result.Suppressed) == 0 {
+			continue
+		}
+
+		result.Findings = failing
+		result.Severity = MaxSeverity(failing)
+		result.Misconfiguration = findingTitles(failing)
+		if len(failing) == 0 && result.Outcome == OutcomeFail {
+			result.Outcome = OutcomePass
+			if result.Error != "" {
+				result.Outcome = OutcomeError
+			}
+			result.Pass = result.Outcome == OutcomePass
+		}
+	}
+}
+
+func matchingSuppression(suppressions []Suppression, ruleID string, result *ScanResult, tags map[string]string) *Suppression {
+	for i := range suppressions {
+		if suppressions[i].Matches(ruleID, result.ResourceType, result.ResourceID, result.AccountID, tags) {
+			return &suppressions[i]
+		}
+	}
+	return nil
+}
+
+type SuppressionRepository interface {
+	FindByClientID(clientID string) ([]Suppression, error)
+	Create(suppression *Suppression) (bson.ObjectID, error)
+	Delete(clientID string, id bson.ObjectID) error
+}
+
+type suppressionRepository struct {
+	db database.Service
+}
+
+func NewSuppressionRepository(db database.Service) SuppressionRepository {
+	return &suppressionRepository{
+		db: db,
+	}
+}
+
+func (r *suppressionRepository) collection() *mongo.Collection {
+	return r.db.GetCollection("suppression")
+}
+
+// FindByClientID returns every suppression of a client, expired ones included, soonest to expire
+// first.
+func (r *suppressionRepository) FindByClientID(clientID string) ([]Suppression, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "expires_at", Value: 1}})
+	cursor, err := r.collection().Find(ctx, bson.M{"client_id": clientID}, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", "FindByClientID").Str("clientID", clientID).Msg("Failed to execute find")
+		return nil, fmt.Errorf("failed to find suppressions of client %s: %w", clientID, err)
+	}
+	defer cursor.Close(ctx)
+
+	var suppressions []Suppression
+	if err := cursor.All(ctx, &suppressions); err != nil {
+		log.Error().Err(err).Str("function", "FindByClientID").Str("clientID", clientID).Msg("Failed to decode suppressions")
+		return nil, fmt.Errorf("failed to decode suppressions of client %s: %w", clientID, err)
+	}
+
+	return suppressions, nil
+}
+
+// Create stores a suppression. It needs a client, at least one scope, a justification, an owner
+// and an expiry in the future: risk is never accepted for good.
+func (r *suppressionRepository) Create(suppression *Suppression) (bson.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	switch {
+	case suppression.ClientID == "":
+		return bson.NilObjectID, fmt.Errorf("suppression needs a client")
+	case suppression.RuleID == "" && suppression.ResourceType == "" && suppression.ResourcePattern == "" && suppression.AccountID == "" && len(suppression.Tags) == 0:
+		return bson.NilObjectID, fmt.Errorf("suppression needs a rule, resource, account or tag scope")
+	case suppression.Justification == "" || suppression.Owner == "":
+		return bson.NilObjectID, fmt.Errorf("suppression needs a justification and an owner")
+	case !suppression.Active(time.Now()):
+		return bson.NilObjectID, fmt.Errorf("suppression needs an expiry in the future")
+	}
+
+	suppression.CreatedAt = time.Now()
+
+	result, err := r.collection().InsertOne(ctx, suppression)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Create").Str("clientID", suppression.ClientID).Msg("Failed to insert suppression")
+		return bson.NilObjectID, fmt.Errorf("failed to insert suppression for client %s: %w", suppression.ClientID, err)
+	}
+	suppression.ID = result.InsertedID.(bson.ObjectID)
+
+	log.Info().Str("function", "Create").Str("clientID", suppression.ClientID).Str("ruleID", suppression.RuleID).Str("owner", suppression.Owner).Time("expiresAt", suppression.ExpiresAt).Msg("Suppression created")
+	return suppression.ID, nil
+}
+
+// Delete removes one of the client's suppressions, reopening the findings it covered at the next
+// scan.
+func (r *suppressionRepository) Delete(clientID string, id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.collection().DeleteOne(ctx, bson.M{"_id": id, "client_id": clientID})
+	if err != nil {
+		log.Error().Err(err).Str("function", "Delete").Str("clientID", clientID).Str("id", id.Hex()).Msg("Failed to delete suppression")
+		return fmt.Errorf("failed to delete suppression %s: %w", id.Hex(), err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no suppression %s found for client %s", id.Hex(), clientID)
+	}
+
+	log.Info().Str("function", "Delete").Str("clientID", clientID).Str("id", id.Hex()).Msg("Suppression deleted")
+	return nil
+}
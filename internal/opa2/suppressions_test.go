@@ -0,0 +1,50 @@
+package opa2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestApplySuppressions(t *testing.T) {
+	now := time.Now()
+	website := opa2.Suppression{ID: bson.NewObjectID(), RuleID: "AWS-S3-001", ResourcePattern: "www-*", Owner: "ann", ExpiresAt: now.Add(time.Hour)}
+	sandbox := opa2.Suppression{ID: bson.NewObjectID(), Tags: map[string]string{"env": "sandbox"}, Owner: "bob", ExpiresAt: now.Add(time.Hour)}
+	expired := opa2.Suppression{ID: bson.NewObjectID(), AccountID: "123456789012", Owner: "eve", ExpiresAt: now.Add(-time.Hour)}
+
+	public := opa2.Finding{RuleID: "AWS-S3-001", Title: "Public", Severity: opa2.SeverityHigh}
+	tls := opa2.Finding{RuleID: "AWS-S3-103", Title: "No TLS", Severity: opa2.SeverityMedium}
+	results := []opa2.ScanResult{
+		{ResourceType: "s3", ResourceID: "www-acme", AccountID: "123456789012", Outcome: opa2.OutcomeFail, Findings: []opa2.Finding{public}},
+		{ResourceType: "s3", ResourceID: "www-docs", AccountID: "123456789012", Outcome: opa2.OutcomeFail, Findings: []opa2.Finding{public, tls}},
+		{ResourceType: "s3", ResourceID: "scratch", AccountID: "123456789012", Outcome: opa2.OutcomeFail, Error: "timeout", Findings: []opa2.Finding{tls}},
+		{ResourceType: "s3", ResourceID: "reports", AccountID: "123456789012", Outcome: opa2.OutcomeFail, Findings: []opa2.Finding{public}},
+	}
+	inventory := []cloud.ResourceConfig{{ResourceType: "s3", ResourceID: "scratch", Tags: map[string]string{"env": "sandbox"}}}
+
+	opa2.ApplySuppressions(results, []opa2.Suppression{expired, website, sandbox}, inventory, now)
+
+	assert.Equal(t, opa2.OutcomePass, results[0].Outcome)
+	assert.True(t, results[0].Pass)
+	assert.Empty(t, results[0].Findings)
+	if assert.Len(t, results[0].Suppressed, 1) {
+		assert.Equal(t, &opa2.SuppressionRef{ID: website.ID, Owner: "ann", ExpiresAt: website.ExpiresAt}, results[0].Suppressed[0].Suppression)
+	}
+
+	// only the public finding is accepted, the bucket still fails
+	assert.Equal(t, opa2.OutcomeFail, results[1].Outcome)
+	assert.Equal(t, []opa2.Finding{tls}, results[1].Findings)
+	assert.Equal(t, opa2.SeverityMedium, results[1].Severity)
+	assert.Equal(t, []string{"No TLS"}, results[1].Misconfiguration)
+
+	assert.Equal(t, opa2.OutcomeError, results[2].Outcome)
+	assert.Len(t, results[2].Suppressed, 1)
+
+	// the account-wide suppression expired
+	assert.Equal(t, opa2.OutcomeFail, results[3].Outcome)
+	assert.Empty(t, results[3].Suppressed)
+}
@@ -0,0 +1,131 @@
+package opa2
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SyncReport lists the policies a sync touched, as "<resource type>/<name>".
+type SyncReport struct {
+	Added     []string
+	Changed   []string
+	Removed   []string
+	Unchanged []string
+	Skipped   map[string]error // policy file path -> why it was not loaded
+}
+
+// SyncPolicies makes the active embedded policies in the rego collection match files. A file whose
+// hash differs from the active version becomes a new version that is activated straight away, and
+// embedded policies without a file are retired. Policies from other sources are never touched.
+// With dryRun set the report is computed without writing anything.
+func SyncPolicies(regoRepo RegoRepository, files []PolicyFile, dryRun bool) (*SyncReport, error) {
+	report := &SyncReport{Skipped: make(map[string]error)}
+
+	active, err := regoRepo.FindActive()
+	if err != nil {
+		return nil, err
+	}
+
+	activeByKey := make(map[string]RegoPolicy)
+	for _, policy := range active {
+		if policy.Source == EmbeddedSource {
+			activeByKey[policyKeyOf(policy)] = policy
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.Err != nil {
+			report.Skipped[file.Path] = file.Err
+			continue
+		}
+
+		policy := file.Policy
+		key := policyKeyOf(policy)
+		seen[key] = true
+
+		current, ok := activeByKey[key]
+		switch {
+		case ok && current.Hash == policy.Hash:
+			report.Unchanged = append(report.Unchanged, key)
+			continue
+		case ok:
+			report.Changed = append(report.Changed, key)
+		default:
+			report.Added = append(report.Added, key)
+		}
+
+		if dryRun {
+			continue
+		}
+		versions, err := regoRepo.FindVersions(policy.ResourceType, policy.Name)
+		if err != nil {
+			return report, fmt.Errorf("failed to sync %s: %w", key, err)
+		}
+		if _, err := storeAndActivate(regoRepo, policy, versions, "policy sync "+policy.Hash[:12]); err != nil {
+			return report, fmt.Errorf("failed to sync %s: %w", key, err)
+		}
+	}
+
+	// a file that failed to load keeps its stored policy rather than retiring it
+	skippedNames := make(map[string]bool)
+	for filePath := range report.Skipped {
+		skippedNames[policyNameOf(filePath)] = true
+	}
+
+	for key, policy := range activeByKey {
+		if seen[key] || skippedNames[policy.Name] {
+			continue
+		}
+		report.Removed = append(report.Removed, key)
+
+		if dryRun {
+			continue
+		}
+		if err := regoRepo.Retire(policy.ResourceType, policy.Name, "policy file removed"); err != nil {
+			return report, fmt.Errorf("failed to retire %s: %w", key, err)
+		}
+	}
+
+	log.Info().Str("function", "SyncPolicies").Bool("dryRun", dryRun).
+		Int("added", len(report.Added)).
+		Int("changed", len(report.Changed)).
+		Int("removed", len(report.Removed)).
+		Int("unchanged", len(report.Unchanged)).
+		Int("skipped", len(report.Skipped)).
+		Msg("Policy sync completed")
+
+	return report, nil
+}
+
+// storeAndActivate stores policy as version 1 of a new policy, or as the next version of an existing
+// one, activates it and returns the stored version.
+func storeAndActivate(regoRepo RegoRepository, policy RegoPolicy, versions []RegoPolicy, reason string) (*RegoPolicy, error) {
+	if len(versions) == 0 {
+		if _, err := regoRepo.Create(&policy); err != nil {
+			return nil, err
+		}
+		if err := regoRepo.Activate(policy.ResourceType, policy.Name, policy.Version, reason); err != nil {
+			return nil, err
+		}
+		return &policy, nil
+	}
+
+	draft, err := regoRepo.CreateDraft(&policy)
+	if err != nil {
+		return nil, err
+	}
+	if err := regoRepo.Activate(draft.ResourceType, draft.Name, draft.Version, reason); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+func policyKeyOf(policy RegoPolicy) string {
+	return policy.ResourceType + "/" + policy.Name
+}
+
+func policyNameOf(filePath string) string {
+	return filePath[:len(filePath)-len(".rego")]
+}
@@ -0,0 +1,147 @@
+package opa2_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type MockRegoRepository struct {
+	mock.Mock
+}
+
+func (m *MockRegoRepository) Create(rego *opa2.RegoPolicy) (bson.ObjectID, error) {
+	args := m.Called(rego)
+	rego.Version = 1
+	return args.Get(0).(bson.ObjectID), args.Error(1)
+}
+
+func (m *MockRegoRepository) CreateDraft(rego *opa2.RegoPolicy) (*opa2.RegoPolicy, error) {
+	args := m.Called(rego)
+	return args.Get(0).(*opa2.RegoPolicy), args.Error(1)
+}
+
+func (m *MockRegoRepository) FindByResourceType(resourceType string, clientID string) ([]opa2.RegoPolicy, error) {
+	args := m.Called(resourceType, clientID)
+	return args.Get(0).([]opa2.RegoPolicy), args.Error(1)
+}
+
+func (m *MockRegoRepository) FindByName(resourceType string, name string) (*opa2.RegoPolicy, error) {
+	args := m.Called(resourceType, name)
+	return args.Get(0).(*opa2.RegoPolicy), args.Error(1)
+}
+
+func (m *MockRegoRepository) FindVersions(resourceType string, name string) ([]opa2.RegoPolicy, error) {
+	args := m.Called(resourceType, name)
+	return args.Get(0).([]opa2.RegoPolicy), args.Error(1)
+}
+
+func (m *MockRegoRepository) FindActive() ([]opa2.RegoPolicy, error) {
+	args := m.Called()
+	return args.Get(0).([]opa2.RegoPolicy), args.Error(1)
+}
+
+func (m *MockRegoRepository) SetEnabled(resourceType string, name string, enabled bool) error {
+	args := m.Called(resourceType, name, enabled)
+	return args.Error(0)
+}
+
+func (m *MockRegoRepository) Activate(resourceType string, name string, version int, reason string) error {
+	args := m.Called(resourceType, name, version, reason)
+	return args.Error(0)
+}
+
+func (m *MockRegoRepository) Rollback(resourceType string, name string, reason string) (int, error) {
+	args := m.Called(resourceType, name, reason)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRegoRepository) Retire(resourceType string, name string, reason string) error {
+	args := m.Called(resourceType, name, reason)
+	return args.Error(0)
+}
+
+func (m *MockRegoRepository) History(resourceType string, name string) ([]opa2.PolicyActivation, error) {
+	args := m.Called(resourceType, name)
+	return args.Get(0).([]opa2.PolicyActivation), args.Error(1)
+}
+
+func (m *MockRegoRepository) Watch(ctx context.Context, changed func(id bson.ObjectID)) error {
+	args := m.Called(ctx, changed)
+	return args.Error(0)
+}
+
+func TestSyncPolicies(t *testing.T) {
+	tree := fstest.MapFS{
+		"aws/s3.rego":         {Data: []byte("package s3\n\ndeny contains \"public\" if input.config.public\n")},
+		"aws/s3_test.rego":    {Data: []byte("package s3_test\n")},
+		"aws/versioning.rego": {Data: []byte("package s3.versioning\n\ndeny contains \"unversioned\" if not input.config.versioned\n")},
+		"gcp/gcs.rego":        {Data: []byte("package gcs\n\ndeny contains \"public\" if input.config.public\n")},
+		"broken.rego":         {Data: []byte("package broken\n\ndeny {")},
+	}
+
+	files, err := opa2.LoadPolicyFiles(tree)
+	assert.NoError(t, err)
+	assert.Len(t, files, 4)
+
+	var unchanged, changed opa2.RegoPolicy
+	for _, file := range files {
+		switch file.Path {
+		case "aws/s3.rego":
+			unchanged = file.Policy
+		case "aws/versioning.rego":
+			changed = file.Policy
+		}
+	}
+	assert.Equal(t, "data.s3.versioning.deny", changed.Query)
+
+	active := []opa2.RegoPolicy{
+		{ResourceType: "s3", Name: "aws/s3", Version: 2, Hash: unchanged.Hash, Source: opa2.EmbeddedSource},
+		{ResourceType: "s3", Name: "aws/versioning", Version: 1, Hash: "outdated", Source: opa2.EmbeddedSource},
+		{ResourceType: "s3", Name: "aws/legacy", Version: 4, Hash: "gone", Source: opa2.EmbeddedSource},
+		{ResourceType: "broken", Name: "broken", Version: 1, Hash: "kept", Source: opa2.EmbeddedSource},
+		{ResourceType: "s3", Name: "client/custom", Version: 1, Hash: "custom"},
+	}
+
+	repo := new(MockRegoRepository)
+	repo.On("FindActive").Return(active, nil)
+	repo.On("FindVersions", "s3", "aws/versioning").Return(active[1:2], nil)
+	repo.On("CreateDraft", mock.MatchedBy(func(p *opa2.RegoPolicy) bool { return p.Name == "aws/versioning" })).
+		Return(&opa2.RegoPolicy{ResourceType: "s3", Name: "aws/versioning", Version: 2}, nil)
+	repo.On("Activate", "s3", "aws/versioning", 2, mock.Anything).Return(nil)
+	repo.On("FindVersions", "gcs", "gcp/gcs").Return([]opa2.RegoPolicy{}, nil)
+	repo.On("Create", mock.MatchedBy(func(p *opa2.RegoPolicy) bool { return p.Name == "gcp/gcs" })).Return(bson.NewObjectID(), nil)
+	repo.On("Activate", "gcs", "gcp/gcs", 1, mock.Anything).Return(nil)
+	repo.On("Retire", "s3", "aws/legacy", mock.Anything).Return(nil)
+
+	report, err := opa2.SyncPolicies(repo, files, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gcs/gcp/gcs"}, report.Added)
+	assert.Equal(t, []string{"s3/aws/versioning"}, report.Changed)
+	assert.Equal(t, []string{"s3/aws/legacy"}, report.Removed)
+	assert.Equal(t, []string{"s3/aws/s3"}, report.Unchanged)
+	assert.Contains(t, report.Skipped, "broken.rego")
+	repo.AssertExpectations(t)
+}
+
+func TestEmbeddedPoliciesAreValid(t *testing.T) {
+	files, err := opa2.EmbeddedPolicies()
+
+	assert.NoError(t, err)
+	found := false
+	for _, file := range files {
+		assert.NoError(t, file.Err, file.Path)
+		if file.Path == "aws/s3.rego" {
+			found = true
+			assert.Equal(t, "s3", file.Policy.ResourceType)
+			assert.Equal(t, "data.s3.deny", file.Policy.Query)
+		}
+	}
+	assert.True(t, found, "aws/s3.rego is not embedded")
+}
@@ -0,0 +1,100 @@
+package opa2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// PolicyProblem is one parse, compile or query error of a policy module. Row and Col are 1-based
+// and 0 when the problem has no position, e.g. an unresolved query.
+type PolicyProblem struct {
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError is returned for a module that cannot be stored. It lists every problem the OPA v1
+// parser and compiler found, not just the first.
+type PolicyError struct {
+	Name     string
+	Problems []PolicyProblem
+}
+
+func (e *PolicyError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		if p.Row > 0 {
+			lines = append(lines, fmt.Sprintf("%s:%d:%d: %s: %s", e.Name, p.Row, p.Col, p.Code, p.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s: %s", e.Name, p.Code, p.Message))
+		}
+	}
+	return "invalid policy: " + strings.Join(lines, "; ")
+}
+
+// ValidatePolicy parses and compiles the module with OPA v1 in strict mode, which also rejects
+// unused variables and imports and deprecated built-ins, only knows the built-ins of capabilities,
+// which leaves out http.send and the other non-deterministic ones, type checks its references to input
+// against the input schema, see Input, and checks that the query is a reference to a rule the
+// module defines.
+func ValidatePolicy(regoPolicy *RegoPolicy) error {
+	name := regoPolicy.Name + ".rego"
+	if regoPolicy.Name == "" {
+		name = regoPolicy.ResourceType + ".rego"
+	}
+
+	module, err := ast.ParseModuleWithOpts(name, regoPolicy.Rego, ast.ParserOptions{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return policyError(name, err)
+	}
+
+	schemas, err := inputSchemaSet()
+	if err != nil {
+		return err
+	}
+
+	compiler := ast.NewCompiler().WithStrict(true).WithDefaultRegoVersion(ast.RegoV1).WithSchemas(schemas).WithCapabilities(capabilities())
+	compiler.Compile(map[string]*ast.Module{name: module})
+	if compiler.Failed() {
+		return policyError(name, compiler.Errors)
+	}
+
+	query, err := ast.ParseRef(regoPolicy.Query)
+	if err != nil || !query.HasPrefix(ast.DefaultRootRef) {
+		return &PolicyError{Name: name, Problems: []PolicyProblem{{
+			Code:    "rego_query_error",
+			Message: fmt.Sprintf("query %q must be a reference into data, e.g. data.s3.deny", regoPolicy.Query),
+		}}}
+	}
+
+	if len(compiler.GetRulesExact(query)) == 0 {
+		return &PolicyError{Name: name, Problems: []PolicyProblem{{
+			Code:    "rego_query_error",
+			Message: fmt.Sprintf("query %s does not resolve to a rule in package %s", query, module.Package.Path),
+		}}}
+	}
+
+	return nil
+}
+
+func policyError(name string, err error) error {
+	var astErrors ast.Errors
+	if !errors.As(err, &astErrors) {
+		return &PolicyError{Name: name, Problems: []PolicyProblem{{Code: "rego_error", Message: err.Error()}}}
+	}
+
+	policyErr := &PolicyError{Name: name}
+	for _, e := range astErrors {
+		problem := PolicyProblem{Code: e.Code, Message: e.Message}
+		if e.Location != nil {
+			problem.Row = e.Location.Row
+			problem.Col = e.Location.Col
+		}
+		policyErr.Problems = append(policyErr.Problems, problem)
+	}
+	return policyErr
+}
@@ -0,0 +1,97 @@
+package opa2_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		module   string
+		problems []opa2.PolicyProblem
+	}{
+		{
+			name:   "valid",
+			query:  "data.s3.deny",
+			module: "package s3\n\ndeny contains \"public\" if input.config.public\n",
+		},
+		{
+			name:   "pre-v1 syntax",
+			query:  "data.s3.deny",
+			module: "package s3\n\ndeny[msg] {\n    msg := \"x\"\n}\n",
+			problems: []opa2.PolicyProblem{
+				{Row: 3, Col: 1, Code: "rego_parse_error", Message: "`if` keyword is required before rule body"},
+				{Row: 3, Col: 1, Code: "rego_parse_error", Message: "`contains` keyword is required for partial set rules"},
+			},
+		},
+		{
+			name:   "unused variable",
+			query:  "data.s3.deny",
+			module: "package s3\n\ndeny contains \"public\" if {\n    x := input.config.acl\n    input.config.public\n}\n",
+			problems: []opa2.PolicyProblem{
+				{Row: 4, Col: 5, Code: "rego_compile_error", Message: "assigned var x unused"},
+			},
+		},
+		{
+			name:   "input outside the schema",
+			query:  "data.s3.deny",
+			module: "package s3\n\ndeny contains \"public\" if input.public\n",
+			problems: []opa2.PolicyProblem{
+				{Row: 3, Col: 27, Code: "rego_type_error", Message: "undefined ref: input.public"},
+			},
+		},
+		{
+			name:   "http.send",
+			query:  "data.s3.deny",
+			module: "package s3\n\ndeny contains \"exfiltrated\" if {\n    http.send({\"method\": \"GET\", \"url\": \"http://169.254.169.254/latest/meta-data/\"})\n}\n",
+			problems: []opa2.PolicyProblem{
+				{Row: 4, Col: 5, Code: "rego_type_error", Message: "undefined function http.send"},
+			},
+		},
+		{
+			name:   "query does not resolve",
+			query:  "data.s3.violations",
+			module: "package s3\n\ndeny contains \"public\" if input.config.public\n",
+			problems: []opa2.PolicyProblem{
+				{Code: "rego_query_error", Message: "query data.s3.violations does not resolve to a rule in package data.s3"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opa2.ValidatePolicy(&opa2.RegoPolicy{ResourceType: "s3", Name: "aws/s3", Query: tt.query, Rego: tt.module})
+
+			if tt.problems == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var policyErr *opa2.PolicyError
+			if assert.True(t, errors.As(err, &policyErr), "expected a *PolicyError, got %v", err) {
+				assert.Equal(t, tt.problems, policyErr.Problems)
+			}
+		})
+	}
+}
+
+func TestEvaluateConfigRejectsNonDeterministicBuiltins(t *testing.T) {
+	for _, call := range []string{
+		`http.send({"method": "GET", "url": "http://169.254.169.254/latest/meta-data/"})`,
+		`net.lookup_ip_addr("example.com")`,
+		`opa.runtime()`,
+		`time.now_ns()`,
+	} {
+		policy := &opa2.RegoPolicy{ResourceType: "s3", Query: "data.s3.deny", Rego: "package s3\n\ndeny contains x if x := " + call + "\n"}
+
+		outcome, _, err := opa2.EvaluateConfig(policy, nil, opa2.Input{Config: map[string]interface{}{}})
+
+		assert.ErrorContains(t, err, "undefined function", call)
+		assert.Equal(t, opa2.OutcomeError, outcome, call)
+	}
+}
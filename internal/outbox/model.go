@@ -0,0 +1,36 @@
+package outbox
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	PendingStatus = "pending"
+	SentStatus    = "sent"
+)
+
+// Message is a next-stage queue message written in the same transaction that completes a stage.
+type Message struct {
+	ID            bson.ObjectID `bson:"_id,omitempty"`
+	JobID         bson.ObjectID `bson:"job_id"`          // discovery job the message hands off
+	QueueURL      string        `bson:"queue_url"`       // queue the relay publishes the body to
+	Body          string        `bson:"body"`            // message body, already serialised
+	Status        string        `bson:"status"`          // "pending" until the relay has published it
+	Attempts      int           `bson:"attempts"`        // failed publish attempts so far
+	LastError     string        `bson:"last_error"`      // error from the most recent failed attempt
+	NextAttemptAt int64         `bson:"next_attempt_at"` // Timestamp before which RelayStale leaves a failed message alone
+	CreatedAt     int64         `bson:"created_at"`      // Timestamp for message creation
+	SentAt        int64         `bson:"sent_at"`         // Timestamp for successful publish
+}
+
+func NewMessage(queueURL string, jobID bson.ObjectID, body string) *Message {
+	return &Message{
+		JobID:     jobID,
+		QueueURL:  queueURL,
+		Body:      body,
+		Status:    PendingStatus,
+		CreatedAt: time.Now().Unix(),
+	}
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Repository interface {
+	Enqueue(ctx context.Context, msg *Message) (bson.ObjectID, error)
+	FindPending(queueURL string, jobID bson.ObjectID, limit int64) ([]Message, error)
+	FindStale(createdBefore time.Time, now time.Time, limit int64) ([]Message, error)
+	MarkSent(id bson.ObjectID) error
+	MarkFailed(id bson.ObjectID, cause error, nextAttemptAt time.Time) error
+}
+
+type repository struct {
+	db database.Service
+}
+
+func NewRepository(db database.Service) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) collection() *mongo.Collection {
+	return r.db.GetCollection("outbox")
+}
+
+// Enqueue stores msg as pending. ctx should be the transaction context of the stage being completed.
+func (r *repository) Enqueue(ctx context.Context, msg *Message) (bson.ObjectID, error) {
+	msg.ID = bson.NewObjectID()
+
+	_, err := r.collection().InsertOne(ctx, msg)
+	if err != nil {
+		log.Error().Err(err).Str("function", "Enqueue").Str("messageID", msg.ID.Hex()).Msg("Failed to enqueue outbox message")
+		return bson.NilObjectID, fmt.Errorf("failed to enqueue outbox message %s: %w", msg.ID.Hex(), err)
+	}
+
+	log.Info().Str("function", "Enqueue").Str("messageID", msg.ID.Hex()).Str("queueURL", msg.QueueURL).Msg("Outbox message enqueued")
+	return msg.ID, nil
+}
+
+// FindPending returns the pending messages of a job for a queue.
+func (r *repository) FindPending(queueURL string, jobID bson.ObjectID, limit int64) ([]Message, error) {
+	return r.find("FindPending", bson.M{"status": PendingStatus, "queue_url": queueURL, "job_id": jobID}, limit)
+}
+
+// FindStale returns the messages of every queue still pending since before createdBefore, except
+// those whose last failed attempt asked to wait past now.
+func (r *repository) FindStale(createdBefore time.Time, now time.Time, limit int64) ([]Message, error) {
+	filter := bson.M{
+		"status":          PendingStatus,
+		"created_at":      bson.M{"$lt": createdBefore.Unix()},
+		"next_attempt_at": bson.M{"$not": bson.M{"$gt": now.Unix()}}, // messages stored before retries have none
+	}
+	return r.find("FindStale", filter, limit)
+}
+
+func (r *repository) find(function string, filter bson.M, limit int64) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1}).SetLimit(limit)
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Error().Err(err).Str("function", function).Msg("Failed to find pending outbox messages")
+		return nil, fmt.Errorf("failed to find pending outbox messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var messages []Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		log.Error().Err(err).Str("function", function).Msg("Failed to decode pending outbox messages")
+		return nil, fmt.Errorf("failed to decode pending outbox messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *repository) MarkSent(id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": SentStatus, "sent_at": time.Now().Unix()}}
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		log.Error().Err(err).Str("function", "MarkSent").Str("messageID", id.Hex()).Msg("Failed to mark outbox message sent")
+		return fmt.Errorf("failed to mark outbox message %s sent: %w", id.Hex(), err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("outbox message %s not found", id.Hex())
+	}
+
+	return nil
+}
+
+func (r *repository) MarkFailed(id bson.ObjectID, cause error, nextAttemptAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"last_error": cause.Error(), "next_attempt_at": nextAttemptAt.Unix()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		log.Error().Err(err).Str("function", "MarkFailed").Str("messageID", id.Hex()).Msg("Failed to record outbox publish failure")
+		return fmt.Errorf("failed to record publish failure for outbox message %s: %w", id.Hex(), err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("outbox message %s not found", id.Hex())
+	}
+
+	return nil
+}
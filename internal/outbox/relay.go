@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const relayBatchSize = 50
+
+// RetryPolicy is how the relays treat messages they could not publish. A message is left to the
+// inline relay of the stage that wrote it for StaleAfter; after that RelayStale retries it, waiting
+// Backoff after the first failure and twice as long after each further one, up to MaxBackoff. A
+// message is never given up on, as its stage is complete and would not hand the job off again;
+// from AlertAfter failed attempts on every failure is logged as an error to alert on.
+type RetryPolicy struct {
+	StaleAfter time.Duration
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	AlertAfter int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	StaleAfter: 2 * time.Minute,
+	Backoff:    time.Minute,
+	MaxBackoff: time.Hour,
+	AlertAfter: 10,
+}
+
+// nextAttempt is when a message that has failed attempts times may be tried again.
+func (p RetryPolicy) nextAttempt(attempts int, now time.Time) time.Time {
+	backoff := p.Backoff
+	for i := 1; i < attempts && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return now.Add(min(backoff, p.MaxBackoff))
+}
+
+// Relay publishes the pending outbox messages of a job for queueURL and marks them sent. It runs
+// inline, right after a stage completes the job, and leaves the messages of other jobs alone. A
+// message stays pending until a publish succeeds, so one that fails here is retried by RelayStale.
+// Delivery is at least once: a crash between publishing and MarkSent publishes the message again,
+// which the consuming stage absorbs through the processed-message ledger.
+func Relay(ctx context.Context, repo Repository, publisher queue.Publisher, queueURL string, jobID bson.ObjectID) (int, error) {
+	messages, err := repo.FindPending(queueURL, jobID, relayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := publishAll(ctx, repo, publisher, messages, DefaultRetryPolicy, time.Now())
+	log.Info().Str("function", "Relay").Str("queueURL", queueURL).Str("jobID", jobID.Hex()).Int("pending", len(messages)).Int("sent", sent).Msg("Outbox relay completed")
+	return sent, nil
+}
+
+// RelayStale publishes the messages of every queue that have been pending for longer than
+// policy.StaleAfter, e.g. because the publish after their stage failed, and that are due for
+// another attempt. It runs on a schedule, so that every completed stage is handed off even when no
+// later stage triggers an inline relay.
+func RelayStale(ctx context.Context, repo Repository, publisher queue.Publisher, policy RetryPolicy, now time.Time) (int, error) {
+	messages, err := repo.FindStale(now.Add(-policy.StaleAfter), now, relayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := publishAll(ctx, repo, publisher, messages, policy, now)
+	log.Info().Str("function", "RelayStale").Int("stale", len(messages)).Int("sent", sent).Msg("Stale outbox relay completed")
+	return sent, nil
+}
+
+func publishAll(ctx context.Context, repo Repository, publisher queue.Publisher, messages []Message, policy RetryPolicy, now time.Time) int {
+	sent := 0
+	for _, msg := range messages {
+		if err := publisher.Publish(ctx, msg.QueueURL, msg.Body); err != nil {
+			attempts := msg.Attempts + 1
+			event := log.Warn()
+			if attempts >= policy.AlertAfter {
+				event = log.Error()
+			}
+			event.Err(err).Str("function", "publishAll").Str("messageID", msg.ID.Hex()).Str("jobID", msg.JobID.Hex()).Int("attempts", attempts).Msg("Failed to publish outbox message, will retry")
+
+			if err := repo.MarkFailed(msg.ID, err, policy.nextAttempt(attempts, now)); err != nil {
+				log.Error().Err(err).Str("function", "publishAll").Str("messageID", msg.ID.Hex()).Msg("Failed to record publish failure")
+			}
+			continue
+		}
+
+		if err := repo.MarkSent(msg.ID); err != nil {
+			log.Error().Err(err).Str("function", "publishAll").Str("messageID", msg.ID.Hex()).Msg("Failed to mark outbox message sent")
+			continue
+		}
+		sent++
+	}
+	return sent
+}
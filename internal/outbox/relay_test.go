@@ -0,0 +1,155 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) Enqueue(ctx context.Context, msg *outbox.Message) (bson.ObjectID, error) {
+	args := m.Called(ctx, msg)
+	return args.Get(0).(bson.ObjectID), args.Error(1)
+}
+
+func (m *MockRepository) FindPending(queueURL string, jobID bson.ObjectID, limit int64) ([]outbox.Message, error) {
+	args := m.Called(queueURL, jobID, limit)
+	return args.Get(0).([]outbox.Message), args.Error(1)
+}
+
+func (m *MockRepository) FindStale(createdBefore time.Time, now time.Time, limit int64) ([]outbox.Message, error) {
+	args := m.Called(createdBefore, now, limit)
+	return args.Get(0).([]outbox.Message), args.Error(1)
+}
+
+func (m *MockRepository) MarkSent(id bson.ObjectID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) MarkFailed(id bson.ObjectID, cause error, nextAttemptAt time.Time) error {
+	args := m.Called(id, cause, nextAttemptAt)
+	return args.Error(0)
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, queue string, body string) error {
+	return errors.New("queue unavailable")
+}
+
+func TestRelay(t *testing.T) {
+	mockRepo := new(MockRepository)
+	q := queue.NewMemory()
+
+	jobID := bson.NewObjectID()
+	first := outbox.Message{ID: bson.NewObjectID(), JobID: jobID, QueueURL: "retrieval", Body: "job-1"}
+	second := outbox.Message{ID: bson.NewObjectID(), JobID: jobID, QueueURL: "retrieval", Body: "job-1 again"}
+
+	// only the messages of the job that just completed are relayed
+	mockRepo.On("FindPending", "retrieval", jobID, mock.Anything).Return([]outbox.Message{first, second}, nil)
+	mockRepo.On("MarkSent", first.ID).Return(nil)
+	mockRepo.On("MarkSent", second.ID).Return(nil)
+
+	sent, err := outbox.Relay(context.Background(), mockRepo, q, "retrieval", jobID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 2, q.Len("retrieval"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRelayKeepsFailedMessagesPending(t *testing.T) {
+	mockRepo := new(MockRepository)
+
+	msg := outbox.Message{ID: bson.NewObjectID(), JobID: bson.NewObjectID(), QueueURL: "retrieval", Body: "job-1"}
+
+	mockRepo.On("FindPending", "retrieval", msg.JobID, mock.Anything).Return([]outbox.Message{msg}, nil)
+	mockRepo.On("MarkFailed", msg.ID, mock.Anything, mock.Anything).Return(nil)
+
+	sent, err := outbox.Relay(context.Background(), mockRepo, failingPublisher{}, "retrieval", msg.JobID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "MarkSent", msg.ID)
+}
+
+// flakyPublisher fails the first failures publishes, then publishes to the memory queue.
+type flakyPublisher struct {
+	failures int
+	queue    *queue.Memory
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, queueURL string, body string) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("queue unavailable")
+	}
+	return p.queue.Publish(ctx, queueURL, body)
+}
+
+func TestRelayStaleRetriesFailedPublish(t *testing.T) {
+	mockRepo := new(MockRepository)
+	q := queue.NewMemory()
+	publisher := &flakyPublisher{failures: 1, queue: q}
+	policy := outbox.RetryPolicy{StaleAfter: time.Minute, Backoff: time.Minute, MaxBackoff: time.Hour, AlertAfter: 3}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// the publish after the stage failed, and no later stage ran to relay it again
+	msg := outbox.Message{ID: bson.NewObjectID(), QueueURL: "scan", Body: "job-1", Status: outbox.PendingStatus}
+	mockRepo.On("FindStale", now.Add(-time.Minute), now, mock.Anything).Return([]outbox.Message{msg}, nil).Once()
+	mockRepo.On("MarkFailed", msg.ID, mock.Anything, now.Add(time.Minute)).Return(nil).Once()
+
+	sent, err := outbox.RelayStale(context.Background(), mockRepo, publisher, policy, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 0, q.Len("scan"))
+
+	// the next scheduled run, once the backoff has passed, publishes it
+	later := now.Add(5 * time.Minute)
+	msg.Attempts = 1
+	mockRepo.On("FindStale", later.Add(-time.Minute), later, mock.Anything).Return([]outbox.Message{msg}, nil).Once()
+	mockRepo.On("MarkSent", msg.ID).Return(nil).Once()
+
+	sent, err = outbox.RelayStale(context.Background(), mockRepo, publisher, policy, later)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 1, q.Len("scan"))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRelayStaleBacksOffWithoutGivingUp(t *testing.T) {
+	mockRepo := new(MockRepository)
+	policy := outbox.RetryPolicy{StaleAfter: time.Minute, Backoff: time.Minute, MaxBackoff: 3 * time.Minute, AlertAfter: 4}
+	now := time.Now()
+
+	second := outbox.Message{ID: bson.NewObjectID(), QueueURL: "scan", Attempts: 1}
+	third := outbox.Message{ID: bson.NewObjectID(), QueueURL: "scan", Attempts: 2}
+	many := outbox.Message{ID: bson.NewObjectID(), QueueURL: "scan", Attempts: 50}
+	mockRepo.On("FindStale", mock.Anything, now, mock.Anything).Return([]outbox.Message{second, third, many}, nil)
+	mockRepo.On("MarkFailed", second.ID, mock.Anything, now.Add(2*time.Minute)).Return(nil)
+	mockRepo.On("MarkFailed", third.ID, mock.Anything, now.Add(3*time.Minute)).Return(nil)
+	// a completed stage's message is retried at MaxBackoff for as long as publishing fails
+	mockRepo.On("MarkFailed", many.ID, mock.Anything, now.Add(3*time.Minute)).Return(nil)
+
+	sent, err := outbox.RelayStale(context.Background(), mockRepo, failingPublisher{}, policy, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud"
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Discovery is the first stage. It lists a client's resources and hands the job to retrieval.
+type Discovery struct {
+	AWSDiscoveryRepo awscloud.DiscoveryRepository
+	AWSResources     []awscloud.ResourceDiscovery
+	AWSConfig        func(accountID string) (aws.Config, error)
+
+	GCPDiscoveryRepo gcpcloud.DiscoveryRepository
+	GCPResources     []gcpcloud.ResourceDiscovery
+
+	Outbox         outbox.Repository
+	Publisher      queue.Publisher
+	RetrievalQueue string
+}
+
+func (d *Discovery) RunAWS(ctx context.Context, clientID string, accountID string, clientEmail string) (bson.ObjectID, error) {
+	log.Info().Str("account id", accountID).Msg("setting up discovery for aws client")
+
+	cfg, err := d.AWSConfig(accountID)
+	if err != nil {
+		log.Error().Err(err).Str("account id", accountID).Msg("unable to load SDK config")
+		return bson.NilObjectID, err
+	}
+
+	jobID, err := awscloud.RunDiscovery(cfg, d.AWSDiscoveryRepo, clientID, accountID, d.AWSResources, d.handoff(clientID, accountID, clientEmail, AWSProvider))
+	if err != nil {
+		log.Error().Err(err).Str("account id", accountID).Msg("Error running discovery")
+		return bson.NilObjectID, err
+	}
+
+	d.relay(ctx, jobID)
+
+	log.Info().Str("account id", accountID).Str("jobID", jobID.Hex()).Msg("discovery process completed for aws client")
+	return jobID, nil
+}
+
+func (d *Discovery) RunGCP(ctx context.Context, clientID string, projectID string, clientEmail string) (bson.ObjectID, error) {
+	log.Info().Str("project id", projectID).Msg("setting up discovery for gcp client")
+
+	jobID, err := gcpcloud.RunDiscovery(d.GCPDiscoveryRepo, clientID, projectID, d.GCPResources, d.handoff(clientID, projectID, clientEmail, GCPProvider))
+	if err != nil {
+		log.Error().Err(err).Str("project id", projectID).Msg("Error running discovery")
+		return bson.NilObjectID, err
+	}
+
+	d.relay(ctx, jobID)
+
+	log.Info().Str("project id", projectID).Str("jobID", jobID.Hex()).Msg("discovery process completed for gcp client")
+	return jobID, nil
+}
+
+// handoff enqueues the retrieval message for a job in the transaction that completes discovery.
+func (d *Discovery) handoff(clientID string, accountID string, clientEmail string, provider string) cloud.Handoff {
+	return func(ctx context.Context, jobID bson.ObjectID) error {
+		msg := Message{
+			JobID:       jobID.Hex(),
+			ClientID:    clientID,
+			AccountID:   accountID,
+			ClientEmail: clientEmail,
+			Provider:    provider,
+		}
+
+		messageBody, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message into JSON: %w", err)
+		}
+
+		_, err = d.Outbox.Enqueue(ctx, outbox.NewMessage(d.RetrievalQueue, jobID, string(messageBody)))
+		return err
+	}
+}
+
+// relay publishes the job's hand-off message. If it cannot, the message stays pending for
+// outbox.RelayStale.
+func (d *Discovery) relay(ctx context.Context, jobID bson.ObjectID) {
+	if _, err := outbox.Relay(ctx, d.Outbox, d.Publisher, d.RetrievalQueue, jobID); err != nil {
+		log.Error().Err(err).Msg("failed to relay outbox messages")
+	}
+}
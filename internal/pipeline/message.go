@@ -0,0 +1,31 @@
+package pipeline
+
+import (
+	"fmt"
+
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	AWSProvider = "AWS"
+	GCPProvider = "GCP"
+)
+
+// Message is the body handed from one stage to the next: discovery to retrieval, retrieval to scan.
+type Message struct {
+	JobID       string `json:"job_id"`
+	ClientID    string `json:"client_id"`
+	AccountID   string `json:"account_id"`
+	ClientEmail string `json:"client_email"`
+	Provider    string `json:"provider"`
+}
+
+// CrossAccountRoleConfig returns a loader that reaches the Woz cross-account role clients deploy in
+// their AWS account, through the Woz processing role.
+func CrossAccountRoleConfig(processingRoleARN string) func(accountID string) (aws.Config, error) {
+	return func(accountID string) (aws.Config, error) {
+		return awscloud.ClientRoleConfig(processingRoleARN, fmt.Sprintf("arn:aws:iam::%s:role/WozCrossAccountRole", accountID))
+	}
+}
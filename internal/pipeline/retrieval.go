@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/database"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/outbox"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Retrieval is the second stage. It fetches the configuration of every discovered resource and
+// hands the job to scan.
+type Retrieval struct {
+	DB     database.Service
+	Ledger ledger.Repository
+
+	AWSDiscoveryRepo awscloud.DiscoveryRepository
+	AWSConfigRepo    awscloud.ConfigRepository
+	AWSResources     []awscloud.ResourceDiscovery
+	AWSConfig        func(accountID string) (aws.Config, error)
+
+	GCPDiscoveryRepo gcpcloud.DiscoveryRepository
+	GCPConfigRepo    gcpcloud.ConfigRepository
+	GCPResources     []gcpcloud.ResourceDiscovery
+
+	Outbox    outbox.Repository
+	Publisher queue.Publisher
+	ScanQueue string
+}
+
+func (r *Retrieval) Handle(ctx context.Context, msg queue.Message) error {
+	var job Message
+	if err := json.Unmarshal([]byte(msg.Body), &job); err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Msg("Failed to unmarshal message body")
+		return nil
+	}
+
+	id, err := bson.ObjectIDFromHex(job.JobID)
+	if err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Invalid job id in message")
+		return nil
+	}
+
+	claimed, err := r.Ledger.Claim(id, ledger.RetrievalStage, msg.ID)
+	if errors.Is(err, ledger.ErrInProgress) {
+		log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Retrieval in progress for job, retrying duplicate message later")
+		return err
+	}
+	if err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Failed to claim job in processed-message ledger")
+		return fmt.Errorf("error claiming job in processed-message ledger: %w", err)
+	}
+	if !claimed {
+		log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Retrieval already completed for job, skipping duplicate message")
+		return nil
+	}
+
+	// a failed attempt gives the job back, so that the redelivered message can claim it
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := r.Ledger.Release(id, ledger.RetrievalStage, msg.ID); err != nil {
+			log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Failed to release job in processed-message ledger")
+		}
+	}()
+
+	switch job.Provider {
+	case AWSProvider:
+		log.Info().Str("account_id", job.AccountID).Str("messageID", msg.ID).Msg("retrieving config for aws message")
+		cfg, err := r.AWSConfig(job.AccountID)
+		if err != nil {
+			return fmt.Errorf("unable to load SDK config: %w", err)
+		}
+		if err := awscloud.RunRetrieval(cfg, r.AWSDiscoveryRepo, r.AWSConfigRepo, id, job.ClientID, job.AccountID, r.AWSResources); err != nil {
+			log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("AWS Handler Error")
+			return fmt.Errorf("error running AWS retrieval: %w", err)
+		}
+	case GCPProvider:
+		log.Info().Str("account_id", job.AccountID).Str("messageID", msg.ID).Msg("retrieving config for gcp message")
+		if err := gcpcloud.RunRetrival(r.GCPDiscoveryRepo, r.GCPConfigRepo, id, job.ClientID, job.AccountID, r.GCPResources); err != nil {
+			log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("GCP Handler Error")
+			return fmt.Errorf("error running GCP retrieval: %w", err)
+		}
+	default:
+		log.Warn().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Provider not supported")
+		return fmt.Errorf("provider not supported: %s", job.Provider)
+	}
+
+	// complete the stage and record the scan hand-off together
+	err = r.DB.WithTransaction(func(ctx context.Context) error {
+		if err := r.Ledger.MarkCompleted(ctx, id, ledger.RetrievalStage, msg.ID); err != nil {
+			return err
+		}
+		_, err := r.Outbox.Enqueue(ctx, outbox.NewMessage(r.ScanQueue, id, msg.Body))
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Failed to complete retrieval stage")
+		return fmt.Errorf("error completing retrieval stage: %w", err)
+	}
+	completed = true
+
+	if _, err := outbox.Relay(ctx, r.Outbox, r.Publisher, r.ScanQueue, id); err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Failed to relay outbox messages")
+	}
+
+	log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Retrieval process completed for message")
+	return nil
+}
@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	awscloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/aws"
+	gcpcloud "github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/cloud/gcp"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/compliance"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/notify"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Scan is the last stage. It evaluates the retrieved configurations against the rego policies,
+// notifies the client of any misconfiguration, tracks the account's findings across scans and
+// scores the account against the compliance frameworks.
+type Scan struct {
+	Ledger          ledger.Repository
+	RegoRepo        opa2.RegoRepository
+	ScanRepo        opa2.ScanRepository
+	ParamsRepo      opa2.ParamsRepository      // nil evaluates every client with empty params
+	OverrideRepo    opa2.OverrideRepository    // nil evaluates every built-in policy for every client
+	SuppressionRepo opa2.SuppressionRepository // nil suppresses no finding
+	Notifier        notify.Sender              // nil disables the result email
+	Findings        findings.Repository        // nil disables finding tracking
+	Compliance      compliance.Repository      // nil disables compliance scoring
+	Frameworks      []compliance.Framework
+
+	AWSConfigRepo awscloud.ConfigRepository
+	AWSResources  []awscloud.ResourceDiscovery
+
+	GCPConfigRepo gcpcloud.ConfigRepository
+	GCPResources  []gcpcloud.ResourceDiscovery
+}
+
+func (s *Scan) Handle(ctx context.Context, msg queue.Message) error {
+	var job Message
+	if err := json.Unmarshal([]byte(msg.Body), &job); err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Msg("Failed to unmarshal message body")
+		return nil
+	}
+
+	id, err := bson.ObjectIDFromHex(job.JobID)
+	if err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Invalid job id in message")
+		return nil
+	}
+
+	claimed, err := s.Ledger.Claim(id, ledger.ScanStage, msg.ID)
+	if errors.Is(err, ledger.ErrInProgress) {
+		log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Scan in progress for job, retrying duplicate message later")
+		return err
+	}
+	if err != nil {
+		log.Error().Err(err).Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Failed to claim job in processed-message ledger")
+		return fmt.Errorf("error claiming job in processed-message ledger: %w", err)
+	}
+	if claimed {
+		if err := s.scan(ctx, id, job, msg.ID); err != nil {
+			return err
+		}
+	} else {
+		log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Scan already completed for job, skipping duplicate message")
+	}
+
+	// findings are tracked as a stage of their own: a failed write leaves it unclaimed, so the
+	// redelivered message reconciles them without scanning and notifying the client again
+	if s.Findings != nil {
+		if err := s.trackFindings(ctx, id, job, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Str("messageID", msg.ID).Str("jobID", job.JobID).Msg("Scan process completed for message")
+	return nil
+}
+
+// scan evaluates the job's resources, notifies the client and scores the account, holding the
+// job's scan stage, which is released if the scan fails and marked completed otherwise.
+func (s *Scan) scan(ctx context.Context, id bson.ObjectID, job Message, messageID string) error {
+	// a failed attempt gives the job back, so that the redelivered message can claim it
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := s.Ledger.Release(id, ledger.ScanStage, messageID); err != nil {
+			log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to release job in processed-message ledger")
+		}
+	}()
+
+	// the account's tracked findings age the risk scores of the results
+	var firstSeen opa2.FirstSeen
+	if s.Findings != nil {
+		tracked, err := s.Findings.FindByAccount(job.ClientID, job.AccountID)
+		if err != nil {
+			log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to load tracked findings")
+			return fmt.Errorf("error loading tracked findings: %w", err)
+		}
+		firstSeen = findings.FirstSeen(tracked)
+	}
+
+	var err error
+	switch job.Provider {
+	case AWSProvider:
+		err = opa2.RunScan(s.AWSConfigRepo, s.ScanRepo, s.RegoRepo, s.ParamsRepo, s.OverrideRepo, s.SuppressionRepo, firstSeen, s.Notifier, id, job.ClientID, job.AccountID, job.ClientEmail, AWSProvider, s.AWSResources)
+	case GCPProvider:
+		err = opa2.RunGCPScan(s.GCPConfigRepo, s.ScanRepo, s.RegoRepo, s.ParamsRepo, s.OverrideRepo, s.SuppressionRepo, firstSeen, s.Notifier, id, job.ClientID, job.AccountID, job.ClientEmail, GCPProvider, s.GCPResources)
+	default:
+		log.Warn().Str("messageID", messageID).Str("jobID", job.JobID).Msg("Provider not supported")
+		return fmt.Errorf("provider not supported: %s", job.Provider)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Scan failed")
+		return fmt.Errorf("scan failed: %w", err)
+	}
+	// the client has been notified by now, so a redelivery must not scan the job again
+	completed = true
+
+	if s.Compliance != nil {
+		s.scoreCompliance(id, job)
+	}
+
+	if err := s.Ledger.MarkCompleted(ctx, id, ledger.ScanStage, messageID); err != nil {
+		log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to record scan in processed-message ledger")
+	}
+	return nil
+}
+
+// trackFindings reconciles the account's tracked findings with the job's scan results, see
+// findings.Reconcile, holding the job's findings stage. On failure the stage is released and the
+// error returned, so that the message is redelivered and the findings reconciled then.
+func (s *Scan) trackFindings(ctx context.Context, id bson.ObjectID, job Message, messageID string) error {
+	claimed, err := s.Ledger.Claim(id, ledger.FindingsStage, messageID)
+	if errors.Is(err, ledger.ErrInProgress) {
+		log.Info().Str("messageID", messageID).Str("jobID", job.JobID).Msg("Finding tracking in progress for job, retrying duplicate message later")
+		return err
+	}
+	if err != nil {
+		log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to claim finding tracking in processed-message ledger")
+		return fmt.Errorf("error claiming finding tracking in processed-message ledger: %w", err)
+	}
+	if !claimed {
+		return nil
+	}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := s.Ledger.Release(id, ledger.FindingsStage, messageID); err != nil {
+			log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to release finding tracking in processed-message ledger")
+		}
+	}()
+
+	existing, err := s.Findings.FindByAccount(job.ClientID, job.AccountID)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to load tracked findings")
+		return fmt.Errorf("error loading tracked findings: %w", err)
+	}
+
+	results, err := s.ScanRepo.FindByJobID(id)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to load scan results for finding tracking")
+		return fmt.Errorf("error loading scan results for finding tracking: %w", err)
+	}
+
+	changed := findings.Reconcile(existing, results, id, job.ClientID, job.AccountID, job.Provider, time.Now())
+	if err := s.Findings.UpsertMany(changed); err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to store tracked findings")
+		return fmt.Errorf("error storing tracked findings: %w", err)
+	}
+	completed = true
+
+	if err := s.Ledger.MarkCompleted(ctx, id, ledger.FindingsStage, messageID); err != nil {
+		log.Error().Err(err).Str("messageID", messageID).Str("jobID", job.JobID).Msg("Failed to record finding tracking in processed-message ledger")
+	}
+
+	counts := make(map[findings.Status]int)
+	for _, finding := range changed {
+		counts[finding.Status]++
+	}
+	log.Info().Str("jobID", job.JobID).Int("open", counts[findings.StatusOpen]).Int("reopened", counts[findings.StatusReopened]).Int("resolved", counts[findings.StatusResolved]).Msg("Findings tracked")
+	return nil
+}
+
+// scoreCompliance records the compliance score of the job's scan results. Failures are logged
+// only: the client is notified by then, and redoing the scan for a missing score would notify
+// them again.
+func (s *Scan) scoreCompliance(id bson.ObjectID, job Message) {
+	results, err := s.ScanRepo.FindByJobID(id)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to load scan results for compliance scoring")
+		return
+	}
+
+	policies, err := s.RegoRepo.FindActive()
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to load rule benchmarks for compliance scoring")
+		return
+	}
+
+	frameworks := compliance.WithRuleBenchmarks(s.Frameworks, policies)
+	scores := compliance.ScoreScan(frameworks, id, job.ClientID, job.AccountID, job.Provider, results)
+	if err := s.Compliance.UpsertMany(scores); err != nil {
+		log.Error().Err(err).Str("jobID", job.JobID).Msg("Failed to store compliance scores")
+		return
+	}
+
+	for _, score := range scores {
+		log.Info().Str("jobID", job.JobID).Str("framework", score.FrameworkID).Int("passed", score.Passed).Int("failed", score.Failed).Int("notEvaluated", score.NotEvaluated).Float64("percent", score.Percent).Msg("Compliance scored")
+	}
+}
@@ -0,0 +1,132 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/findings"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/ledger"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/opa2"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/pipeline"
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fakeLedger answers every claim with claimed and err, except for the stages in done, which are
+// already completed, and records the stages released and completed.
+type fakeLedger struct {
+	claimed   bool
+	err       error
+	done      []string
+	released  []string
+	completed []string
+}
+
+func (l *fakeLedger) Claim(jobID bson.ObjectID, stage string, messageID string) (bool, error) {
+	if slices.Contains(l.done, stage) {
+		return false, nil
+	}
+	return l.claimed, l.err
+}
+
+func (l *fakeLedger) Release(jobID bson.ObjectID, stage string, messageID string) error {
+	l.released = append(l.released, stage)
+	return nil
+}
+
+func (l *fakeLedger) MarkCompleted(ctx context.Context, jobID bson.ObjectID, stage string, messageID string) error {
+	l.completed = append(l.completed, stage)
+	l.done = append(l.done, stage)
+	return nil
+}
+
+// fakeFindings fails as many writes as failures, then records the findings written.
+type fakeFindings struct {
+	failures int
+	written  []findings.Finding
+}
+
+func (f *fakeFindings) FindByAccount(clientID string, accountID string) ([]findings.Finding, error) {
+	return nil, nil
+}
+
+func (f *fakeFindings) FindByClient(clientID string, status findings.Status) ([]findings.Finding, error) {
+	return nil, nil
+}
+
+func (f *fakeFindings) UpsertMany(tracked []findings.Finding) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("write conflict")
+	}
+	f.written = append(f.written, tracked...)
+	return nil
+}
+
+// fakeScanResults returns results for every job.
+type fakeScanResults struct {
+	opa2.ScanRepository
+	results []opa2.ScanResult
+}
+
+func (r *fakeScanResults) FindByJobID(discoveryJobID bson.ObjectID) ([]opa2.ScanResult, error) {
+	return r.results, nil
+}
+
+func jobMessage(t *testing.T, provider string) queue.Message {
+	body, err := json.Marshal(pipeline.Message{JobID: bson.NewObjectID().Hex(), ClientID: "acme", Provider: provider})
+	require.NoError(t, err)
+	return queue.Message{ID: "msg-1", Body: string(body)}
+}
+
+func TestScanDuplicateDelivery(t *testing.T) {
+	// another delivery completed the job: the duplicate is dropped
+	completed := &fakeLedger{}
+	assert.NoError(t, (&pipeline.Scan{Ledger: completed}).Handle(context.Background(), jobMessage(t, "unknown")))
+	assert.Empty(t, completed.released)
+
+	// another delivery is processing it: the duplicate is retried later, in case that one fails
+	inProgress := &fakeLedger{err: ledger.ErrInProgress}
+	err := (&pipeline.Scan{Ledger: inProgress}).Handle(context.Background(), jobMessage(t, pipeline.AWSProvider))
+	assert.ErrorIs(t, err, ledger.ErrInProgress)
+	assert.Empty(t, inProgress.released)
+
+	// a failed scan gives the claim back for the redelivery
+	failing := &fakeLedger{claimed: true}
+	assert.Error(t, (&pipeline.Scan{Ledger: failing}).Handle(context.Background(), jobMessage(t, "unknown")))
+	assert.Equal(t, []string{ledger.ScanStage}, failing.released)
+}
+
+func TestScanRedeliveryTracksFindingsWithoutRescanning(t *testing.T) {
+	// the scan completed and notified the client, but the findings could not be written
+	tracker := &fakeLedger{claimed: true, done: []string{ledger.ScanStage}}
+	tracked := &fakeFindings{failures: 1}
+	scan := &pipeline.Scan{
+		Ledger:   tracker,
+		Findings: tracked,
+		ScanRepo: &fakeScanResults{results: []opa2.ScanResult{
+			{ResourceType: "s3", ResourceID: "www", Findings: []opa2.Finding{{RuleID: "AWS-S3-001"}}},
+		}},
+	}
+	msg := jobMessage(t, pipeline.AWSProvider)
+
+	assert.Error(t, scan.Handle(context.Background(), msg))
+	assert.Equal(t, []string{ledger.FindingsStage}, tracker.released)
+	assert.Empty(t, tracker.completed)
+
+	// the redelivery skips the completed scan and writes the findings
+	require.NoError(t, scan.Handle(context.Background(), msg))
+	assert.Equal(t, []string{ledger.FindingsStage}, tracker.completed)
+	require.Len(t, tracked.written, 1)
+	assert.Equal(t, "AWS-S3-001", tracked.written[0].RuleID)
+
+	// later duplicates do nothing
+	require.NoError(t, scan.Handle(context.Background(), msg))
+	assert.Len(t, tracked.written, 1)
+}
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxDeliveries bounds redelivery of a failing message so a poison message cannot spin forever.
+const maxDeliveries = 3
+
+type delivery struct {
+	msg      Message
+	attempts int
+}
+
+// memoryQueue is one named queue: its waiting deliveries in order, and a signal for Consume that
+// some were added.
+type memoryQueue struct {
+	deliveries []delivery
+	ready      chan struct{}
+}
+
+// Memory is an unbounded in-process queue, for tests and local runs of the pipeline. Publishing
+// and redelivering never block, so a failed message is back on its queue before the handler's
+// delivery returns.
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	nextID int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		queues: make(map[string]*memoryQueue),
+	}
+}
+
+// queue returns the named queue, creating it. q.mu must be held.
+func (q *Memory) queue(name string) *memoryQueue {
+	mq, ok := q.queues[name]
+	if !ok {
+		mq = &memoryQueue{ready: make(chan struct{}, 1)}
+		q.queues[name] = mq
+	}
+	return mq
+}
+
+func (q *Memory) push(name string, d delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	mq := q.queue(name)
+	mq.deliveries = append(mq.deliveries, d)
+	select {
+	case mq.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Memory) pop(name string) (delivery, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	mq := q.queue(name)
+	if len(mq.deliveries) == 0 {
+		return delivery{}, false
+	}
+	d := mq.deliveries[0]
+	mq.deliveries = mq.deliveries[1:]
+	return d, true
+}
+
+func (q *Memory) Publish(ctx context.Context, name string, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.nextID++
+	id := strconv.Itoa(q.nextID)
+	q.mu.Unlock()
+
+	q.push(name, delivery{msg: Message{ID: id, Body: body}})
+	return nil
+}
+
+func (q *Memory) Consume(ctx context.Context, name string, handler Handler) error {
+	q.mu.Lock()
+	ready := q.queue(name).ready
+	q.mu.Unlock()
+
+	for {
+		if d, ok := q.pop(name); ok {
+			q.deliver(ctx, name, d, handler)
+			continue
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Process delivers every message currently on the queue, including redeliveries, and returns once
+// the queue is empty. It returns the number of messages handled successfully.
+func (q *Memory) Process(ctx context.Context, name string, handler Handler) (int, error) {
+	handled := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return handled, err
+		}
+		d, ok := q.pop(name)
+		if !ok {
+			return handled, nil
+		}
+		if q.deliver(ctx, name, d, handler) {
+			handled++
+		}
+	}
+}
+
+// Len returns the number of messages waiting on the queue.
+func (q *Memory) Len(name string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.queue(name).deliveries)
+}
+
+func (q *Memory) deliver(ctx context.Context, name string, d delivery, handler Handler) bool {
+	err := handler(ctx, d.msg)
+	if err == nil {
+		return true
+	}
+
+	d.attempts++
+	if d.attempts >= maxDeliveries {
+		log.Error().Err(err).Str("messageID", d.msg.ID).Int("attempts", d.attempts).Msg("dropping message after repeated handler failures")
+		return false
+	}
+
+	log.Warn().Err(err).Str("messageID", d.msg.ID).Int("attempts", d.attempts).Msg("handler failed, requeueing message")
+	q.push(name, d)
+	return false
+}
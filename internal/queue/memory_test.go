@@ -0,0 +1,117 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/queue"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryProcess(t *testing.T) {
+	q := queue.NewMemory()
+	ctx := context.Background()
+
+	assert.NoError(t, q.Publish(ctx, "retrieval", "first"))
+	assert.NoError(t, q.Publish(ctx, "retrieval", "second"))
+	assert.NoError(t, q.Publish(ctx, "scan", "other queue"))
+
+	var bodies []string
+	handled, err := q.Process(ctx, "retrieval", func(ctx context.Context, msg queue.Message) error {
+		bodies = append(bodies, msg.Body)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	assert.Equal(t, []string{"first", "second"}, bodies)
+	assert.Equal(t, 0, q.Len("retrieval"))
+	assert.Equal(t, 1, q.Len("scan"))
+}
+
+func TestMemoryRedeliversFailedMessage(t *testing.T) {
+	q := queue.NewMemory()
+	ctx := context.Background()
+
+	assert.NoError(t, q.Publish(ctx, "scan", "flaky"))
+
+	calls := 0
+	handled, err := q.Process(ctx, "scan", func(ctx context.Context, msg queue.Message) error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient failure")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemoryDropsPoisonMessage(t *testing.T) {
+	q := queue.NewMemory()
+	ctx := context.Background()
+
+	assert.NoError(t, q.Publish(ctx, "scan", "poison"))
+
+	calls := 0
+	handled, err := q.Process(ctx, "scan", func(ctx context.Context, msg queue.Message) error {
+		calls++
+		return errors.New("permanent failure")
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, handled)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 0, q.Len("scan"))
+}
+
+func TestMemoryRedeliversBeforeProcessReturns(t *testing.T) {
+	q := queue.NewMemory()
+	ctx := context.Background()
+
+	// more messages than any channel buffer, each failing its first delivery
+	const messages = 500
+	for i := range messages {
+		assert.NoError(t, q.Publish(ctx, "scan", strconv.Itoa(i)))
+	}
+
+	failed := make(map[string]bool)
+	handled, err := q.Process(ctx, "scan", func(ctx context.Context, msg queue.Message) error {
+		if !failed[msg.Body] {
+			failed[msg.Body] = true
+			return errors.New("transient failure")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, messages, handled)
+	assert.Equal(t, 0, q.Len("scan"))
+}
+
+func TestMemoryConsume(t *testing.T) {
+	q := queue.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bodies := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- q.Consume(ctx, "retrieval", func(ctx context.Context, msg queue.Message) error {
+			bodies <- msg.Body
+			return nil
+		})
+	}()
+
+	assert.NoError(t, q.Publish(context.Background(), "retrieval", "first"))
+	assert.Equal(t, "first", <-bodies)
+	assert.NoError(t, q.Publish(context.Background(), "retrieval", "second"))
+	assert.Equal(t, "second", <-bodies)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,23 @@
+package queue
+
+import (
+	"context"
+)
+
+// Message is a single queue message as seen by a stage handler.
+type Message struct {
+	ID   string
+	Body string
+}
+
+// Handler processes one message. Returning an error leaves the message on the queue for redelivery.
+type Handler func(ctx context.Context, msg Message) error
+
+type Publisher interface {
+	Publish(ctx context.Context, queue string, body string) error
+}
+
+type Consumer interface {
+	// Consume delivers messages from queue to handler until ctx is cancelled.
+	Consume(ctx context.Context, queue string, handler Handler) error
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/rs/zerolog/log"
+)
+
+// SQS publishes to and consumes from SQS queues. Queue names are queue URLs.
+type SQS struct {
+	client *sqs.Client
+}
+
+func NewSQS(client *sqs.Client) *SQS {
+	return &SQS{client: client}
+}
+
+func (q *SQS) Publish(ctx context.Context, queueURL string, body string) error {
+	output, err := q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("function", "Publish").Str("queueURL", queueURL).Msg("unable to send message")
+		return fmt.Errorf("unable to send message: %w", err)
+	}
+
+	log.Info().Str("function", "Publish").Str("queueURL", queueURL).Str("messageID", aws.ToString(output.MessageId)).Msg("message sent")
+	return nil
+}
+
+// Consume long-polls queueURL and deletes each message once handler succeeds. Failed messages are
+// left for SQS to redeliver after the visibility timeout.
+func (q *SQS) Consume(ctx context.Context, queueURL string, handler Handler) error {
+	for {
+		output, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return fmt.Errorf("unable to receive messages: %w", err)
+		}
+
+		for _, m := range output.Messages {
+			msg := Message{ID: aws.ToString(m.MessageId), Body: aws.ToString(m.Body)}
+			if err := handler(ctx, msg); err != nil {
+				log.Warn().Err(err).Str("function", "Consume").Str("messageID", msg.ID).Msg("handler failed, leaving message for redelivery")
+				continue
+			}
+
+			_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueURL),
+				ReceiptHandle: m.ReceiptHandle,
+			})
+			if err != nil {
+				log.Error().Err(err).Str("function", "Consume").Str("messageID", msg.ID).Msg("unable to delete message")
+			}
+		}
+	}
+}
+
+// HandleSQSEvent adapts a Lambda SQS event to handler. It stops at the first failing record so that
+// the batch is redelivered, matching the behaviour of the SQS event source mapping.
+func HandleSQSEvent(ctx context.Context, event events.SQSEvent, handler Handler) error {
+	for _, record := range event.Records {
+		log.Info().Str("messageID", record.MessageId).Msg("Processing SQS message")
+
+		if err := handler(ctx, Message{ID: record.MessageId, Body: record.Body}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
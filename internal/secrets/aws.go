@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type ssmProvider struct {
+	client *ssm.Client
+}
+
+// NewSSM reads SSM parameters, decrypting SecureString parameters.
+func NewSSM(client *ssm.Client) Provider {
+	return &ssmProvider{client: client}
+}
+
+func (p *ssmProvider) Get(ctx context.Context, name string) (string, error) {
+	output, err := p.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+
+	var notFound *ssmtypes.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("parameter %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get parameter %s: %w", name, err)
+	}
+
+	return aws.ToString(output.Parameter.Value), nil
+}
+
+type secretsManagerProvider struct {
+	client *secretsmanager.Client
+}
+
+// NewSecretsManager reads the current string value of Secrets Manager secrets.
+func NewSecretsManager(client *secretsmanager.Client) Provider {
+	return &secretsManagerProvider{client: client}
+}
+
+func (p *secretsManagerProvider) Get(ctx context.Context, name string) (string, error) {
+	output, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("secret %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", name)
+	}
+
+	return *output.SecretString, nil
+}
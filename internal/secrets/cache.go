@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a cached secret is served before it is fetched again.
+const DefaultTTL = 5 * time.Minute
+
+type cacheEntry struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// Cache wraps a Provider and serves each secret from memory for ttl, so rotated secrets are picked
+// up without a cold start while the backend is not hit on every use.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+func (c *Cache) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+
+	if ok && c.now().Sub(entry.fetchedAt) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{value: value, fetchedAt: c.now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// Invalidate drops the cached value of name, so the next Get goes to the provider.
+func (c *Cache) Invalidate(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.mu.Unlock()
+}
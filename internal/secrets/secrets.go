@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by a Provider that has no secret with the requested name.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches the current value of a named secret. What the name refers to depends on the
+// backend: an SSM parameter, a Secrets Manager secret ID, an environment variable or a file.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+type envProvider struct{}
+
+// NewEnv reads secrets from environment variables of the same name.
+func NewEnv() Provider {
+	return envProvider{}
+}
+
+func (envProvider) Get(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("env %s: %w", name, ErrNotFound)
+	}
+	return value, nil
+}
+
+type fileProvider struct {
+	dir string
+}
+
+// NewFile reads secrets from files under dir, one secret per file, as mounted secret volumes lay
+// them out. The file is read on every Get so a rotated file is picked up once the cache expires.
+func NewFile(dir string) Provider {
+	return &fileProvider{dir: dir}
+}
+
+func (f *fileProvider) Get(ctx context.Context, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid secret file name %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("file %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", name, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Secret is a handle on one named secret of a provider, so callers can re-read it after rotation
+// instead of holding on to the value they were started with.
+type Secret struct {
+	provider Provider
+	name     string
+}
+
+func NewSecret(provider Provider, name string) *Secret {
+	return &Secret{provider: provider, name: name}
+}
+
+func (s *Secret) Name() string {
+	return s.name
+}
+
+// Value returns the secret's value, from the cache when the provider is a Cache.
+func (s *Secret) Value(ctx context.Context) (string, error) {
+	return s.provider.Get(ctx, s.name)
+}
+
+// Refresh drops any cached value and fetches the secret again.
+func (s *Secret) Refresh(ctx context.Context) (string, error) {
+	if cache, ok := s.provider.(*Cache); ok {
+		cache.Invalidate(s.name)
+	}
+	return s.provider.Get(ctx, s.name)
+}
+
+// Use calls fn with the secret's value. When fn fails with an error isAuthFailure recognises, the
+// secret is refreshed and fn is retried once, provided the value actually changed.
+func (s *Secret) Use(ctx context.Context, isAuthFailure func(error) bool, fn func(value string) error) error {
+	value, err := s.Value(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(value)
+	if err == nil || !isAuthFailure(err) {
+		return err
+	}
+
+	refreshed, refreshErr := s.Refresh(ctx)
+	if refreshErr != nil {
+		return fmt.Errorf("%w (refreshing secret %s also failed: %v)", err, s.name, refreshErr)
+	}
+	if refreshed == value {
+		return err
+	}
+
+	return fn(refreshed)
+}
@@ -0,0 +1,100 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Tristan-HuiFeng/ProjectWoz_Infra/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+// rotatingProvider returns the next value of a rotation on every fetch.
+type rotatingProvider struct {
+	values  []string
+	fetches int
+}
+
+func (p *rotatingProvider) Get(ctx context.Context, name string) (string, error) {
+	value := p.values[min(p.fetches, len(p.values)-1)]
+	p.fetches++
+	return value, nil
+}
+
+var errAuth = errors.New("authentication failed")
+
+func isAuthFailure(err error) bool {
+	return errors.Is(err, errAuth)
+}
+
+func TestCacheServesUntilTTL(t *testing.T) {
+	provider := &rotatingProvider{values: []string{"old", "new"}}
+
+	cached := secrets.NewCache(provider, time.Hour)
+	first, _ := cached.Get(context.Background(), "smtp")
+	second, _ := cached.Get(context.Background(), "smtp")
+	assert.Equal(t, "old", first)
+	assert.Equal(t, "old", second)
+	assert.Equal(t, 1, provider.fetches)
+
+	cached.Invalidate("smtp")
+	third, _ := cached.Get(context.Background(), "smtp")
+	assert.Equal(t, "new", third)
+
+	expired := secrets.NewCache(&rotatingProvider{values: []string{"old", "new"}}, 0)
+	expired.Get(context.Background(), "smtp")
+	value, _ := expired.Get(context.Background(), "smtp")
+	assert.Equal(t, "new", value)
+}
+
+func TestUseRefreshesOnAuthFailure(t *testing.T) {
+	provider := &rotatingProvider{values: []string{"old", "new"}}
+	secret := secrets.NewSecret(secrets.NewCache(provider, time.Hour), "smtp")
+
+	var used []string
+	err := secret.Use(context.Background(), isAuthFailure, func(value string) error {
+		used = append(used, value)
+		if value == "old" {
+			return errAuth
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "new"}, used)
+}
+
+func TestUseDoesNotRetryUnchangedSecret(t *testing.T) {
+	provider := &rotatingProvider{values: []string{"same"}}
+	secret := secrets.NewSecret(secrets.NewCache(provider, time.Hour), "smtp")
+
+	calls := 0
+	err := secret.Use(context.Background(), isAuthFailure, func(value string) error {
+		calls++
+		return errAuth
+	})
+
+	assert.ErrorIs(t, err, errAuth)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, provider.fetches)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "smtp_password"), []byte("hunter2\n"), 0o600))
+
+	provider := secrets.NewFile(dir)
+
+	value, err := provider.Get(context.Background(), "smtp_password")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	_, err = provider.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	_, err = provider.Get(context.Background(), "../etc/passwd")
+	assert.Error(t, err)
+}